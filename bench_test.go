@@ -1,8 +1,12 @@
 package lex
 
 import (
+	"bytes"
 	"math/rand"
 	"testing"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 type mockReader struct{}
@@ -30,3 +34,273 @@ func BenchmarkLexer(b *testing.B) {
 		}
 	}
 }
+
+var benchWords = []string{"foo", "bar", "baz", "quux"}
+
+func benchmarkEmit(b *testing.B, init StateFn, consume func(it Item)) {
+	l := NewLexer(NewFile("", mockReader{}), init)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		consume(l.LexItem())
+	}
+}
+
+func BenchmarkEmit_interface(b *testing.B) {
+	i := 0
+	benchmarkEmit(b,
+		func(s *State) StateFn {
+			i++
+			s.Emit(i, 1, benchWords[i&3])
+			s.Emit(i, 2, int64(i)+1000)
+			return nil
+		},
+		func(it Item) {
+			_ = it.Value()
+		})
+}
+
+func BenchmarkEmit_typed(b *testing.B) {
+	i := 0
+	benchmarkEmit(b,
+		func(s *State) StateFn {
+			i++
+			s.EmitString(i, 1, benchWords[i&3])
+			s.EmitInt64(i, 2, int64(i)+1000)
+			return nil
+		},
+		func(it Item) {
+			if it.Type == 1 {
+				_, _ = it.Str()
+			} else {
+				_, _ = it.Int64()
+			}
+		})
+}
+
+func benchmarkLexBatch(b *testing.B, size int) {
+	i := 0
+	init := func(s *State) StateFn {
+		i++
+		s.EmitInt64(i, 1, int64(i))
+		return nil
+	}
+	l := NewLexer(NewFile("", mockReader{}), init)
+	buf := make([]Item, size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; {
+		if b.N-n < size {
+			buf = buf[:b.N-n]
+		}
+		n += l.LexBatch(buf)
+	}
+}
+
+func benchmarkIdent(b *testing.B, start func(s *State, pos int), emit func(s *State)) {
+	init := func(s *State) StateFn {
+		s.Next()
+		start(s, s.Pos())
+		for r := s.Next(); r < utf8.RuneSelf && identSet[r]; r = s.Next() {
+		}
+		s.Backup()
+		emit(s)
+		s.Next() // skip space
+		return nil
+	}
+	l := NewLexer(NewFile("", identReader{}), init)
+	b.SetBytes(16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.LexItem()
+	}
+}
+
+func BenchmarkStartToken(b *testing.B) {
+	benchmarkIdent(b, (*State).StartToken, func(s *State) { s.Emit(s.TokenPos(), 1, nil) })
+}
+
+func BenchmarkEmitCurrent(b *testing.B) {
+	benchmarkIdent(b, (*State).StartCapture, func(s *State) { s.EmitCurrent(1) })
+}
+
+func BenchmarkLexBatch_1(b *testing.B)  { benchmarkLexBatch(b, 1) }
+func BenchmarkLexBatch_64(b *testing.B) { benchmarkLexBatch(b, 64) }
+
+// identifier runs of 16 characters
+type identReader struct{}
+
+func (identReader) Read(p []byte) (int, error) {
+	for i := range p {
+		if i&15 == 15 {
+			p[i] = ' '
+		} else {
+			p[i] = 'a'
+		}
+	}
+	return len(p), nil
+}
+
+var identSet = func() (set [256]bool) {
+	for c := 'a'; c <= 'z'; c++ {
+		set[c] = true
+	}
+	return
+}()
+
+func BenchmarkNext_run(b *testing.B) {
+	s := (*State)(NewLexer(NewFile("", identReader{}), nil))
+	b.SetBytes(16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for r := s.Next(); r < utf8.RuneSelf && identSet[r]; r = s.Next() {
+		}
+	}
+}
+
+func benchmarkNextLines(b *testing.B, opts ...Option) {
+	src := bytes.Repeat([]byte("abc\n"), 16<<10)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := NewLexer(NewFile("", bytes.NewReader(src)), nil, opts...)
+		s := (*State)(l)
+		for s.Next() != EOF {
+		}
+		l.Release()
+	}
+}
+
+func BenchmarkNext_lines(b *testing.B)     { benchmarkNextLines(b) }
+func BenchmarkNext_lazyLines(b *testing.B) { benchmarkNextLines(b, LazyLines()) }
+
+func BenchmarkNext_func(b *testing.B) {
+	s := (*State)(NewLexer(NewFile("", identReader{}), nil))
+	isIdent := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	b.SetBytes(16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for r := s.Next(); isIdent(r); r = s.Next() {
+		}
+	}
+}
+
+func BenchmarkAcceptWhileClass(b *testing.B) {
+	s := (*State)(NewLexer(NewFile("", identReader{}), nil))
+	c := NewClass(unicode.L, unicode.Nd).Union(ClassOf("_"))
+	b.SetBytes(16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.AcceptWhileClass(c)
+		s.Next()
+	}
+}
+
+func BenchmarkAcceptWhileByteSet(b *testing.B) {
+	s := (*State)(NewLexer(NewFile("", identReader{}), nil))
+	b.SetBytes(16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.AcceptWhileByteSet(&identSet)
+		s.Next()
+	}
+}
+
+// wordReader returns runs of 255 lowercase letters separated by a space.
+type wordReader struct{}
+
+func (wordReader) Read(p []byte) (int, error) {
+	for i := range p {
+		if i&255 == 255 {
+			p[i] = ' '
+		} else {
+			p[i] = 'a' + byte(i%26)
+		}
+	}
+	return len(p), nil
+}
+
+func benchmarkWords(b *testing.B, accept func(s *State)) {
+	s := (*State)(NewLexer(NewFile("", wordReader{}), nil))
+	b.SetBytes(256)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		accept(s)
+		s.Next()
+	}
+}
+
+func nextWord(s *State) {
+	for r := s.Next(); r < utf8.RuneSelf && identSet[r]; r = s.Next() {
+	}
+	s.Backup()
+}
+
+var wordClass = NewClass(unicode.L, unicode.Nd).Union(ClassOf("_"))
+
+func byteSetWord(s *State) { s.AcceptWhileByteSet(&identSet) }
+func classWord(s *State)   { s.AcceptWhileClass(wordClass) }
+
+func BenchmarkWords_next(b *testing.B)    { benchmarkWords(b, nextWord) }
+func BenchmarkWords_byteSet(b *testing.B) { benchmarkWords(b, byteSetWord) }
+func BenchmarkWords_class(b *testing.B)   { benchmarkWords(b, classWord) }
+
+// TestAcceptWhile_bulk checks that the bulk scans of AcceptWhileByteSet and
+// AcceptWhileClass are faster than calling Next in a loop, like the
+// BenchmarkWords benchmarks but with a shorter run time.
+func TestAcceptWhile_bulk(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping timing test in short mode")
+	}
+	// best time of a few runs over 1 MiB of input
+	run := func(accept func(s *State)) time.Duration {
+		best := time.Duration(1<<63 - 1)
+		for i := 0; i < 3; i++ {
+			s := (*State)(NewLexer(NewFile("", wordReader{}), nil))
+			start := time.Now()
+			for n := 0; n < 4<<10; n++ {
+				accept(s)
+				s.Next()
+			}
+			if d := time.Since(start); d < best {
+				best = d
+			}
+		}
+		return best
+	}
+	next := run(nextWord)
+	for _, tc := range []struct {
+		name   string
+		accept func(s *State)
+	}{
+		{"AcceptWhileByteSet", byteSetWord},
+		{"AcceptWhileClass", classWord},
+	} {
+		if d := run(tc.accept); d >= next {
+			t.Errorf("%s: %v, not faster than a Next loop (%v)", tc.name, d, next)
+		}
+	}
+}
+
+func benchmarkNewLexer(b *testing.B, release bool, opts ...Option) {
+	init := func(s *State) StateFn {
+		s.Next()
+		s.Emit(s.Pos(), 0, nil)
+		return nil
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := NewLexer(NewFile("", mockReader{}), init, opts...)
+		l.Lex()
+		if release {
+			l.Release()
+		}
+	}
+}
+
+func BenchmarkNewLexer(b *testing.B)         { benchmarkNewLexer(b, false) }
+func BenchmarkNewLexer_release(b *testing.B) { benchmarkNewLexer(b, true) }
+func BenchmarkNewLexer_small(b *testing.B) {
+	benchmarkNewLexer(b, false, BufferSize(MinBufferSize))
+}
@@ -0,0 +1,82 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import "fmt"
+
+// A BidiPolicy tells the lexer what to do with the bidirectional embedding,
+// override and isolate characters U+202A to U+202E and U+2066 to U+2069. See
+// BidiControls.
+//
+type BidiPolicy uint8
+
+// Bidi policies.
+//
+const (
+	BidiAllow  BidiPolicy = iota // return them like any other rune (the default)
+	BidiWarn                     // emit a Warning token and return them
+	BidiReject                   // emit an Error token and filter them out
+)
+
+var bidiNames = [...]string{"BidiAllow", "BidiWarn", "BidiReject"}
+
+// BidiControls sets the policy of the lexer for bidirectional embedding,
+// override and isolate characters. These characters can make source code
+// display differently from its logical order (see the "Trojan Source"
+// attacks) and several languages reject them outside of comments and
+// strings, or everywhere.
+//
+// The policy is enforced by State.Next, regardless of the context, like for
+// NUL bytes: with BidiReject, these characters are reported and filtered out
+// like invalid input. Languages that only allow them in some contexts can use
+// BidiWarn and discard the warnings in those contexts. The value of the
+// emitted Warning or Error tokens wraps ErrBidiControl. Like other encoding
+// errors, they are deferred with the DeferErrors option.
+//
+func BidiControls(p BidiPolicy) Option {
+	return option(func(s *state) {
+		s.bidi = p
+	}, "BidiControls", p)
+}
+
+func (p BidiPolicy) String() string {
+	if int(p) < len(bidiNames) {
+		return bidiNames[p]
+	}
+	return fmt.Sprintf("BidiPolicy(%d)", p)
+}
+
+// isBidiControl reports whether r is subject to the BidiPolicy.
+//
+func isBidiControl(r rune) bool {
+	return 0x202a <= r && r <= 0x202e || 0x2066 <= r && r <= 0x2069
+}
+
+// bidiControl applies the bidi policy to the rune r of size w at offset off.
+// It returns false if r must be filtered out.
+//
+func (s *State) bidiControl(off, w int, r rune) bool {
+	t := Warning
+	if s.bidi == BidiReject {
+		t = Error
+	}
+	s.pushEncodingError(Item{Type: t, Pos: off, End: off + w, v: fmt.Errorf("%w %U", ErrBidiControl, r)})
+	return t == Warning
+}
@@ -0,0 +1,60 @@
+package lex_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestBidiControls(t *testing.T) {
+	init := func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		if r == lex.EOF {
+			s.Emit(s.Pos(), tokEOF, nil)
+		} else {
+			s.EmitRune(s.Pos(), tokChar, r)
+		}
+		return nil
+	}
+	td := []struct {
+		p   lex.BidiPolicy
+		res string
+	}{
+		{lex.BidiAllow, "a0 U+202E1 b4 U+20665"},
+		{lex.BidiWarn, "a0 W1-4 U+202E1 b4 W5-8 U+20665"},
+		{lex.BidiReject, "a0 E1-4 b4 E5-8"},
+	}
+	for _, d := range td {
+		l := lex.NewLexer(lex.NewFile("test", strings.NewReader("a\u202eb\u2066\u200f")), init, lex.BidiControls(d.p))
+		var res []string
+		for it := l.LexItem(); it.Type != tokEOF; it = l.LexItem() {
+			switch it.Type {
+			case lex.Warning, lex.Error:
+				if !errors.Is(it.Err(), lex.ErrBidiControl) {
+					t.Errorf("unexpected error %v", it.Err())
+				}
+				k := "W"
+				if it.Type == lex.Error {
+					k = "E"
+				}
+				res = append(res, fmt.Sprintf("%s%d-%d", k, it.Pos, it.End))
+			default:
+				r, _ := it.Rune()
+				if r == '\u200f' {
+					continue
+				}
+				if r > 0x7f {
+					res = append(res, fmt.Sprintf("%U%d", r, it.Pos))
+				} else {
+					res = append(res, fmt.Sprintf("%c%d", r, it.Pos))
+				}
+			}
+		}
+		if got := strings.Join(res, " "); got != d.res {
+			t.Errorf("policy %d:\nGot     : %s\nExpected: %s", d.p, got, d.res)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import "sort"
+
+// Brackets matches the opening and closing brackets of a token stream.
+//
+type Brackets struct {
+	items []Item // bracket tokens, in input order
+	match []int  // index of the matching bracket in items, or -1
+	depth []int  // nesting depth right after each bracket
+}
+
+// MatchBrackets matches the bracket tokens in items, which must be in input
+// order. pairs maps the types of opening brackets to the type of the matching
+// closing brackets.
+//
+// Closing brackets are matched with the innermost pending opening bracket of
+// the same kind: pending opening brackets that are nested in it and were not
+// closed are unbalanced. Closing brackets that match no opening bracket are
+// unbalanced as well, and so are opening brackets still pending at the end of
+// items.
+//
+func MatchBrackets(items []Item, pairs map[Token]Token) *Brackets {
+	b := new(Brackets)
+	closes := make(map[Token]bool, len(pairs))
+	for _, c := range pairs {
+		closes[c] = true
+	}
+	var open []int
+	for _, it := range items {
+		_, isOpen := pairs[it.Type]
+		if it.Type == Error || !isOpen && !closes[it.Type] {
+			continue
+		}
+		i := len(b.items)
+		b.items = append(b.items, it)
+		b.match = append(b.match, -1)
+		if closes[it.Type] {
+			for j := len(open) - 1; j >= 0; j-- {
+				if o := open[j]; pairs[b.items[o].Type] == it.Type {
+					b.match[o], b.match[i] = i, o
+					open = open[:j]
+					isOpen = false
+					break
+				}
+			}
+		}
+		if isOpen {
+			open = append(open, i)
+		}
+		b.depth = append(b.depth, len(open))
+	}
+	return b
+}
+
+// at returns the index of the bracket covering offset, or -1.
+//
+func (b *Brackets) at(offset int) int {
+	i := sort.Search(len(b.items), func(i int) bool { return b.items[i].Pos > offset }) - 1
+	if i >= 0 && (offset < b.items[i].End || offset == b.items[i].Pos) {
+		return i
+	}
+	return -1
+}
+
+// Match returns the bracket that matches the bracket at offset. It returns
+// false if there is no bracket at offset or if it is unbalanced.
+//
+func (b *Brackets) Match(offset int) (Item, bool) {
+	if i := b.at(offset); i >= 0 && b.match[i] >= 0 {
+		return b.items[b.match[i]], true
+	}
+	return Item{}, false
+}
+
+// Depth returns the number of balanced or pending opening brackets that
+// enclose offset.
+//
+func (b *Brackets) Depth(offset int) int {
+	i := sort.Search(len(b.items), func(i int) bool { return b.items[i].End > offset }) - 1
+	if i < 0 {
+		return 0
+	}
+	return b.depth[i]
+}
+
+// Unbalanced returns the unbalanced brackets in input order.
+//
+func (b *Brackets) Unbalanced() []Item {
+	var u []Item
+	for i, m := range b.match {
+		if m < 0 {
+			u = append(u, b.items[i])
+		}
+	}
+	return u
+}
@@ -0,0 +1,41 @@
+package lex_test
+
+import (
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestMatchBrackets(t *testing.T) {
+	src := "(a[b)c]{d}})"
+	types := map[rune]lex.Token{'(': 1, ')': 2, '[': 3, ']': 4, '{': 5, '}': 6}
+	var items []lex.Item
+	for i, r := range src {
+		if tt, ok := types[r]; ok {
+			items = append(items, lex.NewItem(tt, i, i+1, nil))
+		} else {
+			items = append(items, lex.NewItem(100, i, i+1, nil))
+		}
+	}
+	b := lex.MatchBrackets(items, map[lex.Token]lex.Token{1: 2, 3: 4, 5: 6})
+	for _, d := range []struct {
+		off, match int
+	}{{0, 4}, {4, 0}, {7, 9}, {9, 7}, {2, -1}, {6, -1}, {10, -1}, {11, -1}, {1, -1}} {
+		it, ok := b.Match(d.off)
+		if ok != (d.match >= 0) || ok && it.Pos != d.match {
+			t.Errorf("Match(%d): got %v %v, expected %d", d.off, it.Pos, ok, d.match)
+		}
+	}
+	var got []int
+	for _, it := range b.Unbalanced() {
+		got = append(got, it.Pos)
+	}
+	if len(got) != 4 || got[0] != 2 || got[1] != 6 || got[2] != 10 || got[3] != 11 {
+		t.Errorf("got unbalanced brackets at %v", got)
+	}
+	for off, exp := range []int{0, 1, 1, 2, 2, 0, 0, 0, 1, 1, 0, 0} {
+		if d := b.Depth(off); d != exp {
+			t.Errorf("Depth(%d): got %d, expected %d", off, d, exp)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import "context"
+
+// Channel runs l in a new goroutine and sends its tokens on the returned
+// channel, for example to select on tokens and other events. The channel is
+// closed after the token that brings the lexer to the end of input (see
+// Lexer.AtEOF) has been sent, or when ctx is done. In the latter case, the
+// goroutine exits without waiting for the consumer, and the last token lexed
+// may not have been sent.
+//
+// The lexer must not be used by the caller until the channel is closed.
+//
+func Channel(ctx context.Context, l *Lexer) <-chan Item {
+	c := make(chan Item)
+	go func() {
+		defer close(c)
+		for {
+			it := l.LexItem()
+			select {
+			case c <- it:
+			case <-ctx.Done():
+				return
+			}
+			if l.AtEOF() {
+				return
+			}
+		}
+	}()
+	return c
+}
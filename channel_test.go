@@ -0,0 +1,39 @@
+package lex_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestChannel(t *testing.T) {
+	init := func(s *lex.State) lex.StateFn {
+		if r := s.Next(); r == lex.EOF {
+			s.Emit(s.Pos(), tokEOF, nil)
+		} else {
+			s.EmitRune(s.Pos(), tokChar, r)
+		}
+		return nil
+	}
+	var b strings.Builder
+	for it := range lex.Channel(context.Background(), lex.NewLexer(lex.NewFile("test", strings.NewReader("abc")), init)) {
+		if r, ok := it.Rune(); ok {
+			b.WriteRune(r)
+		} else if it.Type != tokEOF {
+			t.Fatalf("unexpected token %v", it)
+		}
+	}
+	if b.String() != "abc" {
+		t.Errorf("got %q, expected abc", b.String())
+	}
+
+	// the channel is closed upon cancellation.
+	ctx, cancel := context.WithCancel(context.Background())
+	c := lex.Channel(ctx, lex.NewLexer(lex.NewFile("test", strings.NewReader("abc")), init))
+	<-c
+	cancel()
+	for range c {
+	}
+}
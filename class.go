@@ -0,0 +1,243 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Class is a set of runes optimized for fast membership tests. Membership of
+// runes below 256 is precomputed into a bitmap, so that testing ASCII and
+// Latin-1 runes does not involve any function call. Other runes are looked up
+// in Unicode range tables or tested with predicate functions, depending on how
+// the class was built.
+//
+// Classes are typically built once at package initialization and used with
+// Class.Contains or State.AcceptWhileClass in place of per-rune predicates:
+//
+//	var identChars = lex.NewClass(unicode.L, unicode.Nd).Union(lex.ClassOf("_"))
+//
+//	func ident(s *lex.State) lex.StateFn {
+//		s.AcceptWhileClass(identChars)
+//		// ...
+//	}
+//
+// A Class must not be modified after creation and is safe for concurrent use.
+//
+type Class struct {
+	bits   [4]uint64 // membership of runes < 256
+	tables []*unicode.RangeTable
+	funcs  []func(rune) bool
+}
+
+// NewClass returns a class containing the runes of the given range tables.
+//
+func NewClass(tables ...*unicode.RangeTable) *Class {
+	c := &Class{tables: append([]*unicode.RangeTable(nil), tables...)}
+	c.init()
+	return c
+}
+
+// ClassOf returns a class containing the runes of chars.
+//
+func ClassOf(chars string) *Class {
+	var rs []rune
+	for _, r := range chars {
+		if r != utf8.RuneError {
+			rs = append(rs, r)
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i] < rs[j] })
+	t := new(unicode.RangeTable)
+	for _, r := range rs {
+		if l := len(t.R32); l > 0 && rune(t.R32[l-1].Hi)+1 >= r {
+			t.R32[l-1].Hi = uint32(r)
+			continue
+		}
+		t.R32 = append(t.R32, unicode.Range32{Lo: uint32(r), Hi: uint32(r), Stride: 1})
+	}
+	return NewClass(t)
+}
+
+// ClassRange returns a class containing the runes in the range [lo, hi].
+//
+func ClassRange(lo, hi rune) *Class {
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > unicode.MaxRune {
+		hi = unicode.MaxRune
+	}
+	t := new(unicode.RangeTable)
+	if lo <= hi {
+		t.R32 = []unicode.Range32{{Lo: uint32(lo), Hi: uint32(hi), Stride: 1}}
+	}
+	return NewClass(t)
+}
+
+// ClassFunc returns a class containing the runes for which f returns true. f
+// is called once for each rune below 256 when the class is created and for
+// each tested rune above.
+//
+func ClassFunc(f func(r rune) bool) *Class {
+	c := &Class{funcs: []func(rune) bool{f}}
+	c.init()
+	return c
+}
+
+// Union returns a new class containing the runes of c and of all the classes
+// in cs.
+//
+func (c *Class) Union(cs ...*Class) *Class {
+	u := *c
+	u.tables = append([]*unicode.RangeTable(nil), c.tables...)
+	u.funcs = append([]func(rune) bool(nil), c.funcs...)
+	for _, o := range cs {
+		for i := range u.bits {
+			u.bits[i] |= o.bits[i]
+		}
+		u.tables = append(u.tables, o.tables...)
+		u.funcs = append(u.funcs, o.funcs...)
+	}
+	return &u
+}
+
+// init precomputes the bitmap.
+//
+func (c *Class) init() {
+	for r := rune(0); r < 256; r++ {
+		if c.lookup(r) {
+			c.bits[r>>6] |= 1 << (r & 63)
+		}
+	}
+}
+
+func (c *Class) lookup(r rune) bool {
+	for _, t := range c.tables {
+		if unicode.Is(t, r) {
+			return true
+		}
+	}
+	for _, f := range c.funcs {
+		if f(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether r is in c.
+//
+func (c *Class) Contains(r rune) bool {
+	if uint32(r) < 256 {
+		return c.bits[r>>6]&(1<<(r&63)) != 0
+	}
+	return r >= 0 && c.lookup(r)
+}
+
+// AcceptWhileClass advances over the longest run of runes in c and returns the
+// number of runes read. It is equivalent to calling Next until it returns a
+// rune not in c, then Backup, but runs of ASCII characters are scanned
+// directly in the input buffer like with AcceptWhileByteSet.
+//
+// Upon return, Current and Pos return the last rune read and Backup can undo
+// up to BackupBufferSize-1 runes.
+//
+func (s *State) AcceptWhileClass(c *Class) int {
+	n, ok := s.acceptStart(c.Contains)
+	for ok && s.available() {
+		i := s.r
+		for ; i < s.w; i++ {
+			b := s.buf[i]
+			if b == 0 || b >= utf8.RuneSelf || c.bits[b>>6]&(1<<(b&63)) == 0 {
+				break
+			}
+			if b == '\n' && !s.lazy {
+				s.newline(s.offs + i + 1)
+			} else if b == '\r' && s.nl&newlineCR != 0 {
+				break
+			}
+		}
+		var k int
+		k, ok = s.acceptEnd(i, c.Contains)
+		n += k
+	}
+	return n
+}
+
+// AcceptWhileCategory advances over the longest run of runes in the Unicode
+// range table t, like unicode.L or unicode.Nd, and returns the number of runes
+// read. It is equivalent to calling Next until it returns a rune r for which
+// unicode.Is(t, r) is false, then Backup, but runs of ASCII characters are
+// scanned directly in the input buffer.
+//
+// Tables used repeatedly are better converted once to a Class with NewClass and
+// used with AcceptWhileClass, which does not need to search the table for
+// runes below 256.
+//
+// Upon return, Current and Pos return the last rune read and Backup can undo
+// up to BackupBufferSize-1 runes.
+//
+func (s *State) AcceptWhileCategory(t *unicode.RangeTable) int {
+	return s.acceptRun(func(r rune) bool { return unicode.Is(t, r) })
+}
+
+// AcceptWhileCategories is like AcceptWhileCategory for runes in any of the
+// given range tables.
+//
+func (s *State) AcceptWhileCategories(ts ...*unicode.RangeTable) int {
+	return s.acceptRun(func(r rune) bool { return unicode.In(r, ts...) })
+}
+
+// SkipUntil reads input until it reads one of the runes in set or EOF and
+// returns it. It is typically used to resynchronize after an error, by
+// skipping to the end of the current statement or line:
+//
+//	if r := s.SkipUntil(';', '\n'); r == '\n' {
+//		s.Backup() // newlines are tokens
+//	}
+//
+// Upon return, Current and Pos return the rune returned by SkipUntil. Skipped
+// runes are scanned like with AcceptWhileClass.
+//
+func (s *State) SkipUntil(set ...rune) rune {
+	return s.SkipUntilFunc(func(r rune) bool {
+		for _, c := range set {
+			if r == c {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// SkipUntilFunc is like SkipUntil for the first rune for which f returns true.
+//
+func (s *State) SkipUntilFunc(f func(r rune) bool) rune {
+	skip := func(r rune) bool { return !f(r) }
+	for {
+		s.acceptRun(skip)
+		if r := s.Next(); r == EOF || f(r) {
+			return r
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package lex_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+	"unicode"
+
+	"github.com/db47h/lex"
+)
+
+func TestClass_Contains(t *testing.T) {
+	isIdent := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	td := []struct {
+		name string
+		c    *lex.Class
+		in   func(r rune) bool
+	}{
+		{"tables", lex.NewClass(unicode.L, unicode.Nd).Union(lex.ClassOf("_")), isIdent},
+		{"func", lex.ClassFunc(isIdent), isIdent},
+		{"chars", lex.ClassOf("aé世zb\xff"), func(r rune) bool { return r == 'a' || r == 'b' || r == 'z' || r == 'é' || r == '世' }},
+		{"range", lex.ClassRange(0xf0, 0x120), func(r rune) bool { return r >= 0xf0 && r <= 0x120 }},
+		{"empty", lex.ClassRange(10, 1), func(r rune) bool { return false }},
+	}
+	for _, d := range td {
+		for _, r := range []rune{-1, 0, '\n', '_', 'a', 'b', 'c', 'z', '0', 0xe9, 0xf0, 0xff, 0x100, 0x120, 0x121, '世', unicode.MaxRune + 1} {
+			if got, exp := d.c.Contains(r), d.in(r); got != exp {
+				t.Errorf("%s: Contains(%#U) = %v, expected %v", d.name, r, got, exp)
+			}
+		}
+	}
+}
+
+func TestState_AcceptWhileClass(t *testing.T) {
+	c := lex.ClassOf("ab \né")
+	// lex runs of characters in c followed by a single other character,
+	// either with AcceptWhileClass or Next.
+	lexer := func(fast bool) lex.StateFn {
+		return func(s *lex.State) lex.StateFn {
+			r := s.Next()
+			if r == lex.EOF {
+				s.Emit(s.Pos(), tokEOF, nil)
+				return nil
+			}
+			s.StartToken(s.Pos())
+			if !c.Contains(r) {
+				s.EmitRune(s.Pos(), tokChar, r)
+				return nil
+			}
+			n := 1
+			if fast {
+				n += s.AcceptWhileClass(c)
+			} else {
+				for r = s.Next(); c.Contains(r); r = s.Next() {
+					n++
+				}
+				s.Backup()
+			}
+			s.Emit(s.TokenPos(), tokSpace, fmt.Sprint(n, s.Pos(), s.Current()))
+			return nil
+		}
+	}
+	rnd := rand.New(rand.NewSource(42))
+	chars := []string{"a", "b", " ", "\n", "\r", "é", "x", "世", "\x00", "\xff"}
+	for i := 0; i < 100; i++ {
+		var in []byte
+		for j := rnd.Intn(4096); j > 0; j-- {
+			in = append(in, chars[rnd.Intn(len(chars))]...)
+		}
+		f1 := lex.NewFile("test", bytes.NewReader(in))
+		f2 := lex.NewFile("test", iotest.HalfReader(bytes.NewReader(in)))
+		var nl lex.Newline
+		if i%3 == 2 {
+			nl = lex.NewlineCRLF | lex.NewlineCR | lex.NewlineUnicode
+		}
+		l1, l2 := lex.NewLexer(f1, lexer(false), lex.Newlines(nl)), lex.NewLexer(f2, lexer(true), lex.Newlines(nl))
+		for !l1.AtEOF() {
+			i1, i2 := l1.LexItem(), l2.LexItem()
+			if fmt.Sprint(i1.Type, i1.Pos, i1.End, i1.Value()) != fmt.Sprint(i2.Type, i2.Pos, i2.End, i2.Value()) {
+				t.Fatalf("input %d: got %v, expected %v", i, i2, i1)
+			}
+			if p1, p2 := f1.Position(i1.Pos), f2.Position(i2.Pos); p1 != p2 {
+				t.Fatalf("input %d: got position %v, expected %v", i, p2, p1)
+			}
+		}
+	}
+}
+
+func TestState_AcceptWhileCategory(t *testing.T) {
+	in := func(r rune) bool { return unicode.In(r, unicode.L, unicode.White_Space) }
+	lexer := func(fast bool) lex.StateFn {
+		return func(s *lex.State) lex.StateFn {
+			r := s.Next()
+			if r == lex.EOF {
+				s.Emit(s.Pos(), tokEOF, nil)
+				return nil
+			}
+			s.StartToken(s.Pos())
+			n := 1
+			switch {
+			case !in(r):
+				s.EmitRune(s.Pos(), tokChar, r)
+				return nil
+			case fast && unicode.IsLetter(r):
+				n += s.AcceptWhileCategory(unicode.L)
+			case fast:
+				n += s.AcceptWhileCategories(unicode.L, unicode.White_Space)
+			default:
+				for r2 := s.Next(); in(r2) && (unicode.IsLetter(r2) || !unicode.IsLetter(r)); r2 = s.Next() {
+					n++
+				}
+				s.Backup()
+			}
+			s.Emit(s.TokenPos(), tokSpace, fmt.Sprint(n, s.Pos(), s.Current()))
+			return nil
+		}
+	}
+	rnd := rand.New(rand.NewSource(42))
+	chars := []string{"a", "b", " ", "\n", "\r", "é", "1", "世", "\x00", "\xff", " "}
+	for i := 0; i < 50; i++ {
+		var in []byte
+		for j := rnd.Intn(4096); j > 0; j-- {
+			in = append(in, chars[rnd.Intn(len(chars))]...)
+		}
+		l1 := lex.NewLexer(lex.NewFile("test", bytes.NewReader(in)), lexer(false))
+		l2 := lex.NewLexer(lex.NewFile("test", iotest.HalfReader(bytes.NewReader(in))), lexer(true))
+		for !l1.AtEOF() {
+			i1, i2 := l1.LexItem(), l2.LexItem()
+			if fmt.Sprint(i1.Type, i1.Pos, i1.End, i1.Value()) != fmt.Sprint(i2.Type, i2.Pos, i2.End, i2.Value()) {
+				t.Fatalf("input %d: got %v, expected %v", i, i2, i1)
+			}
+		}
+	}
+}
+
+func TestState_SkipUntil(t *testing.T) {
+	l := lex.NewLexer(lex.NewFile("test", iotest.OneByteReader(bytes.NewReader([]byte("x!ab\x00c;y!\xffz\nw!end")))), func(s *lex.State) lex.StateFn {
+		switch r := s.Next(); r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case '!':
+			if s.SkipUntil(';', '\n') == lex.EOF {
+				s.Emit(s.Pos(), tokChar, nil)
+			} else {
+				s.EmitRuneToken(tokChar)
+			}
+		default:
+			s.EmitRuneToken(tokSpace)
+		}
+		return nil
+	})
+	var res []string
+	for !l.AtEOF() {
+		it := l.LexItem()
+		res = append(res, fmt.Sprintf("%v@%d", it.Type, it.Pos))
+	}
+	if got, exp := fmt.Sprint(res), "[1@0 Error@4 2@6 1@7 Error@9 2@11 1@12 2@17]"; got != exp {
+		t.Errorf("got %s, expected %s", got, exp)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"plugin"
+	"unicode"
+
+	"github.com/db47h/lex"
+	"github.com/db47h/lex/dfa"
+	"github.com/db47h/lex/internal/grammar"
+	"github.com/db47h/lex/state"
+)
+
+var errUnknownLexer = errors.New("unknown built-in lexer")
+
+// builtin returns the built-in lexer with the given name.
+//
+func builtin(name string) (*lexer, error) {
+	switch name {
+	case "go":
+		return goLexer, nil
+	}
+	return nil, fmt.Errorf("%s: %w", name, errUnknownLexer)
+}
+
+// Token types of the go lexer.
+//
+const (
+	goEOF lex.Token = iota
+	goSemiColon
+	goInt
+	goFloat
+	goString
+	goChar
+	goIdent
+	goOp
+)
+
+var goLexer = &lexer{
+	init: goInit,
+	names: map[lex.Token]string{
+		goEOF:       "EOF",
+		goSemiColon: "SemiColon",
+		goInt:       "Int",
+		goFloat:     "Float",
+		goString:    "String",
+		goChar:      "Char",
+		goIdent:     "Ident",
+		goOp:        "Op",
+	},
+}
+
+func goInit() lex.StateFn {
+	quotedString := state.QuotedString(goString)
+	quotedChar := state.QuotedChar(goChar)
+	number := state.Number(goInt, goFloat, '.')
+	ident := make([]rune, 0, 64)
+
+	return func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		s.StartToken(s.Pos())
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), goEOF, nil)
+		case r == '\n' || r == ';':
+			s.Emit(s.Pos(), goSemiColon, r)
+		case r == '"':
+			return quotedString
+		case r == '\'':
+			return quotedChar
+		case r >= '0' && r <= '9':
+			return number
+		case r == '.':
+			if r = s.Peek(); r >= '0' && r <= '9' {
+				return number
+			}
+			s.Emit(s.Pos(), goOp, '.')
+		case unicode.IsSpace(r):
+			for r = s.Next(); r != '\n' && unicode.IsSpace(r); r = s.Next() {
+			}
+			s.Backup()
+		case unicode.IsLetter(r) || r == '_':
+			ident = append(ident[:0], r)
+			for r = s.Next(); unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'; r = s.Next() {
+				ident = append(ident, r)
+			}
+			s.Backup()
+			s.Emit(s.TokenPos(), goIdent, string(ident))
+		default:
+			s.Emit(s.Pos(), goOp, r)
+		}
+		return nil
+	}
+}
+
+// pluginLexer loads a lexer from a Go plugin.
+//
+func pluginLexer(name string) (*lexer, error) {
+	p, err := plugin.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("NewLexer")
+	if err != nil {
+		return nil, err
+	}
+	init, ok := sym.(func() lex.StateFn)
+	if !ok {
+		return nil, fmt.Errorf("%s: NewLexer is of type %T, expected func() lex.StateFn", name, sym)
+	}
+	lx := &lexer{init: init}
+	if sym, err = p.Lookup("TokenNames"); err == nil {
+		names, ok := sym.(*map[lex.Token]string)
+		if !ok {
+			return nil, fmt.Errorf("%s: TokenNames is of type %T, expected map[lex.Token]string", name, sym)
+		}
+		lx.names = *names
+	}
+	return lx, nil
+}
+
+// grammarLexer returns a lexer that interprets a lexgen grammar. Token types
+// are numbered like in the code generated by lexgen.
+//
+func grammarLexer(name string) (*lexer, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	g, err := grammar.Parse(name, f)
+	if err != nil {
+		return nil, err
+	}
+	lx := &lexer{names: make(map[lex.Token]string)}
+	types := make(map[string]lex.Token)
+	for i, t := range g.Tokens {
+		lx.names[lex.Token(i)] = t
+		types[t] = lex.Token(i)
+	}
+	// mode switches look up the state functions of the current lexer in fns,
+	// which init fills in. lexcat lexes one file at a time, so the machines
+	// can be shared.
+	fns := make(map[string]lex.StateFn)
+	machines := make(map[string]*dfa.Machine)
+	eof := types[g.EOF]
+	for _, m := range g.Modes {
+		rules := make([]dfa.Rule, len(m.Rules))
+		for i, ru := range m.Rules {
+			rules[i] = dfa.Rule{Pattern: ru.Pattern, Token: types[ru.Token], Skip: ru.Skip, Priority: ru.Priority}
+			if ru.Mode != "" {
+				next := ru.Mode
+				rules[i].Action = func(s *lex.State) { s.Init(fns[next]) }
+			}
+		}
+		dm, err := dfa.New(rules, eof)
+		if err != nil {
+			return nil, fmt.Errorf("%s: mode %s: %v", name, m.Name, err)
+		}
+		machines[m.Name] = dm
+	}
+	lx.init = func() lex.StateFn {
+		for n, m := range machines {
+			fns[n] = m.StateFn()
+		}
+		return fns[g.Modes[0].Name]
+	}
+	return lx, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+/*
+Command lexcat prints the tokens of a file as lexed by a given lexer. It is a
+debugging tool for lexers and lexical grammars.
+
+Usage:
+
+	lexcat [-json] (-l name | -g grammar.lex | -plugin lexer.so) [file...]
+
+The lexer is selected with one of the following flags:
+
+	-l name         use a built-in lexer. The only built-in lexer is "go", a
+	                lexer for a Go-like language built with the state package.
+	-g grammar.lex  use a lexer interpreted from a lexgen grammar file.
+	-plugin file    use a lexer loaded from a Go plugin. The plugin must export
+	                a function "NewLexer" of type func() lex.StateFn. It may
+	                also export a variable "TokenNames" of type
+	                map[lex.Token]string.
+
+Files are read from the standard input if no file is given. Tokens are printed
+one per line with their position followed by the item as formatted by
+lex.Item.Named, or as JSON objects with the -json flag (see lex.DumpJSON).
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/db47h/lex"
+)
+
+// A lexer builds initial state functions for a lexer.
+//
+type lexer struct {
+	init  func() lex.StateFn
+	names map[lex.Token]string
+}
+
+func main() {
+	var (
+		name    = flag.String("l", "", "use the built-in lexer `name`")
+		gram    = flag.String("g", "", "use a lexer interpreted from the lexgen `grammar` file")
+		plug    = flag.String("plugin", "", "use the lexer exported by the Go `plugin`")
+		jsonOut = flag.Bool("json", false, "print tokens as JSON objects")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: lexcat [-json] (-l name | -g grammar.lex | -plugin lexer.so) [file...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var (
+		lx  *lexer
+		err error
+	)
+	switch {
+	case *name != "" && *gram == "" && *plug == "":
+		lx, err = builtin(*name)
+	case *name == "" && *gram != "" && *plug == "":
+		lx, err = grammarLexer(*gram)
+	case *name == "" && *gram == "" && *plug != "":
+		lx, err = pluginLexer(*plug)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err == nil {
+		err = run(os.Stdout, lx, flag.Args(), *jsonOut)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(w io.Writer, lx *lexer, files []string, jsonOut bool) error {
+	if len(files) == 0 {
+		return cat(w, lex.NewFile("<stdin>", os.Stdin), lx, jsonOut)
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = cat(w, lex.NewFile(name, f), lx, jsonOut)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cat(w io.Writer, f *lex.File, lx *lexer, jsonOut bool) error {
+	l := lex.NewLexer(f, lx.init(), lex.TokenNames(lx.names))
+	if jsonOut {
+		return lex.DumpJSON(w, l, nil)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	for !l.AtEOF() {
+		it := l.LexItem()
+		if _, err := fmt.Fprintf(tw, "%s\t%s\n", f.Position(it.Pos), it.Named(l.TokenName(it.Type))); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
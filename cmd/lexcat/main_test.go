@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+// TestGrammarLexer uses the same grammar and input as the test of the code
+// generated by lexgen.
+//
+func TestGrammarLexer(t *testing.T) {
+	lx, err := grammarLexer("../lexgen/internal/calc/calc.lex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "if iff == 3.14 // comment\n" +
+		"αβγ=x1 \"a \\\"b\\\"\"! 2."
+	exp := []string{
+		"0 If if",
+		"3 Ident iff",
+		"7 Op ==",
+		"10 Number 3.14",
+		"26 Ident αβγ",
+		"32 Op =",
+		"33 Ident x1",
+		"36 Quote \"",
+		"37 Text a ",
+		"39 Escape \\\"",
+		"41 Text b",
+		"42 Escape \\\"",
+		"44 Quote \"",
+		"45 Error unexpected character U+0021 '!'",
+		"47 Number 2",
+		"48 Error unexpected character U+002E '.'",
+		"49 EOF <nil>",
+	}
+	l := lex.NewLexer(lex.NewFile("input", strings.NewReader(input)), lx.init())
+	for i := range exp {
+		it := l.LexItem()
+		n := lx.names[it.Type]
+		if it.Type == lex.Error {
+			n = "Error"
+		}
+		if got := fmt.Sprintf("%d %s %v", it.Pos, n, it.Value()); got != exp[i] {
+			t.Errorf("got %q, expected %q", got, exp[i])
+		}
+	}
+	if !l.AtEOF() {
+		t.Error("lexer not at EOF")
+	}
+}
+
+func TestRun(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "input.go")
+	if err := os.WriteFile(name, []byte("x := 'a' + 1.5\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	lx, err := builtin("go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err = run(&b, lx, []string{name}, false); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		":1:1  [0,1) Ident \"x\"",
+		":1:3  [2,3) Op ':'",
+		":1:4  [3,4) Op '='",
+		":1:6  [5,8) Char 'a'",
+		":1:10 [9,10) Op '+'",
+		":1:12 [11,14) Float 1.5",
+		":1:15 [14,15) SemiColon '\\n'",
+		":2:1  [15,15) EOF",
+	}
+	got := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(got) != len(exp) {
+		t.Fatalf("got:\n%s", b.String())
+	}
+	for i := range exp {
+		if g := strings.TrimPrefix(got[i], name); g != exp[i] {
+			t.Errorf("got %q, expected %q", g, exp[i])
+		}
+	}
+}
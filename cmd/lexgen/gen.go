@@ -0,0 +1,304 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/db47h/lex/dfa"
+	"github.com/db47h/lex/internal/grammar"
+)
+
+// maxInlineRanges is the maximum number of rune ranges tested inline in a
+// transition. Larger sets are tested with unicode.Is against a generated
+// RangeTable.
+//
+const maxInlineRanges = 4
+
+type generator struct {
+	bytes.Buffer
+	g      *grammar.Grammar
+	src    string
+	tables [][]dfa.Transition
+	index  map[string]int // range table index
+}
+
+// generate returns the formatted Go source for the given grammar.
+//
+func generate(g *grammar.Grammar, src string) ([]byte, error) {
+	gen := &generator{g: g, src: src, index: make(map[string]int)}
+	for _, m := range g.Modes {
+		if err := gen.mode(m); err != nil {
+			return nil, err
+		}
+	}
+	body := gen.Bytes()
+	gen.Buffer = bytes.Buffer{}
+	gen.header()
+	gen.Write(body)
+	gen.rangeTables()
+	out, err := format.Source(gen.Bytes())
+	if err != nil {
+		return gen.Bytes(), fmt.Errorf("BUG: invalid generated code: %v", err)
+	}
+	return out, nil
+}
+
+func (gen *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(gen, format, args...)
+}
+
+func (gen *generator) header() {
+	g := gen.g
+	gen.printf("// Code generated by lexgen from %s.\n", gen.src)
+	gen.printf("// The state functions below use the github.com/db47h/lex State API and can be\n")
+	gen.printf("// edited by hand.\n\n")
+	gen.printf("package %s\n\n", g.Package)
+	gen.printf("import (\n")
+	if len(gen.tables) > 0 {
+		gen.printf("\t\"unicode\"\n")
+	}
+	gen.printf("\t\"unicode/utf8\"\n\n\t\"github.com/db47h/lex\"\n)\n\n")
+	gen.printf("// Token types.\n//\nconst (\n")
+	for i, t := range g.Tokens {
+		if i == 0 {
+			gen.printf("\t%s lex.Token = iota\n", t)
+		} else {
+			gen.printf("\t%s\n", t)
+		}
+	}
+	gen.printf(")\n\n")
+	gen.printf("// lexer holds the buffers shared by the state functions of all modes.\n//\n")
+	gen.printf("type lexer struct {\n\tbuf []byte\n}\n\n")
+	gen.printf("// New returns the initial state function for the %s mode.\n", g.Modes[0].Name)
+	gen.printf("// The returned state function is not safe for concurrent use.\n//\n")
+	gen.printf("func New() lex.StateFn {\n\tl := &lexer{buf: make([]byte, 0, 64)}\n\treturn l.mode%s\n}\n\n", g.Modes[0].Name)
+}
+
+func (gen *generator) mode(m *grammar.Mode) error {
+	rules := make([]dfa.Rule, len(m.Rules))
+	for i, ru := range m.Rules {
+		rules[i] = dfa.Rule{Pattern: ru.Pattern, Priority: ru.Priority}
+	}
+	d, err := dfa.CompileRules(rules)
+	if err != nil {
+		return fmt.Errorf("%s: mode %s: %v", gen.src, m.Name, err)
+	}
+
+	// the match length is only needed if some rule emits a token
+	emits := false
+	for _, ru := range m.Rules {
+		emits = emits || !ru.Skip
+	}
+
+	gen.printf("// mode%s lexes a single token in mode %s.\n//\n", m.Name, m.Name)
+	gen.printf("func (l *lexer) mode%s(s *lex.State) lex.StateFn {\n", m.Name)
+	gen.printf(`	r := s.Next()
+	if r == lex.EOF {
+		s.Emit(s.Pos(), %s, nil)
+		return nil
+	}
+	s.StartToken(s.Pos())
+	var (
+		rule = -1 // last matched rule
+		n    = 0  // number of runes read since the last match
+`, gen.g.EOF)
+	if emits {
+		gen.printf("\t\tm = 0 // length in bytes of the last match\n")
+	}
+	gen.printf(`	)
+	l.buf = l.buf[:0]
+	for st := 0; ; {
+		switch st {
+`)
+	for i, st := range d.States {
+		gen.printf("\t\tcase %d:", i)
+		if st.Accept >= 0 {
+			gen.printf(" // %s\n", ruleComment(m.Rules[st.Accept]))
+			if emits {
+				gen.printf("\t\t\trule, m, n = %d, len(l.buf), 0\n", st.Accept)
+			} else {
+				gen.printf("\t\t\trule, n = %d, 0\n", st.Accept)
+			}
+		} else {
+			gen.printf("\n")
+		}
+		if len(st.Trans) == 0 {
+			gen.printf("\t\t\tgoto done\n")
+			continue
+		}
+		gen.printf("\t\t\tswitch {\n")
+		for _, grp := range groupTransitions(st.Trans) {
+			gen.printf("\t\t\tcase %s:\n\t\t\t\tst = %d\n", gen.condition(grp), grp[0].Next)
+		}
+		gen.printf("\t\t\tdefault:\n\t\t\t\tgoto done\n\t\t\t}\n")
+	}
+	gen.printf(`		}
+		l.buf = appendRune(l.buf, r)
+		n++
+		r = s.Next()
+	}
+done:
+	// back up to the end of the longest match. If there is no match, the first
+	// rune is consumed and reported as an error.
+	if rule >= 0 {
+		n++
+	}
+	if n >= lex.BackupBufferSize {
+		s.Errorf(s.TokenPos(), "token too long: cannot backtrack %%d runes", n)
+		return nil
+	}
+	for ; n > 0; n-- {
+		s.Backup()
+	}
+	switch rule {
+`)
+	for i, ru := range m.Rules {
+		gen.printf("\tcase %d: // %s\n", i, ruleComment(ru))
+		if !ru.Skip {
+			gen.printf("\t\ts.EmitString(s.TokenPos(), %s, string(l.buf[:m]))\n", ru.Token)
+		}
+		if ru.Mode != "" {
+			gen.printf("\t\ts.Init(l.mode%s)\n", ru.Mode)
+		}
+	}
+	gen.printf(`	default:
+		s.Errorf(s.TokenPos(), "unexpected character %%#U", s.Current())
+	}
+	return nil
+}
+
+`)
+	return nil
+}
+
+// groupTransitions groups transitions by target state.
+//
+func groupTransitions(ts []dfa.Transition) [][]dfa.Transition {
+	var grps [][]dfa.Transition
+	idx := make(map[int]int)
+	for _, t := range ts {
+		i, ok := idx[t.Next]
+		if !ok {
+			i = len(grps)
+			idx[t.Next] = i
+			grps = append(grps, nil)
+		}
+		grps[i] = append(grps[i], t)
+	}
+	return grps
+}
+
+func (gen *generator) condition(ts []dfa.Transition) string {
+	if len(ts) > maxInlineRanges {
+		key := fmt.Sprint(ts)
+		i, ok := gen.index[key]
+		if !ok {
+			i = len(gen.tables)
+			gen.index[key] = i
+			gen.tables = append(gen.tables, ts)
+		}
+		return fmt.Sprintf("unicode.Is(table%d, r)", i)
+	}
+	conds := make([]string, 0, len(ts))
+	for _, t := range ts {
+		if t.Lo == t.Hi {
+			conds = append(conds, "r == "+runeLit(t.Lo))
+		} else {
+			conds = append(conds, "r >= "+runeLit(t.Lo)+" && r <= "+runeLit(t.Hi))
+		}
+	}
+	return strings.Join(conds, ",\n\t\t\t\t")
+}
+
+func (gen *generator) rangeTables() {
+	gen.printf(`func appendRune(b []byte, r rune) []byte {
+	if r < utf8.RuneSelf {
+		return append(b, byte(r))
+	}
+	var rb [utf8.UTFMax]byte
+	return append(b, rb[:utf8.EncodeRune(rb[:], r)]...)
+}
+`)
+	for i, ts := range gen.tables {
+		var r16, r32 []string
+		latin := 0
+		for _, t := range ts {
+			lo, hi := t.Lo, t.Hi
+			if lo <= 0xffff {
+				h := hi
+				if h > 0xffff {
+					h = 0xffff
+				}
+				r16 = append(r16, fmt.Sprintf("{%#04x, %#04x, 1},", lo, h))
+				if h <= unicode.MaxLatin1 {
+					latin++
+				}
+				lo = h + 1
+			}
+			if lo <= hi {
+				r32 = append(r32, fmt.Sprintf("{%#x, %#x, 1},", lo, hi))
+			}
+		}
+		gen.printf("\nvar table%d = &unicode.RangeTable{\n", i)
+		if len(r16) > 0 {
+			gen.printf("\tR16: []unicode.Range16{\n\t\t%s\n\t},\n", strings.Join(r16, "\n\t\t"))
+		}
+		if len(r32) > 0 {
+			gen.printf("\tR32: []unicode.Range32{\n\t\t%s\n\t},\n", strings.Join(r32, "\n\t\t"))
+		}
+		if latin > 0 {
+			gen.printf("\tLatinOffset: %d,\n", latin)
+		}
+		gen.printf("}\n")
+	}
+}
+
+func ruleComment(ru grammar.Rule) string {
+	var b strings.Builder
+	b.WriteString(ru.Token)
+	b.WriteString(" `")
+	b.WriteString(ru.Pattern)
+	b.WriteByte('`')
+	if ru.Skip {
+		b.WriteString(" skip")
+	}
+	if ru.Priority != 0 {
+		b.WriteString(" prio ")
+		b.WriteString(strconv.Itoa(ru.Priority))
+	}
+	if ru.Mode != "" {
+		b.WriteString(" -> ")
+		b.WriteString(ru.Mode)
+	}
+	return b.String()
+}
+
+func runeLit(r rune) string {
+	if r < 0x10000 && (unicode.IsPrint(r) || r == '\t' || r == '\n' || r == '\r') {
+		return strconv.QuoteRune(r)
+	}
+	return fmt.Sprintf("%#x", r)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex/internal/grammar"
+)
+
+// TestGenerate checks that the generated sample lexer is up to date.
+//
+func TestGenerate(t *testing.T) {
+	f, err := os.Open("internal/calc/calc.lex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := grammar.Parse("calc.lex", f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := generate(g, "calc.lex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := ioutil.ReadFile("internal/calc/calc.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(code, exp) {
+		t.Fatal("internal/calc/calc.go is out of date. Run go generate ./...")
+	}
+}
+
+func TestGenerate_skipOnly(t *testing.T) {
+	g, err := grammar.Parse("skip", strings.NewReader("package skip\n_ `[ ]+` skip\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := generate(g, "skip")
+	if err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+	if bytes.Contains(code, []byte("rule, m, n")) {
+		t.Fatal("unused match length in generated code")
+	}
+}
@@ -0,0 +1,410 @@
+// Code generated by lexgen from calc.lex.
+// The state functions below use the github.com/db47h/lex State API and can be
+// edited by hand.
+
+package calc
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+// Token types.
+const (
+	EOF lex.Token = iota
+	Number
+	Ident
+	If
+	Op
+	Quote
+	Text
+	Escape
+)
+
+// lexer holds the buffers shared by the state functions of all modes.
+type lexer struct {
+	buf []byte
+}
+
+// New returns the initial state function for the Default mode.
+// The returned state function is not safe for concurrent use.
+func New() lex.StateFn {
+	l := &lexer{buf: make([]byte, 0, 64)}
+	return l.modeDefault
+}
+
+// modeDefault lexes a single token in mode Default.
+func (l *lexer) modeDefault(s *lex.State) lex.StateFn {
+	r := s.Next()
+	if r == lex.EOF {
+		s.Emit(s.Pos(), EOF, nil)
+		return nil
+	}
+	s.StartToken(s.Pos())
+	var (
+		rule = -1 // last matched rule
+		n    = 0  // number of runes read since the last match
+		m    = 0  // length in bytes of the last match
+	)
+	l.buf = l.buf[:0]
+	for st := 0; ; {
+		switch st {
+		case 0:
+			switch {
+			case r >= '\t' && r <= '\n',
+				r == ' ':
+				st = 1
+			case r == '!':
+				st = 2
+			case r == '"':
+				st = 3
+			case r >= '*' && r <= '+',
+				r == '-':
+				st = 4
+			case r == '/':
+				st = 5
+			case r >= '0' && r <= '9':
+				st = 6
+			case r == '=':
+				st = 7
+			case r >= 'A' && r <= 'Z',
+				r == '_',
+				r >= 'a' && r <= 'h',
+				r >= 'j' && r <= 'z':
+				st = 8
+			case r == 'i':
+				st = 9
+			case unicode.Is(table0, r):
+				st = 10
+			default:
+				goto done
+			}
+		case 1: // _ `[ \t\n]+` skip
+			rule, m, n = 4, len(l.buf), 0
+			switch {
+			case r >= '\t' && r <= '\n',
+				r == ' ':
+				st = 1
+			default:
+				goto done
+			}
+		case 2:
+			switch {
+			case r == '=':
+				st = 11
+			default:
+				goto done
+			}
+		case 3: // Quote `"` -> String
+			rule, m, n = 6, len(l.buf), 0
+			goto done
+		case 4: // Op `[-+*/=]|==|!=`
+			rule, m, n = 3, len(l.buf), 0
+			goto done
+		case 5: // Op `[-+*/=]|==|!=`
+			rule, m, n = 3, len(l.buf), 0
+			switch {
+			case r == '/':
+				st = 12
+			default:
+				goto done
+			}
+		case 6: // Number `[0-9]+(\.[0-9]+)?`
+			rule, m, n = 0, len(l.buf), 0
+			switch {
+			case r == '.':
+				st = 13
+			case r >= '0' && r <= '9':
+				st = 6
+			default:
+				goto done
+			}
+		case 7: // Op `[-+*/=]|==|!=`
+			rule, m, n = 3, len(l.buf), 0
+			switch {
+			case r == '=':
+				st = 14
+			default:
+				goto done
+			}
+		case 8: // Ident `[A-Za-z_][A-Za-z0-9_]*|\p{Greek}+`
+			rule, m, n = 1, len(l.buf), 0
+			switch {
+			case r >= '0' && r <= '9',
+				r >= 'A' && r <= 'Z',
+				r == '_',
+				r >= 'a' && r <= 'z':
+				st = 15
+			default:
+				goto done
+			}
+		case 9: // Ident `[A-Za-z_][A-Za-z0-9_]*|\p{Greek}+`
+			rule, m, n = 1, len(l.buf), 0
+			switch {
+			case unicode.Is(table1, r):
+				st = 15
+			case r == 'f':
+				st = 16
+			default:
+				goto done
+			}
+		case 10: // Ident `[A-Za-z_][A-Za-z0-9_]*|\p{Greek}+`
+			rule, m, n = 1, len(l.buf), 0
+			switch {
+			case unicode.Is(table0, r):
+				st = 10
+			default:
+				goto done
+			}
+		case 11: // Op `[-+*/=]|==|!=`
+			rule, m, n = 3, len(l.buf), 0
+			goto done
+		case 12: // _ `//[^\n]*` skip
+			rule, m, n = 5, len(l.buf), 0
+			switch {
+			case r >= 0x0 && r <= '\t',
+				r >= 0xb && r <= 0xd7ff,
+				r >= 0xe000 && r <= 0x10ffff:
+				st = 17
+			default:
+				goto done
+			}
+		case 13:
+			switch {
+			case r >= '0' && r <= '9':
+				st = 18
+			default:
+				goto done
+			}
+		case 14: // Op `[-+*/=]|==|!=`
+			rule, m, n = 3, len(l.buf), 0
+			goto done
+		case 15: // Ident `[A-Za-z_][A-Za-z0-9_]*|\p{Greek}+`
+			rule, m, n = 1, len(l.buf), 0
+			switch {
+			case r >= '0' && r <= '9',
+				r >= 'A' && r <= 'Z',
+				r == '_',
+				r >= 'a' && r <= 'z':
+				st = 15
+			default:
+				goto done
+			}
+		case 16: // If `if` prio 1
+			rule, m, n = 2, len(l.buf), 0
+			switch {
+			case r >= '0' && r <= '9',
+				r >= 'A' && r <= 'Z',
+				r == '_',
+				r >= 'a' && r <= 'z':
+				st = 15
+			default:
+				goto done
+			}
+		case 17: // _ `//[^\n]*` skip
+			rule, m, n = 5, len(l.buf), 0
+			switch {
+			case r >= 0x0 && r <= '\t',
+				r >= 0xb && r <= 0xd7ff,
+				r >= 0xe000 && r <= 0x10ffff:
+				st = 17
+			default:
+				goto done
+			}
+		case 18: // Number `[0-9]+(\.[0-9]+)?`
+			rule, m, n = 0, len(l.buf), 0
+			switch {
+			case r >= '0' && r <= '9':
+				st = 18
+			default:
+				goto done
+			}
+		}
+		l.buf = appendRune(l.buf, r)
+		n++
+		r = s.Next()
+	}
+done:
+	// back up to the end of the longest match. If there is no match, the first
+	// rune is consumed and reported as an error.
+	if rule >= 0 {
+		n++
+	}
+	if n >= lex.BackupBufferSize {
+		s.Errorf(s.TokenPos(), "token too long: cannot backtrack %d runes", n)
+		return nil
+	}
+	for ; n > 0; n-- {
+		s.Backup()
+	}
+	switch rule {
+	case 0: // Number `[0-9]+(\.[0-9]+)?`
+		s.EmitString(s.TokenPos(), Number, string(l.buf[:m]))
+	case 1: // Ident `[A-Za-z_][A-Za-z0-9_]*|\p{Greek}+`
+		s.EmitString(s.TokenPos(), Ident, string(l.buf[:m]))
+	case 2: // If `if` prio 1
+		s.EmitString(s.TokenPos(), If, string(l.buf[:m]))
+	case 3: // Op `[-+*/=]|==|!=`
+		s.EmitString(s.TokenPos(), Op, string(l.buf[:m]))
+	case 4: // _ `[ \t\n]+` skip
+	case 5: // _ `//[^\n]*` skip
+	case 6: // Quote `"` -> String
+		s.EmitString(s.TokenPos(), Quote, string(l.buf[:m]))
+		s.Init(l.modeString)
+	default:
+		s.Errorf(s.TokenPos(), "unexpected character %#U", s.Current())
+	}
+	return nil
+}
+
+// modeString lexes a single token in mode String.
+func (l *lexer) modeString(s *lex.State) lex.StateFn {
+	r := s.Next()
+	if r == lex.EOF {
+		s.Emit(s.Pos(), EOF, nil)
+		return nil
+	}
+	s.StartToken(s.Pos())
+	var (
+		rule = -1 // last matched rule
+		n    = 0  // number of runes read since the last match
+		m    = 0  // length in bytes of the last match
+	)
+	l.buf = l.buf[:0]
+	for st := 0; ; {
+		switch st {
+		case 0:
+			switch {
+			case r >= 0x0 && r <= '!',
+				r >= '#' && r <= '[',
+				r >= ']' && r <= 0xd7ff,
+				r >= 0xe000 && r <= 0x10ffff:
+				st = 1
+			case r == '"':
+				st = 2
+			case r == '\\':
+				st = 3
+			default:
+				goto done
+			}
+		case 1: // Text `[^"\\]+`
+			rule, m, n = 0, len(l.buf), 0
+			switch {
+			case r >= 0x0 && r <= '!',
+				r >= '#' && r <= '[',
+				r >= ']' && r <= 0xd7ff,
+				r >= 0xe000 && r <= 0x10ffff:
+				st = 1
+			default:
+				goto done
+			}
+		case 2: // Quote `"` -> Default
+			rule, m, n = 2, len(l.buf), 0
+			goto done
+		case 3:
+			switch {
+			case r >= 0x0 && r <= '\t',
+				r >= 0xb && r <= 0xd7ff,
+				r >= 0xe000 && r <= 0x10ffff:
+				st = 4
+			default:
+				goto done
+			}
+		case 4: // Escape `\\.`
+			rule, m, n = 1, len(l.buf), 0
+			goto done
+		}
+		l.buf = appendRune(l.buf, r)
+		n++
+		r = s.Next()
+	}
+done:
+	// back up to the end of the longest match. If there is no match, the first
+	// rune is consumed and reported as an error.
+	if rule >= 0 {
+		n++
+	}
+	if n >= lex.BackupBufferSize {
+		s.Errorf(s.TokenPos(), "token too long: cannot backtrack %d runes", n)
+		return nil
+	}
+	for ; n > 0; n-- {
+		s.Backup()
+	}
+	switch rule {
+	case 0: // Text `[^"\\]+`
+		s.EmitString(s.TokenPos(), Text, string(l.buf[:m]))
+	case 1: // Escape `\\.`
+		s.EmitString(s.TokenPos(), Escape, string(l.buf[:m]))
+	case 2: // Quote `"` -> Default
+		s.EmitString(s.TokenPos(), Quote, string(l.buf[:m]))
+		s.Init(l.modeDefault)
+	default:
+		s.Errorf(s.TokenPos(), "unexpected character %#U", s.Current())
+	}
+	return nil
+}
+
+func appendRune(b []byte, r rune) []byte {
+	if r < utf8.RuneSelf {
+		return append(b, byte(r))
+	}
+	var rb [utf8.UTFMax]byte
+	return append(b, rb[:utf8.EncodeRune(rb[:], r)]...)
+}
+
+var table0 = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x0370, 0x0373, 1},
+		{0x0375, 0x0377, 1},
+		{0x037a, 0x037d, 1},
+		{0x037f, 0x037f, 1},
+		{0x0384, 0x0384, 1},
+		{0x0386, 0x0386, 1},
+		{0x0388, 0x038a, 1},
+		{0x038c, 0x038c, 1},
+		{0x038e, 0x03a1, 1},
+		{0x03a3, 0x03e1, 1},
+		{0x03f0, 0x03ff, 1},
+		{0x1d26, 0x1d2a, 1},
+		{0x1d5d, 0x1d61, 1},
+		{0x1d66, 0x1d6a, 1},
+		{0x1dbf, 0x1dbf, 1},
+		{0x1f00, 0x1f15, 1},
+		{0x1f18, 0x1f1d, 1},
+		{0x1f20, 0x1f45, 1},
+		{0x1f48, 0x1f4d, 1},
+		{0x1f50, 0x1f57, 1},
+		{0x1f59, 0x1f59, 1},
+		{0x1f5b, 0x1f5b, 1},
+		{0x1f5d, 0x1f5d, 1},
+		{0x1f5f, 0x1f7d, 1},
+		{0x1f80, 0x1fb4, 1},
+		{0x1fb6, 0x1fc4, 1},
+		{0x1fc6, 0x1fd3, 1},
+		{0x1fd6, 0x1fdb, 1},
+		{0x1fdd, 0x1fef, 1},
+		{0x1ff2, 0x1ff4, 1},
+		{0x1ff6, 0x1ffe, 1},
+		{0x2126, 0x2126, 1},
+		{0xab65, 0xab65, 1},
+	},
+	R32: []unicode.Range32{
+		{0x10140, 0x1018e, 1},
+		{0x101a0, 0x101a0, 1},
+		{0x1d200, 0x1d245, 1},
+	},
+}
+
+var table1 = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x0030, 0x0039, 1},
+		{0x0041, 0x005a, 1},
+		{0x005f, 0x005f, 1},
+		{0x0061, 0x0065, 1},
+		{0x0067, 0x007a, 1},
+	},
+	LatinOffset: 5,
+}
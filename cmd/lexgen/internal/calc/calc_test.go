@@ -0,0 +1,53 @@
+package calc_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+	"github.com/db47h/lex/cmd/lexgen/internal/calc"
+)
+
+var tokNames = map[lex.Token]string{
+	calc.EOF:    "EOF",
+	calc.Number: "Number",
+	calc.If:     "If",
+	calc.Ident:  "Ident",
+	calc.Op:     "Op",
+	calc.Quote:  "Quote",
+	calc.Text:   "Text",
+	calc.Escape: "Escape",
+}
+
+func TestGenerated(t *testing.T) {
+	input := "if iff == 3.14 // comment\n" +
+		"αβγ=x1 \"a \\\"b\\\"\"! 2."
+	exp := []string{
+		"0 If if",
+		"3 Ident iff",
+		"7 Op ==",
+		"10 Number 3.14",
+		"26 Ident αβγ",
+		"32 Op =",
+		"33 Ident x1",
+		"36 Quote \"",
+		"37 Text a ",
+		"39 Escape \\\"",
+		"41 Text b",
+		"42 Escape \\\"",
+		"44 Quote \"",
+		"45 Error unexpected character U+0021 '!'",
+		"47 Number 2",
+		"48 Error unexpected character U+002E '.'",
+		"49 EOF <nil>",
+	}
+	l := lex.NewLexer(lex.NewFile("input", strings.NewReader(input)), calc.New(), lex.TokenNames(tokNames))
+	for i := range exp {
+		tt, p, v := l.Lex()
+		got := fmt.Sprintf("%d %s %v", p, l.TokenName(tt), v)
+		if got != exp[i] {
+			t.Errorf("got %q, expected %q", got, exp[i])
+		}
+	}
+}
@@ -0,0 +1,6 @@
+// Package calc is a sample lexer generated by lexgen. It is used to check that
+// the generated code compiles and behaves as expected.
+//
+package calc
+
+//go:generate go run github.com/db47h/lex/cmd/lexgen calc.lex
@@ -0,0 +1,107 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+/*
+Command lexgen generates lexers from a lexical grammar.
+
+Usage:
+
+	lexgen [-o output.go] grammar.lex
+
+The grammar file lists token rules, one per line, grouped in modes:
+
+	package calc
+
+	Number  `[0-9]+`
+	Ident   `[A-Za-z_][A-Za-z0-9_]*`
+	Op      `[-+*=]`
+	_       `[ \t\n]+`          skip
+	Quote   `"`                 -> String
+
+	mode String
+	Text    `[^"\\]+`
+	Escape  `\\.`
+	Quote   `"`                 -> Default
+
+Each rule is a token name, a regular expression enclosed in back quotes and
+optional actions: skip discards the matched text, "prio N" sets the priority of
+the rule to the integer N and "-> Mode" switches to another mode once the token
+has been emitted. Rules that appear before the
+first mode directive belong to the mode "Default". An "eof" directive sets the
+name of the EOF token (EOF by default).
+
+The generated code defines one lex.Token constant per token name and a New
+function returning the initial state function. Each mode is implemented as a
+single state function built around a switch on DFA states. The longest match
+wins; in case of a tie, the rule with the highest priority wins, then the rule
+that comes first. Matches are emitted
+with the matched text as a string value.
+
+The generated code is meant to be readable and can be used as a starting point
+for a hand-written lexer.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/db47h/lex/internal/grammar"
+)
+
+func main() {
+	out := flag.String("o", "", "output file name (defaults to the grammar file name with a .go extension)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: lexgen [-o output.go] grammar.lex\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), *out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(src, out string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	g, err := grammar.Parse(src, f)
+	if err != nil {
+		return err
+	}
+	code, err := generate(g, filepath.Base(src))
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		out = strings.TrimSuffix(src, filepath.Ext(src)) + ".go"
+	}
+	return ioutil.WriteFile(out, code, 0666)
+}
@@ -0,0 +1,121 @@
+package dfa_test
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/db47h/lex"
+	"github.com/db47h/lex/dfa"
+)
+
+var benchInput = strings.Repeat("if foo_bar1 >= 42 && x != 3.1415e-3 || y == z\n\tfoo = bar + 1234 * baz\n", 1000)
+
+// stateFnInit is a hand-written lexer for the same language as rules.
+//
+func stateFnInit() lex.StateFn {
+	buf := make([]rune, 0, 64)
+	ident := func(s *lex.State) lex.StateFn {
+		buf = append(buf[:0], s.Current())
+		for r := s.Next(); unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'; r = s.Next() {
+			buf = append(buf, r)
+		}
+		s.Backup()
+		if str := string(buf); str == "if" {
+			s.Emit(s.TokenPos(), tokIf, str)
+		} else {
+			s.Emit(s.TokenPos(), tokIdent, str)
+		}
+		return nil
+	}
+	digits := func(s *lex.State) {
+		for r := s.Current(); r >= '0' && r <= '9'; r = s.Next() {
+			buf = append(buf, r)
+		}
+	}
+	number := func(s *lex.State) lex.StateFn {
+		buf = buf[:0]
+		digits(s)
+		if s.Current() == '.' {
+			if r := s.Peek(); r >= '0' && r <= '9' {
+				buf = append(buf, '.')
+				s.Next()
+				digits(s)
+			}
+		}
+		if r := s.Current(); r == 'e' || r == 'E' {
+			buf = append(buf, r)
+			if r = s.Next(); r == '-' || r == '+' {
+				buf = append(buf, r)
+				s.Next()
+			}
+			digits(s)
+		}
+		s.Backup()
+		s.Emit(s.TokenPos(), tokNumber, string(buf))
+		return nil
+	}
+	return func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		s.StartToken(s.Pos())
+		switch r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case ' ', '\t', '\n':
+			for r = s.Next(); r == ' ' || r == '\t' || r == '\n'; r = s.Next() {
+			}
+			s.Backup()
+		case '-', '+', '*', '/', '=', '<', '>', '!':
+			if s.Next() == '=' {
+				s.Emit(s.TokenPos(), tokOp, string([]rune{r, '='}))
+				return nil
+			}
+			s.Backup()
+			s.Emit(s.TokenPos(), tokOp, string(r))
+		case '&', '|':
+			if s.Next() == r {
+				s.Emit(s.TokenPos(), tokOp, string([]rune{r, r}))
+				return nil
+			}
+			s.Backup()
+			s.Errorf(s.Pos(), "unexpected character %#U", r)
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			return number
+		default:
+			if unicode.IsLetter(r) || r == '_' {
+				return ident
+			}
+			s.Errorf(s.Pos(), "unexpected character %#U", r)
+		}
+		return nil
+	}
+}
+
+func benchmarkLexer(b *testing.B, init func() lex.StateFn) {
+	b.SetBytes(int64(len(benchInput)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := lex.NewLexer(lex.NewFile("bench", strings.NewReader(benchInput)), init())
+		for {
+			t, _, _ := l.Lex()
+			if t == tokEOF {
+				break
+			}
+			if t == lex.Error {
+				b.Fatal("unexpected error token")
+			}
+		}
+	}
+}
+
+func BenchmarkMachine(b *testing.B) {
+	m, err := dfa.New(rules, tokEOF)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkLexer(b, m.StateFn)
+}
+
+func BenchmarkStateFn(b *testing.B) {
+	benchmarkLexer(b, stateFnInit)
+}
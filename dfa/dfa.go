@@ -0,0 +1,219 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package dfa compiles sets of regular expressions into a deterministic finite
+// automaton suitable for lexing.
+//
+// Patterns use the RE2 syntax of the regexp package. Since the automaton
+// matches runes as returned by lex.State.Next, empty-width assertions like ^, $
+// or \b are not supported.
+//
+// When several patterns match the same input, the longest match wins. If two
+// patterns match the same number of runes, the one with the highest Priority
+// wins (see Rule). If they have the same priority, the pattern that comes first
+// in the pattern list wins.
+//
+// A Machine is a table driven execution engine for a minimized DFA. It lexes
+// a token in a single loop instead of a chain of state function calls and can
+// be used as the initial state function of a lex.Lexer. Machines for large
+// rule sets can be built once, encoded with MarshalBinary and embedded in a
+// program to be loaded at startup with UnmarshalBinary.
+//
+package dfa
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrEmptyMatch is returned by Compile if a pattern matches the empty string.
+//
+var ErrEmptyMatch = errors.New("pattern matches the empty string")
+
+// A DFA is a deterministic finite automaton. The start state is States[0].
+//
+type DFA struct {
+	States []State
+}
+
+// A State is a DFA state.
+//
+type State struct {
+	Trans  []Transition // transitions, sorted by rune range
+	Accept int          // index of the pattern accepted in this state or -1
+}
+
+// A Transition from one DFA state to the state Next, taken on any rune in the
+// range [Lo, Hi].
+//
+type Transition struct {
+	Lo, Hi rune
+	Next   int
+}
+
+// Compile compiles the given patterns into a DFA. The Accept field of
+// accepting states is set to the index of the matched pattern in patterns.
+//
+func Compile(patterns []string) (*DFA, error) {
+	rules := make([]Rule, len(patterns))
+	for i, p := range patterns {
+		rules[i].Pattern = p
+	}
+	return CompileRules(rules)
+}
+
+// errRule is returned by CompileRules for rules that have both a pattern and range
+// tables or neither.
+//
+var errRule = errors.New("rule must have either a pattern or start range tables")
+
+// CompileRules compiles the given rules into a DFA. The Accept field of
+// accepting states is set to the index of the matched rule in rules. Since the
+// DFA does not produce tokens, the Token, Skip and Keywords fields of the
+// rules are ignored.
+//
+func CompileRules(rules []Rule) (*DFA, error) {
+	n := &nfa{prio: make([]int, len(rules))}
+	start := n.newState()
+	for i := range rules {
+		ru := &rules[i]
+		n.prio[i] = ru.Priority
+		var err error
+		switch {
+		case ru.Pattern != "" && len(ru.Start) == 0 && len(ru.Continue) == 0:
+			err = n.add(start, ru.Pattern, i)
+		case ru.Pattern == "" && len(ru.Start) > 0:
+			n.addClass(start, tableRanges(ru.Start), tableRanges(ru.Continue), i)
+		default:
+			err = fmt.Errorf("rule %d: %w", i, errRule)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	d := n.dfa()
+	if a := d.States[0].Accept; a >= 0 {
+		return nil, fmt.Errorf("rule %d: %w", a, ErrEmptyMatch)
+	}
+	return d, nil
+}
+
+// Next returns the state reached from state s on rune r or -1 if there is no
+// such transition.
+//
+func (d *DFA) Next(s int, r rune) int {
+	t := d.States[s].Trans
+	i := sort.Search(len(t), func(i int) bool { return t[i].Hi >= r })
+	if i < len(t) && t[i].Lo <= r {
+		return t[i].Next
+	}
+	return -1
+}
+
+// dfa performs the subset construction.
+//
+func (n *nfa) dfa() *DFA {
+	var (
+		d     = new(DFA)
+		index = make(map[string]int)
+		sets  [][]int
+	)
+	add := func(set map[int]bool) int {
+		ss := make([]int, 0, len(set))
+		for s := range set {
+			ss = append(ss, s)
+		}
+		sort.Ints(ss)
+		key := setKey(ss)
+		if i, ok := index[key]; ok {
+			return i
+		}
+		i := len(d.States)
+		index[key] = i
+		sets = append(sets, ss)
+		acc := -1
+		for _, s := range ss {
+			if a := n.states[s].accept; a >= 0 && (acc < 0 || n.prefer(a, acc)) {
+				acc = a
+			}
+		}
+		d.States = append(d.States, State{Accept: acc})
+		return i
+	}
+
+	set := make(map[int]bool)
+	n.closure(set, 0)
+	add(set)
+
+	for i := 0; i < len(sets); i++ {
+		// split transitions from all NFA states into disjoint intervals
+		var pts []rune
+		for _, s := range sets[i] {
+			rs := n.states[s].ranges
+			for j := 0; j < len(rs); j += 2 {
+				pts = append(pts, rs[j], rs[j+1]+1)
+			}
+		}
+		if len(pts) == 0 {
+			continue
+		}
+		sort.Slice(pts, func(i, j int) bool { return pts[i] < pts[j] })
+		var trans []Transition
+		for j := 0; j < len(pts)-1; j++ {
+			lo, hi := pts[j], pts[j+1]-1
+			if lo > hi {
+				continue
+			}
+			set := make(map[int]bool)
+			for _, s := range sets[i] {
+				st := &n.states[s]
+				rs := st.ranges
+				for k := 0; k < len(rs); k += 2 {
+					if rs[k] <= lo && rs[k+1] >= hi {
+						n.closure(set, st.next)
+						break
+					}
+				}
+			}
+			if len(set) == 0 {
+				continue
+			}
+			next := add(set)
+			if l := len(trans); l > 0 && trans[l-1].Next == next && trans[l-1].Hi+1 == lo {
+				trans[l-1].Hi = hi
+				continue
+			}
+			trans = append(trans, Transition{lo, hi, next})
+		}
+		d.States[i].Trans = trans
+	}
+	return d
+}
+
+func setKey(ss []int) string {
+	var b strings.Builder
+	for _, s := range ss {
+		b.WriteString(strconv.Itoa(s))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
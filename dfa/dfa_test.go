@@ -0,0 +1,100 @@
+package dfa_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/db47h/lex/dfa"
+)
+
+// match returns the index of the pattern matching the longest prefix of s and
+// the length in runes of the match.
+//
+func match(d *dfa.DFA, s string) (int, int) {
+	acc, n, st := -1, 0, 0
+	i := 0
+	for _, r := range s {
+		if st = d.Next(st, r); st < 0 {
+			break
+		}
+		i++
+		if a := d.States[st].Accept; a >= 0 {
+			acc, n = a, i
+		}
+	}
+	return acc, n
+}
+
+func TestCompile(t *testing.T) {
+	d, err := dfa.Compile([]string{
+		`if`,
+		`[a-z]+`,
+		`[0-9]+(\.[0-9]*)?`,
+		`(?i)select`,
+		`.`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := []struct {
+		in  string
+		acc int
+		n   int
+	}{
+		{"if", 0, 2},
+		{"iff", 1, 3},
+		{"i", 1, 1},
+		{"12.5x", 2, 4},
+		{"12.", 2, 3},
+		{"SeLeCt", 3, 6},
+		{"SeLeCtx", 3, 6},
+		{"\n", -1, 0},
+		{"é", 4, 1},
+	}
+	for _, d2 := range td {
+		acc, n := match(d, d2.in)
+		if acc != d2.acc || n != d2.n {
+			t.Errorf("%q: got match %d/%d, expected %d/%d", d2.in, acc, n, d2.acc, d2.n)
+		}
+	}
+}
+
+func TestCompileRules_priority(t *testing.T) {
+	d, err := dfa.CompileRules([]dfa.Rule{
+		{Pattern: `[a-z]+`},
+		{Pattern: `if`, Priority: 1},
+		{Pattern: `else`},
+		{Pattern: `[a-z]+`, Priority: -1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := []struct {
+		in  string
+		acc int
+		n   int
+	}{
+		{"if", 1, 2},   // higher priority
+		{"iffy", 0, 4}, // longest match
+		{"else", 0, 4}, // same priority, first rule
+		{"x", 0, 1},
+	}
+	for _, d2 := range td {
+		acc, n := match(d, d2.in)
+		if acc != d2.acc || n != d2.n {
+			t.Errorf("%q: got match %d/%d, expected %d/%d", d2.in, acc, n, d2.acc, d2.n)
+		}
+	}
+}
+
+func TestCompile_errors(t *testing.T) {
+	if _, err := dfa.Compile([]string{`a`, `b*`}); !errors.Is(err, dfa.ErrEmptyMatch) {
+		t.Errorf("got error %v, expected %v", err, dfa.ErrEmptyMatch)
+	}
+	if _, err := dfa.Compile([]string{`^a`}); err == nil {
+		t.Error("expected error for unsupported empty-width assertion")
+	}
+	if _, err := dfa.Compile([]string{`a(`}); err == nil {
+		t.Error("expected parse error")
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package dfa
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+// encoding header and version
+//
+const (
+	magic   = "lexdfa"
+	version = 1
+)
+
+// ErrFormat is returned by UnmarshalBinary if the data is not a valid Machine
+// encoding.
+//
+var ErrFormat = errors.New("invalid machine encoding")
+
+// MarshalBinary implements encoding.BinaryMarshaler. It encodes the transition
+// tables of the machine along with the token type, skip flag, pattern,
+// priority and keywords of each rule. Range tables are not encoded: they are
+// already compiled into the transition tables. Actions cannot be encoded
+// either; set them on the decoded machine with SetAction.
+//
+// The encoded machine can be embedded in a program and loaded with
+// UnmarshalBinary, which is much faster than building the machine from its
+// rules:
+//
+//	var m dfa.Machine
+//	if err := m.UnmarshalBinary(data); err != nil {
+//		// handle error
+//	}
+//	l := lex.NewLexer(f, m.StateFn())
+//
+func (m *Machine) MarshalBinary() ([]byte, error) {
+	e := encoder(append([]byte(magic), version))
+	e.int(int(m.eof))
+	e.int(len(m.rules))
+	for i := range m.rules {
+		ru := &m.rules[i]
+		e.string(ru.Pattern)
+		e.int(int(ru.Token))
+		e.bool(ru.Skip)
+		e.int(ru.Priority)
+		kws := make([]string, 0, len(ru.Keywords))
+		for kw := range ru.Keywords {
+			kws = append(kws, kw)
+		}
+		sort.Strings(kws)
+		e.int(len(kws))
+		for _, kw := range kws {
+			e.string(kw)
+			e.int(int(ru.Keywords[kw]))
+		}
+	}
+	for _, c := range m.ascii {
+		e.int(c)
+	}
+	e.int(len(m.starts))
+	for i, r := range m.starts {
+		e.int(int(r))
+		e.int(m.class[i])
+	}
+	e.int(len(m.table))
+	ncls := 0
+	if len(m.table) > 0 {
+		ncls = len(m.table[0])
+	}
+	e.int(ncls)
+	for s, row := range m.table {
+		for _, t := range row {
+			e.int(t)
+		}
+		e.int(m.accept[s])
+	}
+	return e, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It replaces m with
+// the machine encoded in data by MarshalBinary. The keyword tables of the
+// decoded rules can be retrieved with Keywords.
+//
+func (m *Machine) UnmarshalBinary(data []byte) error {
+	if len(data) < len(magic)+1 || string(data[:len(magic)]) != magic || data[len(magic)] != version {
+		return ErrFormat
+	}
+	d := decoder{b: data[len(magic)+1:]}
+	var n Machine
+	n.eof = lex.Token(d.int())
+	n.rules = make([]Rule, d.len())
+	for i := range n.rules {
+		ru := &n.rules[i]
+		ru.Pattern = d.string()
+		ru.Token = lex.Token(d.int())
+		ru.Skip = d.bool()
+		ru.Priority = d.int()
+		if l := d.len(); l > 0 {
+			ru.Keywords = make(Keywords, l)
+			for ; l > 0; l-- {
+				kw := d.string()
+				ru.Keywords[kw] = lex.Token(d.int())
+			}
+		}
+	}
+	for i := range n.ascii {
+		n.ascii[i] = d.int()
+	}
+	l := d.len()
+	n.starts = make([]rune, l)
+	n.class = make([]int, l)
+	for i := range n.starts {
+		n.starts[i] = rune(d.int())
+		n.class[i] = d.int()
+	}
+	ns, ncls := d.len(), d.len()
+	if ns*(ncls+1) > len(d.b) {
+		return ErrFormat
+	}
+	n.table = make([][]int, ns)
+	n.accept = make([]int, ns)
+	for s := range n.table {
+		row := make([]int, ncls)
+		for c := range row {
+			row[c] = d.int()
+		}
+		n.table[s] = row
+		n.accept[s] = d.int()
+	}
+	if d.err || len(d.b) != 0 || !n.valid() {
+		return ErrFormat
+	}
+	*m = n
+	return nil
+}
+
+// valid checks that all indices in the tables of a decoded machine are within
+// bounds so that a corrupt encoding cannot cause a panic during lexing.
+//
+func (m *Machine) valid() bool {
+	if len(m.table) == 0 || len(m.starts) == 0 || m.starts[0] != utf8.RuneSelf {
+		return false
+	}
+	ncls := len(m.table[0])
+	for _, c := range m.ascii {
+		if c < 0 || c >= ncls {
+			return false
+		}
+	}
+	for i, c := range m.class {
+		if c < 0 || c >= ncls || i > 0 && m.starts[i] <= m.starts[i-1] {
+			return false
+		}
+	}
+	for s, row := range m.table {
+		for _, t := range row {
+			if t < -1 || t >= len(m.table) {
+				return false
+			}
+		}
+		if a := m.accept[s]; a < -1 || a >= len(m.rules) {
+			return false
+		}
+	}
+	return true
+}
+
+// Keywords returns the keyword table of the given rule. It is mostly useful for
+// machines loaded with UnmarshalBinary, whose keyword tables are not shared
+// with the caller.
+//
+func (m *Machine) Keywords(rule int) Keywords {
+	return m.rules[rule].Keywords
+}
+
+// SetAction sets the action of the given rule (see Rule.Action). It is mostly
+// useful for machines loaded with UnmarshalBinary.
+//
+func (m *Machine) SetAction(rule int, action func(s *lex.State)) {
+	m.rules[rule].Action = action
+}
+
+type encoder []byte
+
+func (e *encoder) int(i int) {
+	var b [binary.MaxVarintLen64]byte
+	*e = append(*e, b[:binary.PutVarint(b[:], int64(i))]...)
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.int(1)
+	} else {
+		e.int(0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.int(len(s))
+	*e = append(*e, s...)
+}
+
+type decoder struct {
+	b   []byte
+	err bool
+}
+
+func (d *decoder) int() int {
+	if d.err {
+		return 0
+	}
+	i, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = true
+		return 0
+	}
+	d.b = d.b[n:]
+	return int(i)
+}
+
+// len decodes a length. Lengths larger than the remaining data are invalid
+// since each element takes at least one byte.
+//
+func (d *decoder) len() int {
+	l := d.int()
+	if l < 0 || l > len(d.b) {
+		d.err = true
+		return 0
+	}
+	return l
+}
+
+func (d *decoder) bool() bool {
+	return d.int() != 0
+}
+
+func (d *decoder) string() string {
+	l := d.len()
+	if d.err {
+		return ""
+	}
+	s := string(d.b[:l])
+	d.b = d.b[l:]
+	return s
+}
@@ -0,0 +1,266 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package dfa
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+// A Rule associates a pattern with a token type.
+//
+// Instead of a pattern, a rule can specify classes of runes as Unicode range
+// tables: the rule then matches a rune from any of the Start tables followed
+// by any number of runes from the Continue tables. This is typically used for
+// identifiers:
+//
+//	dfa.Rule{
+//		Start:    []*unicode.RangeTable{unicode.L, underscore},
+//		Continue: []*unicode.RangeTable{unicode.L, unicode.Nd, underscore},
+//		Token:    tokIdent,
+//	}
+//
+// Range tables are compiled into the DFA like any other pattern, so matching
+// does not involve any per-rune function call.
+//
+// Priority is used to resolve ambiguities between rules that match the same
+// input with the same length, like a literal and an identifier rule. The rule
+// with the highest priority wins. Rules with the same priority (the default is
+// 0) are resolved by order of appearance. Priorities never override the longest
+// match: with the rules
+//
+//	{Pattern: `if`, Token: tokIf, Priority: 1},
+//	{Pattern: `[a-z]+`, Token: tokIdent},
+//
+// "if" is lexed as tokIf but "iffy" as tokIdent.
+//
+// If Keywords is not nil, the text matched by the rule is looked up in
+// Keywords and the corresponding token type, if any, is emitted instead of
+// Token. Keyword lookup happens after the match has been resolved, so a keyword
+// always wins over the rule it is attached to.
+//
+// If Action is not nil, it is called after the token matched by the rule has
+// been emitted or skipped. Lexers with several modes use it to switch to the
+// state function of another Machine with State.Init:
+//
+//	dfa.Rule{Pattern: `"`, Token: tokQuote, Action: func(s *lex.State) { s.Init(inString) }}
+//
+type Rule struct {
+	Pattern  string
+	Start    []*unicode.RangeTable
+	Continue []*unicode.RangeTable
+	Token    lex.Token
+	Skip     bool // if true, matching input is discarded
+	Priority int
+	Keywords Keywords
+	Action   func(s *lex.State)
+}
+
+// Keywords maps keywords to token types. Since the map is looked up after a
+// match, it can be updated between tokens (e.g. by a parser that knows that a
+// contextual keyword is allowed at this point) without rebuilding the Machine:
+//
+//	kw := dfa.Keywords{"select": tokSelect}
+//	m, err := dfa.New([]dfa.Rule{{Pattern: `[a-z]+`, Token: tokIdent, Keywords: kw}}, tokEOF)
+//	// ...
+//	kw["async"] = tokAsync // enable the async keyword
+//	delete(kw, "async")    // back to an identifier
+//
+// Since Lexer.Lex runs state functions until a token is available, changes
+// take effect for tokens that have not yet been lexed. Keywords must not be
+// modified concurrently with lexing.
+//
+type Keywords map[string]lex.Token
+
+// A Machine is a table driven lexer. Each DFA state is a row in a transition
+// table indexed by rune equivalence classes, so that lexing a token is a
+// simple loop instead of a chain of state function calls.
+//
+type Machine struct {
+	rules  []Rule
+	eof    lex.Token
+	ascii  [utf8.RuneSelf]int // class of ASCII runes
+	starts []rune             // start rune of each interval for runes >= utf8.RuneSelf
+	class  []int              // class of each interval in starts
+	table  [][]int            // table[state][class] = next state or -1
+	accept []int              // index of the accepted rule in each state or -1
+}
+
+// New compiles the given rules into a minimal DFA and returns a table driven
+// Machine for it. The eof token is emitted upon reaching the end of input.
+//
+// When several rules match the same input, the longest match wins. If two
+// rules match the same number of runes, the rule with the highest priority
+// wins, then the rule that comes first.
+//
+func New(rules []Rule, eof lex.Token) (*Machine, error) {
+	d, err := CompileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	m := &Machine{
+		rules: append([]Rule(nil), rules...),
+		eof:   eof,
+	}
+	m.build(d.Minimize())
+	return m, nil
+}
+
+// build computes the transition table of d. Rune intervals having identical
+// transitions in all states are merged into a single class.
+//
+func (m *Machine) build(d *DFA) {
+	cls := d.classes()
+	tbl := d.table(cls)
+	idx := make(map[string]int)
+	col := make([]int, len(tbl))
+	ic := make([]int, len(cls))
+	for c := range cls {
+		for s := range tbl {
+			col[s] = tbl[s][c]
+		}
+		key := intsKey(col)
+		k, ok := idx[key]
+		if !ok {
+			k = len(idx)
+			idx[key] = k
+		}
+		ic[c] = k
+	}
+
+	m.table = make([][]int, len(tbl))
+	for s := range tbl {
+		row := make([]int, len(idx))
+		for c, k := range ic {
+			row[k] = tbl[s][c]
+		}
+		m.table[s] = row
+	}
+	m.accept = make([]int, len(d.States))
+	for s := range d.States {
+		m.accept[s] = d.States[s].Accept
+	}
+
+	// class lookup
+	for c, r := range cls {
+		if r >= utf8.RuneSelf {
+			if len(m.starts) == 0 && r > utf8.RuneSelf {
+				m.starts = append(m.starts, utf8.RuneSelf)
+				m.class = append(m.class, ic[c-1])
+			}
+			m.starts = append(m.starts, r)
+			m.class = append(m.class, ic[c])
+		}
+	}
+	for r := range m.ascii {
+		i := sort.Search(len(cls), func(i int) bool { return cls[i] > rune(r) }) - 1
+		m.ascii[r] = ic[i]
+	}
+	if len(m.starts) == 0 {
+		m.starts = []rune{utf8.RuneSelf}
+		m.class = []int{m.ascii[utf8.RuneSelf-1]}
+	}
+}
+
+// States returns the number of states in the machine's DFA.
+//
+func (m *Machine) States() int {
+	return len(m.table)
+}
+
+func (m *Machine) classOf(r rune) int {
+	if r < utf8.RuneSelf {
+		return m.ascii[r]
+	}
+	i := sort.Search(len(m.starts), func(i int) bool { return m.starts[i] > r }) - 1
+	return m.class[i]
+}
+
+// StateFn returns a state function that lexes a single token. Tokens are
+// emitted with the matched text as a string value. Input that does not match
+// any rule is reported as an error, one rune at a time.
+//
+// The returned state function must be used as the initial state function of a
+// lexer. It preallocates a buffer and is not safe for concurrent use.
+//
+func (m *Machine) StateFn() lex.StateFn {
+	buf := make([]byte, 0, 64)
+	return func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		if r == lex.EOF {
+			s.Emit(s.Pos(), m.eof, nil)
+			return nil
+		}
+		s.StartToken(s.Pos())
+		var (
+			rule = -1 // last matched rule
+			ml   = 0  // length in bytes of the last match
+			n    = 0  // number of runes read since the last match
+		)
+		buf = buf[:0]
+		for st := 0; r >= 0; {
+			if st = m.table[st][m.classOf(r)]; st < 0 {
+				break
+			}
+			if r < utf8.RuneSelf {
+				buf = append(buf, byte(r))
+			} else {
+				var rb [utf8.UTFMax]byte
+				buf = append(buf, rb[:utf8.EncodeRune(rb[:], r)]...)
+			}
+			n++
+			if a := m.accept[st]; a >= 0 {
+				rule, ml, n = a, len(buf), 0
+			}
+			r = s.Next()
+		}
+		// back up to the end of the longest match. If there is no match, the
+		// first rune is consumed and reported as an error.
+		if rule >= 0 {
+			n++
+		}
+		if n >= lex.BackupBufferSize {
+			s.Errorf(s.TokenPos(), "token too long: cannot backtrack %d runes", n)
+			return nil
+		}
+		for ; n > 0; n-- {
+			s.Backup()
+		}
+		if rule < 0 {
+			s.Errorf(s.TokenPos(), "unexpected character %#U", s.Current())
+			return nil
+		}
+		ru := &m.rules[rule]
+		if !ru.Skip {
+			t := ru.Token
+			if k, ok := ru.Keywords[string(buf[:ml])]; ok {
+				t = k
+			}
+			s.EmitString(s.TokenPos(), t, string(buf[:ml]))
+		}
+		if ru.Action != nil {
+			ru.Action(s)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,205 @@
+package dfa_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/db47h/lex"
+	"github.com/db47h/lex/dfa"
+)
+
+const (
+	tokEOF lex.Token = iota
+	tokIdent
+	tokNumber
+	tokOp
+	tokIf
+)
+
+var rules = []dfa.Rule{
+	{Pattern: `if`, Token: tokIf},
+	{Pattern: `[\pL_][\pL\pN_]*`, Token: tokIdent},
+	{Pattern: `[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?`, Token: tokNumber},
+	{Pattern: `[-+*/=<>!]=?|&&|\|\|`, Token: tokOp},
+	{Pattern: `[ \t\n]+`, Skip: true},
+}
+
+func TestMinimize(t *testing.T) {
+	// (a|b)*abb from the dragon book: 5 states, 4 once minimized.
+	d, err := dfa.Compile([]string{`(a|b)*abb`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := d.Minimize()
+	if len(m.States) != 4 {
+		t.Fatalf("got %d states, expected 4", len(m.States))
+	}
+	for _, s := range []string{"abb", "aabb", "babb", "ab", "abba"} {
+		a1, n1 := match(d, s)
+		a2, n2 := match(m, s)
+		if a1 != a2 || n1 != n2 {
+			t.Errorf("%q: minimized DFA returned %d/%d, expected %d/%d", s, a2, n2, a1, n1)
+		}
+	}
+}
+
+func TestMachine(t *testing.T) {
+	m, err := dfa.New(rules, tokEOF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "if iff x1 == 3.14e+2 é_2 && 12e ?"
+	exp := []string{
+		"0 4 if",
+		"3 1 iff",
+		"7 1 x1",
+		"10 3 ==",
+		"13 2 3.14e+2",
+		"21 1 é_2",
+		"26 3 &&",
+		"29 2 12",
+		"31 1 e",
+		"33 -1 unexpected character U+003F '?'",
+		"34 0 <nil>",
+	}
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader(input)), m.StateFn())
+	for _, e := range exp {
+		tt, p, v := l.Lex()
+		if got := fmt.Sprintf("%d %d %v", p, tt, v); got != e {
+			t.Errorf("got %q, expected %q", got, e)
+		}
+	}
+}
+
+func TestMachine_rangeTables(t *testing.T) {
+	underscore := &unicode.RangeTable{R16: []unicode.Range16{{'_', '_', 1}}}
+	m, err := dfa.New([]dfa.Rule{
+		{Start: []*unicode.RangeTable{unicode.L, underscore}, Continue: []*unicode.RangeTable{unicode.L, unicode.Nd, unicode.Mn, underscore}, Token: tokIdent},
+		{Start: []*unicode.RangeTable{unicode.Nd}, Continue: []*unicode.RangeTable{unicode.Nd}, Token: tokNumber},
+		{Start: []*unicode.RangeTable{unicode.White_Space}, Skip: true},
+	}, tokEOF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "_x1 καλή ١٢٣ +"
+	exp := []string{
+		"0 1 _x1",
+		"4 1 καλή",
+		"15 2 ١٢٣",
+		"22 -1 unexpected character U+002B '+'",
+		"23 0 <nil>",
+	}
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader(input)), m.StateFn())
+	for _, e := range exp {
+		tt, p, v := l.Lex()
+		if got := fmt.Sprintf("%d %d %v", p, tt, v); got != e {
+			t.Errorf("got %q, expected %q", got, e)
+		}
+	}
+
+	if _, err = dfa.New([]dfa.Rule{{Pattern: "a", Start: []*unicode.RangeTable{unicode.L}}}, tokEOF); err == nil {
+		t.Error("expected error for rule with both pattern and range tables")
+	}
+}
+
+func TestMachine_keywords(t *testing.T) {
+	const tokAsync = tokIf + 1
+	kw := dfa.Keywords{"if": tokIf}
+	m, err := dfa.New([]dfa.Rule{
+		{Pattern: `[a-z]+`, Token: tokIdent, Keywords: kw},
+		{Pattern: ` +`, Skip: true},
+	}, tokEOF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader("async if async if")), m.StateFn())
+	exp := []lex.Token{tokIdent, tokIf, tokAsync, tokIdent, tokEOF}
+	for i, e := range exp {
+		tt, _, v := l.Lex()
+		if tt != e {
+			t.Errorf("token %d (%v): got type %d, expected %d", i, v, tt, e)
+		}
+		// parser feedback: async is a keyword after if, and if is no longer one.
+		if tt == tokIf {
+			kw["async"] = tokAsync
+			delete(kw, "if")
+		}
+	}
+}
+
+func TestMachine_action(t *testing.T) {
+	var upper, lower lex.StateFn
+	ml, err := dfa.New([]dfa.Rule{
+		{Pattern: `[a-z]+`, Token: tokIdent},
+		{Pattern: `!`, Skip: true, Action: func(s *lex.State) { s.Init(upper) }},
+	}, tokEOF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu, err := dfa.New([]dfa.Rule{
+		{Pattern: `[A-Z]+`, Token: tokIdent},
+		{Pattern: `!`, Token: tokOp},
+	}, tokEOF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.SetAction(1, func(s *lex.State) { s.Init(lower) })
+	lower, upper = ml.StateFn(), mu.StateFn()
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader("abc!DEF!ghi")), lower)
+	exp := []struct {
+		t lex.Token
+		v string
+	}{{tokIdent, "abc"}, {tokIdent, "DEF"}, {tokOp, "!"}, {tokIdent, "ghi"}}
+	for i, e := range exp {
+		tt, _, v := l.Lex()
+		if tt != e.t || v != e.v {
+			t.Errorf("token %d: got %d %v, expected %d %q", i, tt, v, e.t, e.v)
+		}
+	}
+	if tt, _, _ := l.Lex(); tt != tokEOF {
+		t.Errorf("got %d, expected EOF", tt)
+	}
+}
+
+func TestMachine_MarshalBinary(t *testing.T) {
+	kw := dfa.Keywords{"else": tokIf}
+	rs := append([]dfa.Rule(nil), rules...)
+	rs[1].Keywords = kw
+	m, err := dfa.New(rs, tokEOF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m2 dfa.Machine
+	if err = m2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m2.Keywords(1), kw) {
+		t.Fatalf("got keywords %v, expected %v", m2.Keywords(1), kw)
+	}
+	input := "if else x1 = 42 + é"
+	l1 := lex.NewLexer(lex.NewFile("test", strings.NewReader(input)), m.StateFn())
+	l2 := lex.NewLexer(lex.NewFile("test", strings.NewReader(input)), m2.StateFn())
+	for {
+		t1, p1, v1 := l1.Lex()
+		t2, p2, v2 := l2.Lex()
+		if t1 != t2 || p1 != p2 || v1 != v2 {
+			t.Fatalf("got %d %d %v, expected %d %d %v", t2, p2, v2, t1, p1, v1)
+		}
+		if t1 == tokEOF {
+			break
+		}
+	}
+
+	for i := 0; i < len(data); i++ {
+		if err = m2.UnmarshalBinary(data[:i]); err != dfa.ErrFormat {
+			t.Fatalf("truncated at %d: got error %v, expected %v", i, err, dfa.ErrFormat)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package dfa
+
+import (
+	"sort"
+	"unicode"
+)
+
+// classes splits the rune space into intervals such that all the runes in a
+// given interval have the same transitions in all states. It returns the
+// sorted start rune of each interval.
+//
+func (d *DFA) classes() []rune {
+	pts := []rune{0}
+	for _, s := range d.States {
+		for _, t := range s.Trans {
+			pts = append(pts, t.Lo)
+			if t.Hi < unicode.MaxRune {
+				pts = append(pts, t.Hi+1)
+			}
+		}
+	}
+	sort.Slice(pts, func(i, j int) bool { return pts[i] < pts[j] })
+	out := pts[:1]
+	for _, p := range pts[1:] {
+		if p != out[len(out)-1] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// table returns the transition table of d over the given rune intervals.
+//
+func (d *DFA) table(cls []rune) [][]int {
+	tbl := make([][]int, len(d.States))
+	for i := range d.States {
+		row := make([]int, len(cls))
+		for c, r := range cls {
+			row[c] = d.Next(i, r)
+		}
+		tbl[i] = row
+	}
+	return tbl
+}
+
+// Minimize returns a DFA equivalent to d with a minimal number of states.
+// The start state of the returned DFA is still States[0].
+//
+func (d *DFA) Minimize() *DFA {
+	cls := d.classes()
+	tbl := d.table(cls)
+
+	// Moore's partition refinement. Initial blocks are determined by the
+	// accepted pattern.
+	block := make([]int, len(d.States))
+	n := 0
+	{
+		idx := make(map[int]int)
+		for i, s := range d.States {
+			b, ok := idx[s.Accept]
+			if !ok {
+				b = len(idx)
+				idx[s.Accept] = b
+			}
+			block[i] = b
+		}
+		n = len(idx)
+	}
+	for {
+		idx := make(map[string]int)
+		next := make([]int, len(block))
+		sig := make([]int, len(cls)+1)
+		for i := range d.States {
+			sig[0] = block[i]
+			for c, t := range tbl[i] {
+				if t >= 0 {
+					t = block[t]
+				}
+				sig[c+1] = t
+			}
+			key := intsKey(sig)
+			b, ok := idx[key]
+			if !ok {
+				b = len(idx)
+				idx[key] = b
+			}
+			next[i] = b
+		}
+		block = next
+		if len(idx) == n {
+			break
+		}
+		n = len(idx)
+	}
+
+	// renumber blocks so that the start state stays at index 0.
+	num := make([]int, n)
+	for i := range num {
+		num[i] = -1
+	}
+	num[block[0]] = 0
+	k := 1
+	for _, b := range block {
+		if num[b] < 0 {
+			num[b] = k
+			k++
+		}
+	}
+
+	m := &DFA{States: make([]State, n)}
+	done := make([]bool, n)
+	for i, s := range d.States {
+		b := num[block[i]]
+		if done[b] {
+			continue
+		}
+		done[b] = true
+		trans := make([]Transition, 0, len(s.Trans))
+		for _, t := range s.Trans {
+			t.Next = num[block[t.Next]]
+			if l := len(trans); l > 0 && trans[l-1].Next == t.Next && trans[l-1].Hi+1 == t.Lo {
+				trans[l-1].Hi = t.Hi
+				continue
+			}
+			trans = append(trans, t)
+		}
+		m.States[b] = State{Trans: trans, Accept: s.Accept}
+	}
+	return m
+}
+
+func intsKey(is []int) string {
+	b := make([]byte, 0, len(is)*4)
+	for _, i := range is {
+		b = append(b, byte(i), byte(i>>8), byte(i>>16), byte(i>>24))
+	}
+	return string(b)
+}
@@ -0,0 +1,278 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package dfa
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"unicode"
+	"unicode/utf8"
+)
+
+// nfaState is a Thompson NFA state. A state either has epsilon transitions
+// (eps), a transition on a set of rune ranges (ranges, next) or is an accepting
+// state (accept >= 0).
+//
+type nfaState struct {
+	eps    []int
+	ranges []rune // pairs of lo, hi
+	next   int
+	accept int
+}
+
+type nfa struct {
+	states []nfaState
+	prio   []int // rule priorities
+}
+
+// prefer reports whether rule a wins over rule b when both match the same
+// input: the rule with the higher priority wins, then the rule that comes
+// first.
+//
+func (n *nfa) prefer(a, b int) bool {
+	if a < len(n.prio) && b < len(n.prio) && n.prio[a] != n.prio[b] {
+		return n.prio[a] > n.prio[b]
+	}
+	return a < b
+}
+
+// frag is an NFA fragment with a single entry state and a single exit state.
+// The exit state has no outgoing transitions.
+//
+type frag struct {
+	in, out int
+}
+
+func (n *nfa) newState() int {
+	n.states = append(n.states, nfaState{next: -1, accept: -1})
+	return len(n.states) - 1
+}
+
+func (n *nfa) epsilon(from, to int) {
+	n.states[from].eps = append(n.states[from].eps, to)
+}
+
+// add compiles pattern and links it to the start state. The accepting state of
+// the pattern is tagged with rule.
+//
+func (n *nfa) add(start int, pattern string, rule int) error {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return err
+	}
+	f, err := n.compile(re.Simplify())
+	if err != nil {
+		return fmt.Errorf("%s: %v", pattern, err)
+	}
+	n.epsilon(start, f.in)
+	n.states[f.out].accept = rule
+	return nil
+}
+
+// addClass adds a rule matching a rune in start followed by any number of runes
+// in cont.
+//
+func (n *nfa) addClass(start int, first, cont []rune, rule int) {
+	f := n.ranges(first)
+	if len(cont) > 0 {
+		c := n.ranges(cont)
+		n.epsilon(f.out, c.in)
+		n.epsilon(c.out, f.out)
+	}
+	n.epsilon(start, f.in)
+	n.states[f.out].accept = rule
+}
+
+func (n *nfa) compile(re *syntax.Regexp) (frag, error) {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return frag{n.newState(), n.newState()}, nil
+	case syntax.OpEmptyMatch:
+		return n.empty(), nil
+	case syntax.OpLiteral:
+		f := n.empty()
+		for _, r := range re.Rune {
+			var rs []rune
+			if re.Flags&syntax.FoldCase != 0 {
+				rs = foldRanges(r)
+			} else {
+				rs = []rune{r, r}
+			}
+			f = n.concat(f, n.ranges(rs))
+		}
+		return f, nil
+	case syntax.OpCharClass:
+		return n.ranges(re.Rune), nil
+	case syntax.OpAnyCharNotNL:
+		return n.ranges([]rune{0, '\n' - 1, '\n' + 1, unicode.MaxRune}), nil
+	case syntax.OpAnyChar:
+		return n.ranges([]rune{0, unicode.MaxRune}), nil
+	case syntax.OpCapture:
+		return n.compile(re.Sub[0])
+	case syntax.OpConcat:
+		f := n.empty()
+		for _, sub := range re.Sub {
+			sf, err := n.compile(sub)
+			if err != nil {
+				return f, err
+			}
+			f = n.concat(f, sf)
+		}
+		return f, nil
+	case syntax.OpAlternate:
+		f := frag{n.newState(), n.newState()}
+		for _, sub := range re.Sub {
+			sf, err := n.compile(sub)
+			if err != nil {
+				return f, err
+			}
+			n.epsilon(f.in, sf.in)
+			n.epsilon(sf.out, f.out)
+		}
+		return f, nil
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest:
+		sf, err := n.compile(re.Sub[0])
+		if err != nil {
+			return sf, err
+		}
+		f := frag{n.newState(), n.newState()}
+		n.epsilon(f.in, sf.in)
+		n.epsilon(sf.out, f.out)
+		if re.Op != syntax.OpPlus {
+			n.epsilon(f.in, f.out)
+		}
+		if re.Op != syntax.OpQuest {
+			n.epsilon(sf.out, sf.in)
+		}
+		return f, nil
+	}
+	return frag{}, fmt.Errorf("unsupported regular expression operator %v", re.Op)
+}
+
+func (n *nfa) empty() frag {
+	s := n.newState()
+	return frag{s, s}
+}
+
+func (n *nfa) ranges(rs []rune) frag {
+	f := frag{n.newState(), n.newState()}
+	n.states[f.in].ranges = validRanges(rs)
+	n.states[f.in].next = f.out
+	return f
+}
+
+func (n *nfa) concat(a, b frag) frag {
+	n.epsilon(a.out, b.in)
+	return frag{a.in, b.out}
+}
+
+// foldRanges returns the rune ranges matching r and all its case-folding
+// equivalents.
+//
+func foldRanges(r rune) []rune {
+	rs := []rune{r, r}
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		rs = append(rs, f, f)
+	}
+	return normalizeRanges(rs)
+}
+
+// tableRanges returns the union of the rune ranges of the given tables.
+//
+func tableRanges(ts []*unicode.RangeTable) []rune {
+	var rs []rune
+	add := func(lo, hi, stride rune) {
+		if stride == 1 {
+			rs = append(rs, lo, hi)
+			return
+		}
+		for r := lo; r <= hi; r += stride {
+			rs = append(rs, r, r)
+		}
+	}
+	for _, t := range ts {
+		for _, r := range t.R16 {
+			add(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+		}
+		for _, r := range t.R32 {
+			add(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+		}
+	}
+	return normalizeRanges(rs)
+}
+
+// closure adds to set all states reachable from s through epsilon transitions.
+//
+func (n *nfa) closure(set map[int]bool, s int) {
+	if set[s] {
+		return
+	}
+	set[s] = true
+	for _, e := range n.states[s].eps {
+		n.closure(set, e)
+	}
+}
+
+// normalizeRanges sorts rune ranges and merges overlapping or adjacent ones.
+//
+func normalizeRanges(rs []rune) []rune {
+	// insertion sort on pairs; range lists are usually short or already sorted.
+	for i := 2; i < len(rs); i += 2 {
+		for j := i; j > 0 && rs[j] < rs[j-2]; j -= 2 {
+			rs[j], rs[j+1], rs[j-2], rs[j-1] = rs[j-2], rs[j-1], rs[j], rs[j+1]
+		}
+	}
+	out := rs[:0]
+	for i := 0; i < len(rs); i += 2 {
+		lo, hi := rs[i], rs[i+1]
+		if l := len(out); l > 0 && lo <= out[l-1]+1 {
+			if hi > out[l-1] {
+				out[l-1] = hi
+			}
+			continue
+		}
+		out = append(out, lo, hi)
+	}
+	return out
+}
+
+// validRanges removes surrogate halves from rune ranges since these can never
+// be returned by lex.State.Next.
+//
+func validRanges(rs []rune) []rune {
+	const surrLo, surrHi = 0xd800, 0xdfff
+	out := make([]rune, 0, len(rs))
+	for i := 0; i < len(rs); i += 2 {
+		lo, hi := rs[i], rs[i+1]
+		if hi > utf8.MaxRune {
+			hi = utf8.MaxRune
+		}
+		if lo < surrLo && hi >= surrLo {
+			out = append(out, lo, surrLo-1)
+			lo = surrHi + 1
+		} else if lo >= surrLo && lo <= surrHi {
+			lo = surrHi + 1
+		}
+		if lo <= hi {
+			out = append(out, lo, hi)
+		}
+	}
+	return out
+}
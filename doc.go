@@ -106,8 +106,9 @@ Error handling
 The lex package provides a single built-in Error token. This token is
 automatically emitted whenever an I/O error occurs or on invalid UTF-8 input.
 
-I/O errors are non-recoverable, that is any subsequent call to Lexer.Lex will
-return EOF.
+I/O errors are reported as a ReadError and are non-recoverable, that is any
+subsequent call to Lexer.Lex will return EOF. Readers that repeatedly return no
+data are handled according to the lexer's RetryPolicy (see Retry).
 
 State.Next and State.ReadRune always return valid runes. Any invalid UTF-8 input
 will be skipped and a matching Error token will be automatiocally generated.
@@ -116,7 +117,8 @@ Caveat: This may lead to Error tokens appearing alongside seemingly valid
 tokens in the token stream. For example, lexing numbers in "1\02" will yield
 an automatically generated Error token followed by some other token with literal
 value "12". This should be taken into account when implementing error handling
-strategies.
+strategies. The DeferErrors option can be used to emit such Error tokens after
+the token they interrupted.
 
 State sub-package
 
@@ -0,0 +1,140 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A PosError is an error message at a given source position. It is the lex
+// equivalent of go/scanner.Error.
+//
+type PosError struct {
+	Pos Position
+	Msg string
+}
+
+func (e *PosError) Error() string {
+	if e.Pos.Filename != "" || e.Pos.Line > 0 {
+		return e.Pos.String() + ": " + e.Msg
+	}
+	return e.Msg
+}
+
+// An ErrorList is a list of errors with their position. Its methods follow
+// the semantics of those of go/scanner.ErrorList, so that code written for
+// go/scanner can use it as is. The zero value is an empty list ready to use.
+//
+type ErrorList []*PosError
+
+// Add appends an error with the given position and message to the list.
+//
+func (p *ErrorList) Add(pos Position, msg string) {
+	*p = append(*p, &PosError{Pos: pos, Msg: msg})
+}
+
+// Reset empties the list.
+//
+func (p *ErrorList) Reset() {
+	*p = (*p)[:0]
+}
+
+// Sort sorts the list by file name, line and column. Errors at the same
+// position are sorted by message.
+//
+func (p ErrorList) Sort() {
+	sort.Slice(p, func(i, j int) bool {
+		a, b := p[i], p[j]
+		switch {
+		case a.Pos.Filename != b.Pos.Filename:
+			return a.Pos.Filename < b.Pos.Filename
+		case a.Pos.Line != b.Pos.Line:
+			return a.Pos.Line < b.Pos.Line
+		case a.Pos.Column != b.Pos.Column:
+			return a.Pos.Column < b.Pos.Column
+		}
+		return a.Msg < b.Msg
+	})
+}
+
+// RemoveMultiples sorts the list and keeps only the first error of each line.
+//
+func (p *ErrorList) RemoveMultiples() {
+	p.Sort()
+	l := *p
+	n := 0
+	for i, e := range l {
+		if i > 0 && e.Pos.Filename == l[n-1].Pos.Filename && e.Pos.Line == l[n-1].Pos.Line {
+			continue
+		}
+		l[n] = e
+		n++
+	}
+	for i := n; i < len(l); i++ {
+		l[i] = nil
+	}
+	*p = l[:n]
+}
+
+// Error returns the message of the first error, followed by the number of
+// other errors if any.
+//
+func (p ErrorList) Error() string {
+	if len(p) == 0 {
+		return "no errors"
+	}
+	if len(p) == 1 {
+		return p[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", p[0], len(p)-1)
+}
+
+// Err returns p as an error, or nil if p is empty. Returning p directly would
+// return a non-nil error for an empty list.
+//
+func (p ErrorList) Err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
+
+// CollectErrors returns a TokenSource that reads tokens from l and adds Error
+// tokens to list instead of returning them.
+//
+func CollectErrors(l *Lexer, list *ErrorList) TokenSource {
+	return &errorCollector{l, list}
+}
+
+type errorCollector struct {
+	l    *Lexer
+	list *ErrorList
+}
+
+func (c *errorCollector) Lex() (Token, int, interface{}) {
+	for {
+		t, p, v := c.l.Lex()
+		if t != Error {
+			return t, p, v
+		}
+		c.list.Add(c.l.File().Position(p), v.(error).Error())
+	}
+}
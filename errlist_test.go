@@ -0,0 +1,61 @@
+package lex_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestCollectErrors(t *testing.T) {
+	f := lex.NewFile("test", strings.NewReader("a1\nb23c\x00"))
+	l := lex.NewLexer(f, func(s *lex.State) lex.StateFn {
+		switch r := s.Next(); {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r >= '0' && r <= '9':
+			s.Errorf(s.Pos(), "digit %c", r)
+		case r != '\n':
+			s.Emit(s.Pos(), tokChar, r)
+		}
+		return nil
+	})
+	var errs lex.ErrorList
+	src := lex.CollectErrors(l, &errs)
+	var got []rune
+	for {
+		tt, _, v := src.Lex()
+		if tt == tokEOF {
+			break
+		}
+		got = append(got, v.(rune))
+	}
+	if string(got) != "abc" {
+		t.Errorf("got tokens %q, expected %q", string(got), "abc")
+	}
+	if len(errs) != 4 {
+		t.Fatalf("got %d errors, expected 4: %v", len(errs), errs)
+	}
+	// move the NUL error first to check sorting
+	errs[0], errs[3] = errs[3], errs[0]
+	errs.RemoveMultiples()
+	exp := []string{
+		"test:1:2: digit 1",
+		"test:2:2: digit 2",
+	}
+	if len(errs) != len(exp) {
+		t.Fatalf("got errors %v, expected %v", errs, exp)
+	}
+	for i := range exp {
+		if errs[i].Error() != exp[i] {
+			t.Errorf("got error %q, expected %q", errs[i], exp[i])
+		}
+	}
+	if err := errs.Err(); err == nil || err.Error() != "test:1:2: digit 1 (and 1 more errors)" {
+		t.Errorf("got %v", err)
+	}
+	errs.Reset()
+	if errs.Err() != nil {
+		t.Errorf("expected nil error after Reset")
+	}
+}
@@ -45,19 +45,33 @@ type Position struct {
 	Filename string
 	Line     int // 1-based line number
 	Column   int // 1-based column number (byte index)
+
+	// 1-based column number in text cells, as computed by File.VisualPosition,
+	// or 0.
+	VisualColumn int
 }
 
 func (p Position) String() string {
 	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
 }
 
+// FormatItem returns the position of it in f followed by its string
+// representation as returned by Item.String:
+//
+//	input.go:1:5 [4,7) Ident "foo"
+//
+func (f *File) FormatItem(it Item) string {
+	return f.Position(it.Pos).String() + " " + it.String()
+}
+
 // A File represents an input file. It's a wrapper around an io.Reader that
 // handles file offset to line/column conversion.
 //
 type File struct {
 	name string
 	io.Reader
-	lines []int // 0-based line/offset information
+	lines []int  // 0-based line/offset information
+	sync  func() // records pending lines, set by lexers in lazy mode
 }
 
 // NewFile returns a new File.
@@ -95,6 +109,9 @@ func (f *File) AddLine(offset int, line int) {
 // The returned column is a byte offset, not a rune offset.
 //
 func (f *File) Position(offset int) Position {
+	if f.sync != nil {
+		f.sync()
+	}
 	i, j := 0, len(f.lines)
 	for i < j {
 		h := int(uint(i+j) >> 1)
@@ -104,12 +121,15 @@ func (f *File) Position(offset int) Position {
 			j = h
 		}
 	}
-	return Position{f.name, i, int(offset - f.lines[i-1] + 1)}
+	return Position{Filename: f.name, Line: i, Column: int(offset - f.lines[i-1] + 1)}
 }
 
 // LineOffset returns the file offset of the given line.
 //
 func (f *File) LineOffset(line int) int {
+	if f.sync != nil {
+		f.sync()
+	}
 	if line < 1 || line > len(f.lines) {
 		return -1
 	}
@@ -3,11 +3,9 @@ package lex_test
 import (
 	"fmt"
 	"strings"
-	"unicode"
-	"unicode/utf8"
+	"testing"
 
 	"github.com/db47h/lex"
-	"golang.org/x/text/width"
 )
 
 // This example shows how one could use File.GetLineBytes to display nicely
@@ -79,42 +77,32 @@ func ExampleFile_GetLineBytes() {
 //		source line where the error occurred followed by a line with a carret at the position of the error.
 //						      ^
 func reportError(f *lex.File, p int, msg string) {
-	pos := f.Position(p)
+	pos, err := f.VisualPosition(p, lex.AmbiguousNarrow)
 	fmt.Printf("%s: error %s\n", pos, msg)
-	l, err := f.GetLineBytes(p)
 	if err != nil {
 		return
 	}
-	b := pos.Column - 1
-	if b > len(l) {
-		b = len(l)
-	}
+	l, _ := f.GetLineBytes(p)
 	fmt.Printf("|%s\n", l)
-	fmt.Printf("|%*c^\n", getWidth(l[:b]), ' ')
+	fmt.Printf("|%*c\n", pos.VisualColumn, '^')
 	// or make it red!
-	// fmt.Printf("|%*c\x1b[31m^\x1b[0m\n", getWidth(l[:b]), ' ')
+	// fmt.Printf("|%*s\x1b[31m^\x1b[0m\n", pos.VisualColumn-1, "")
 }
 
-// getWidth computes the width in text cells of a given byte slice.
-// (supposing rendering with a UTF-8 locale and monospaced font)
-//
-func getWidth(l []byte) int {
-	w := 0
-	for i := 0; i < len(l); {
-		r, s := utf8.DecodeRune(l[i:])
-		i += s
-		if !unicode.IsGraphic(r) {
-			continue
-		}
-		p := width.LookupRune(r)
-		switch p.Kind() {
-		case width.EastAsianFullwidth, width.EastAsianWide:
-			w += 2
-		case width.EastAsianAmbiguous:
-			w += 1 // depends on user locale. 2 if locale is CJK, 1 otherwise.
-		default:
-			w += 1
+func TestTextWidth(t *testing.T) {
+	td := []struct {
+		s      string
+		narrow int
+		wide   int
+	}{
+		{"abc", 3, 3},
+		{"世界 x", 6, 6},
+		{"é\t°", 2, 3},
+		{"ＡΩ", 3, 4},
+	}
+	for _, d := range td {
+		if n, w := lex.TextWidth([]byte(d.s), lex.AmbiguousNarrow), lex.TextWidth([]byte(d.s), lex.AmbiguousWide); n != d.narrow || w != d.wide {
+			t.Errorf("%q: got %d, %d, expected %d, %d", d.s, n, w, d.narrow, d.wide)
 		}
 	}
-	return w
 }
@@ -0,0 +1,91 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import "sort"
+
+// A FoldRegion is a range of lines that can be folded in an editor.
+//
+type FoldRegion struct {
+	Type      Token // type of the opening token
+	Pos, End  int   // offset of the opening token and end offset of the closing token
+	StartLine int   // line of the opening token
+	EndLine   int   // line of the closing token
+}
+
+// FoldRegions computes foldable regions from the tokens in items, which must be
+// in input order. Positions are resolved with f.
+//
+// pairs maps the types of opening tokens, like '{' or "begin", to the type of
+// the matching closing token. Closing tokens are matched with the innermost
+// pending opening token of the corresponding type: pending opening tokens that
+// are nested in it and were not closed are discarded. Closing tokens that
+// match no opening token are ignored.
+//
+// Tokens of the types in blocks, like block comments, span a region on their
+// own.
+//
+// Only regions spanning at least two lines are returned, sorted by offset.
+//
+func FoldRegions(f *File, items []Item, pairs map[Token]Token, blocks ...Token) []FoldRegion {
+	var (
+		open []Item
+		rs   []FoldRegion
+	)
+	closes := make(map[Token]bool, len(pairs))
+	for _, c := range pairs {
+		closes[c] = true
+	}
+	add := func(t Token, pos, end, last int) {
+		sl, el := f.Position(pos).Line, f.Position(last).Line
+		if el > sl {
+			rs = append(rs, FoldRegion{Type: t, Pos: pos, End: end, StartLine: sl, EndLine: el})
+		}
+	}
+	for _, it := range items {
+		if it.Type == Error {
+			continue
+		}
+		for _, b := range blocks {
+			if it.Type == b {
+				last := it.End - 1
+				if last < it.Pos {
+					last = it.Pos
+				}
+				add(it.Type, it.Pos, it.End, last)
+				break
+			}
+		}
+		if closes[it.Type] {
+			for i := len(open) - 1; i >= 0; i-- {
+				if pairs[open[i].Type] == it.Type {
+					add(open[i].Type, open[i].Pos, it.End, it.Pos)
+					open = open[:i]
+					break
+				}
+			}
+		}
+		if _, ok := pairs[it.Type]; ok {
+			open = append(open, it)
+		}
+	}
+	sort.SliceStable(rs, func(i, j int) bool { return rs[i].Pos < rs[j].Pos })
+	return rs
+}
@@ -0,0 +1,50 @@
+package lex_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestFoldRegions(t *testing.T) {
+	const (
+		tokLBrace lex.Token = iota + 1
+		tokRBrace
+		tokLParen
+		tokRParen
+		tokComment
+	)
+	src := "{\n  (a\n  /* a\n  b */ {}\n  [\n}\n)"
+	types := map[byte]lex.Token{'{': tokLBrace, '}': tokRBrace, '(': tokLParen, ')': tokRParen}
+	f := lex.NewFile("test", strings.NewReader(src))
+	l := lex.NewLexer(f, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		pos := s.Pos()
+		switch {
+		case r == lex.EOF:
+			s.Emit(pos, tokEOF, nil)
+		case r == '/' && s.Peek() == '*':
+			for r = s.Next(); r != lex.EOF && !(r == '*' && s.Peek() == '/'); r = s.Next() {
+			}
+			s.Next()
+			s.Emit(pos, tokComment, nil)
+		case r < 128 && types[byte(r)] != 0:
+			s.Emit(pos, types[byte(r)], nil)
+		}
+		return nil
+	})
+	var items []lex.Item
+	for !l.AtEOF() {
+		items = append(items, l.LexItem())
+	}
+	got := lex.FoldRegions(f, items, map[lex.Token]lex.Token{tokLBrace: tokRBrace, tokLParen: tokRParen}, tokComment)
+	exp := []lex.FoldRegion{
+		{Type: tokLBrace, Pos: 0, End: 29, StartLine: 1, EndLine: 6},
+		{Type: tokComment, Pos: 9, End: 20, StartLine: 3, EndLine: 4},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %+v, expected %+v", got, exp)
+	}
+}
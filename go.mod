@@ -1,5 +1,5 @@
 module github.com/db47h/lex
 
-go 1.13
+go 1.18
 
 require golang.org/x/text v0.3.2
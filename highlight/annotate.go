@@ -0,0 +1,339 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package highlight
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+// A Diagnostic is a message about the source range [Pos, End). Empty ranges
+// designate the position right before Pos.
+//
+type Diagnostic struct {
+	Pos, End int
+	Message  string
+}
+
+// Errors returns a Diagnostic for each Error token in items.
+//
+func Errors(items []lex.Item) []Diagnostic {
+	var ds []Diagnostic
+	for _, it := range items {
+		if it.Type == lex.Error {
+			msg := ""
+			if err := it.Err(); err != nil {
+				msg = err.Error()
+			}
+			ds = append(ds, Diagnostic{Pos: it.Pos, End: it.End, Message: msg})
+		}
+	}
+	return ds
+}
+
+// NoToken is the token type passed to Annotator.Mark for text that is not part
+// of any token.
+//
+const NoToken lex.Token = -2
+
+// An Annotator is a Renderer that can also render diagnostics.
+//
+type Annotator interface {
+	Renderer
+	// Mark writes text covered by diagnostics. t is the type of the token the
+	// text belongs to, or NoToken.
+	Mark(w io.Writer, t lex.Token, text []byte, diags []*Diagnostic) error
+	// Messages is called after each line of source that is covered by
+	// diagnostics, or on which diagnostics end, including the line's
+	// newline. line is the text of the line without the newline and off its
+	// offset in the source. marks has one more element than line and tells
+	// which bytes of the line are covered, the last one designating the end
+	// of the line. diags are the diagnostics that end on the line, in source
+	// order.
+	Messages(w io.Writer, line []byte, off int, marks []bool, diags []*Diagnostic) error
+}
+
+// Annotate writes the source src to w using the given annotator. It is like
+// Render, except that the tokens are taken from items, and that the source
+// text covered by diagnostics is marked. Diagnostics may span several lines;
+// their message is rendered after the line on which they end.
+//
+// Like with Render, items must be in source order and parts of the source
+// covered by several tokens are rendered with the style of the first one.
+//
+func Annotate(w io.Writer, src []byte, items []lex.Item, diags []Diagnostic, a Annotator) error {
+	ds := make([]*Diagnostic, len(diags))
+	for i := range diags {
+		ds[i] = &diags[i]
+	}
+	sort.SliceStable(ds, func(i, j int) bool { return ds[i].Pos < ds[j].Pos })
+
+	// clip tokens so that they do not overlap
+	spans := make([]lex.Item, 0, len(items))
+	cur := 0
+	for _, it := range items {
+		if it.Pos < cur {
+			it.Pos = cur
+		}
+		if it.End > len(src) {
+			it.End = len(src)
+		}
+		if it.Pos >= it.End {
+			continue
+		}
+		spans = append(spans, it)
+		cur = it.End
+	}
+
+	var (
+		tok   = 0 // first token not before the current line
+		first = 0 // first diagnostic not before the current line
+		cover []*Diagnostic
+		ended []*Diagnostic
+	)
+	for off := 0; ; {
+		end := len(src)
+		nl := end
+		if i := bytes.IndexByte(src[off:], '\n'); i >= 0 {
+			nl = off + i
+			end = nl + 1
+		}
+		line := src[off:nl]
+		marks := make([]bool, len(line)+1)
+		last := end == len(src) && nl == end
+
+		// diagnostics on this line
+		for first < len(ds) && diagLast(ds[first]) < off {
+			first++
+		}
+		ended = ended[:0]
+		marked := false
+		for _, d := range ds[first:] {
+			if d.Pos > nl {
+				break
+			}
+			if diagLast(d) < off {
+				continue
+			}
+			lo, hi := d.Pos, d.End
+			if lo < off {
+				lo = off
+			}
+			if hi > nl || hi <= lo {
+				hi = lo + 1
+				if d.End > nl {
+					hi = nl + 1
+				}
+			}
+			for i := lo; i < hi; i++ {
+				marks[i-off] = true
+			}
+			marked = true
+			if diagLast(d) <= nl || last {
+				ended = append(ended, d)
+			}
+		}
+
+		// render the line in segments of uniform token and marks
+		for p := off; p < nl; {
+			t := NoToken
+			q := nl
+			for tok < len(spans) && spans[tok].End <= p {
+				tok++
+			}
+			if tok < len(spans) {
+				if s := spans[tok]; s.Pos <= p {
+					t = s.Type
+					if s.End < q {
+						q = s.End
+					}
+				} else if s.Pos < q {
+					q = s.Pos
+				}
+			}
+			m := marks[p-off]
+			for i := p + 1; i < q; i++ {
+				if marks[i-off] != m {
+					q = i
+					break
+				}
+			}
+			var err error
+			switch {
+			case m:
+				cover = cover[:0]
+				for _, d := range ds[first:] {
+					if d.Pos > p {
+						break
+					}
+					if d.End > p || d.Pos == p {
+						cover = append(cover, d)
+					}
+				}
+				err = a.Mark(w, t, src[p:q], cover)
+			case t == NoToken:
+				err = a.Text(w, src[p:q])
+			default:
+				err = a.Token(w, t, src[p:q])
+			}
+			if err != nil {
+				return err
+			}
+			p = q
+		}
+		nlText := src[nl:end]
+		if len(nlText) == 0 && (marked || len(ended) > 0) {
+			nlText = []byte{'\n'}
+		}
+		if err := a.Text(w, nlText); err != nil {
+			return err
+		}
+		if marked || len(ended) > 0 {
+			if err := a.Messages(w, line, off, marks, ended); err != nil {
+				return err
+			}
+		}
+		// go on with an empty last line if there are diagnostics at the end
+		// of input.
+		if end == len(src) && (nl == end || len(ds) == 0 || ds[len(ds)-1].Pos < end) {
+			break
+		}
+		off = end
+	}
+	return nil
+}
+
+// diagLast returns the offset of the last byte covered by d.
+//
+func diagLast(d *Diagnostic) int {
+	if d.End > d.Pos {
+		return d.End - 1
+	}
+	return d.Pos
+}
+
+// AnnotateANSI returns an Annotator for terminals. Tokens are rendered like
+// with ANSI. Diagnostics are underlined with a line of red tildes written
+// below the source line, followed by their messages, in red.
+//
+func AnnotateANSI(styles map[lex.Token]string) Annotator {
+	return ansiAnnotator{ansi(styles)}
+}
+
+type ansiAnnotator struct {
+	ansi
+}
+
+func (a ansiAnnotator) Mark(w io.Writer, t lex.Token, text []byte, diags []*Diagnostic) error {
+	return a.Token(w, t, text)
+}
+
+func (ansiAnnotator) Messages(w io.Writer, line []byte, off int, marks []bool, diags []*Diagnostic) error {
+	var b strings.Builder
+	// pad writes the white space that aligns output with column i of line.
+	pad := func(i int) {
+		for _, r := range string(line[:i]) {
+			if r == '\t' {
+				b.WriteByte('\t')
+			} else {
+				b.WriteByte(' ')
+			}
+		}
+	}
+	n := len(marks)
+	for n > 0 && !marks[n-1] {
+		n--
+	}
+	if n > 0 {
+		b.WriteString("\x1b[1;31m")
+		for i := 0; i < n; {
+			r, s := utf8.DecodeRune(line[i:])
+			if s == 0 {
+				s = 1 // end of line
+			}
+			switch {
+			case marks[i]:
+				b.WriteByte('~')
+			case r == '\t':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(' ')
+			}
+			i += s
+		}
+		b.WriteString("\x1b[0m\n")
+	}
+	for _, d := range diags {
+		i := d.Pos - off
+		if i < 0 {
+			i = 0
+		}
+		if i > len(line) {
+			i = len(line)
+		}
+		pad(i)
+		b.WriteString("\x1b[1;31m" + d.Message + "\x1b[0m\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// AnnotateHTML returns an Annotator that writes HTML. Tokens are rendered like
+// with HTML. Text covered by diagnostics is enclosed in span elements of class
+// "diag" with the diagnostic messages as title attribute and messages are
+// written after the source line as span elements of class "diag-message".
+//
+func AnnotateHTML(classes map[lex.Token]string) Annotator {
+	return htmlAnnotator{htmlRenderer(classes)}
+}
+
+type htmlAnnotator struct {
+	htmlRenderer
+}
+
+func (h htmlAnnotator) Mark(w io.Writer, t lex.Token, text []byte, diags []*Diagnostic) error {
+	msgs := make([]string, len(diags))
+	for i, d := range diags {
+		msgs[i] = d.Message
+	}
+	if _, err := io.WriteString(w, `<span class="diag" title="`+html.EscapeString(strings.Join(msgs, "\n"))+`">`); err != nil {
+		return err
+	}
+	if err := h.Token(w, t, text); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "</span>")
+	return err
+}
+
+func (htmlAnnotator) Messages(w io.Writer, line []byte, off int, marks []bool, diags []*Diagnostic) error {
+	for _, d := range diags {
+		if _, err := io.WriteString(w, `<span class="diag-message">`+html.EscapeString(d.Message)+"</span>\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package highlight renders source code with syntax highlighting based on the
+// tokens returned by a lex.Lexer.
+//
+// The source is rendered by slicing it with the start and end offsets of the
+// tokens (see lex.Item), so that the text between tokens (whitespace,
+// comments discarded by the lexer, ...) is preserved as is.
+//
+// Annotate also renders diagnostics, like the errors reported by the lexer,
+// by marking the text they cover and writing their messages below the lines
+// on which they end.
+//
+package highlight
+
+import (
+	"html"
+	"io"
+
+	"github.com/db47h/lex"
+)
+
+// A Renderer writes highlighted source text.
+//
+type Renderer interface {
+	// Text writes text that is not part of any token or that belongs to a
+	// token without style.
+	Text(w io.Writer, text []byte) error
+	// Token writes the text of a token of type t.
+	Token(w io.Writer, t lex.Token, text []byte) error
+}
+
+// Render reads all tokens from l and writes the source src to w using the
+// given renderer. src must be the input of l.
+//
+// Tokens are expected to be returned in source order. Error tokens are
+// rendered like any other token type, but since they can be emitted before
+// the token in which the error occurred, parts of the source covered by
+// several tokens are rendered only once, with the style of the first one.
+//
+func Render(w io.Writer, src []byte, l *lex.Lexer, r Renderer) error {
+	cur := 0
+	for !l.AtEOF() {
+		it := l.LexItem()
+		pos, end := it.Pos, it.End
+		if pos < cur {
+			pos = cur
+		}
+		if end > len(src) {
+			end = len(src)
+		}
+		if pos >= end {
+			continue
+		}
+		if err := r.Text(w, src[cur:pos]); err != nil {
+			return err
+		}
+		if err := r.Token(w, it.Type, src[pos:end]); err != nil {
+			return err
+		}
+		cur = end
+	}
+	return r.Text(w, src[cur:])
+}
+
+// ANSI returns a Renderer for terminals. The styles map gives the SGR
+// parameters of each token type, like "1;34" for bold blue. Token types not
+// found in styles are not highlighted.
+//
+func ANSI(styles map[lex.Token]string) Renderer {
+	return ansi(styles)
+}
+
+type ansi map[lex.Token]string
+
+func (ansi) Text(w io.Writer, text []byte) error {
+	_, err := w.Write(text)
+	return err
+}
+
+func (a ansi) Token(w io.Writer, t lex.Token, text []byte) error {
+	s, ok := a[t]
+	if !ok {
+		return a.Text(w, text)
+	}
+	_, err := io.WriteString(w, "\x1b["+s+"m"+string(text)+"\x1b[0m")
+	return err
+}
+
+// HTML returns a Renderer that writes HTML escaped text. Tokens are enclosed in
+// span elements whose class attribute is given by the classes map. Token types
+// not found in classes are written without a span.
+//
+func HTML(classes map[lex.Token]string) Renderer {
+	return htmlRenderer(classes)
+}
+
+type htmlRenderer map[lex.Token]string
+
+func (htmlRenderer) Text(w io.Writer, text []byte) error {
+	_, err := io.WriteString(w, html.EscapeString(string(text)))
+	return err
+}
+
+func (h htmlRenderer) Token(w io.Writer, t lex.Token, text []byte) error {
+	c, ok := h[t]
+	if !ok {
+		return h.Text(w, text)
+	}
+	_, err := io.WriteString(w, `<span class="`+html.EscapeString(c)+`">`+html.EscapeString(string(text))+"</span>")
+	return err
+}
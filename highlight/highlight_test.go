@@ -0,0 +1,100 @@
+package highlight_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/db47h/lex"
+	"github.com/db47h/lex/dfa"
+	"github.com/db47h/lex/highlight"
+)
+
+const (
+	tokEOF lex.Token = iota
+	tokKeyword
+	tokIdent
+	tokOp
+)
+
+func TestRender(t *testing.T) {
+	m, err := dfa.New([]dfa.Rule{
+		{Pattern: `[a-z]+`, Token: tokIdent, Keywords: dfa.Keywords{"if": tokKeyword}},
+		{Pattern: `[<>&]`, Token: tokOp},
+		{Pattern: `[ \t\n]+|#[^\n]*`, Skip: true},
+	}, tokEOF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := []byte("if a<b # comment\n\tc & ?d")
+	td := []struct {
+		name string
+		r    highlight.Renderer
+		exp  string
+	}{
+		{"ansi", highlight.ANSI(map[lex.Token]string{tokKeyword: "1", lex.Error: "31"}),
+			"\x1b[1mif\x1b[0m a<b # comment\n\tc & \x1b[31m?\x1b[0md"},
+		{"html", highlight.HTML(map[lex.Token]string{tokKeyword: "kw", tokOp: "op"}),
+			`<span class="kw">if</span> a<span class="op">&lt;</span>b # comment` + "\n\tc " +
+				`<span class="op">&amp;</span> ?d`},
+	}
+	for _, d := range td {
+		l := lex.NewLexer(lex.NewFile(d.name, bytes.NewReader(src)), m.StateFn())
+		var b bytes.Buffer
+		if err := highlight.Render(&b, src, l, d.r); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != d.exp {
+			t.Errorf("%s: got %q, expected %q", d.name, b.String(), d.exp)
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	src := []byte("if a<b\n\tc & \"d\ne\" ")
+	items := []lex.Item{
+		lex.NewItem(tokKeyword, 0, 2, nil),
+		lex.NewItem(tokIdent, 3, 4, nil),
+		lex.NewItem(tokOp, 4, 5, nil),
+		lex.NewItem(tokIdent, 5, 6, nil),
+		lex.NewItem(tokIdent, 8, 9, nil),
+		lex.NewItem(tokOp, 10, 11, nil),
+		lex.NewItem(lex.Error, 12, 17, errors.New("multi-line string")),
+		lex.NewItem(tokEOF, 18, 18, nil),
+	}
+	diags := append(highlight.Errors(items),
+		highlight.Diagnostic{Pos: 3, End: 4, Message: "undefined: a"},
+		highlight.Diagnostic{Pos: 18, End: 18, Message: "missing then"})
+	td := []struct {
+		name string
+		a    highlight.Annotator
+		exp  string
+	}{
+		{"ansi", highlight.AnnotateANSI(map[lex.Token]string{tokKeyword: "1"}),
+			"\x1b[1mif\x1b[0m a<b\n" +
+				"\x1b[1;31m   ~\x1b[0m\n" +
+				"   \x1b[1;31mundefined: a\x1b[0m\n" +
+				"\tc & \"d\n" +
+				"\x1b[1;31m\t    ~~~\x1b[0m\n" +
+				"e\" \n" +
+				"\x1b[1;31m~~ ~\x1b[0m\n" +
+				"\x1b[1;31mmulti-line string\x1b[0m\n" +
+				"   \x1b[1;31mmissing then\x1b[0m\n"},
+		{"html", highlight.AnnotateHTML(map[lex.Token]string{tokKeyword: "kw", tokOp: "op"}),
+			`<span class="kw">if</span> <span class="diag" title="undefined: a">a</span><span class="op">&lt;</span>b` + "\n" +
+				`<span class="diag-message">undefined: a</span>` + "\n" +
+				"\tc " + `<span class="op">&amp;</span> <span class="diag" title="multi-line string">&#34;d</span>` + "\n" +
+				`<span class="diag" title="multi-line string">e&#34;</span>` + " \n" +
+				`<span class="diag-message">multi-line string</span>` + "\n" +
+				`<span class="diag-message">missing then</span>` + "\n"},
+	}
+	for _, d := range td {
+		var b bytes.Buffer
+		if err := highlight.Annotate(&b, src, items, diags, d.a); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != d.exp {
+			t.Errorf("%s: got\n%q\nexpected\n%q", d.name, b.String(), d.exp)
+		}
+	}
+}
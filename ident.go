@@ -0,0 +1,82 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// xidExcluded contains the runes of ID_Start that are not in XID_Start and
+// the runes of ID_Continue that are not in XID_Continue. The only ones that
+// are in XID_Continue are U+0E33, U+0EB3, U+FF9E and U+FF9F.
+//
+var xidExcluded = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x037a, Hi: 0x037a, Stride: 1},
+		{Lo: 0x0e33, Hi: 0x0e33, Stride: 1},
+		{Lo: 0x0eb3, Hi: 0x0eb3, Stride: 1},
+		{Lo: 0x309b, Hi: 0x309c, Stride: 1},
+		{Lo: 0xfc5e, Hi: 0xfc63, Stride: 1},
+		{Lo: 0xfdfa, Hi: 0xfdfb, Stride: 1},
+		{Lo: 0xfe70, Hi: 0xfe7e, Stride: 2},
+		{Lo: 0xff9e, Hi: 0xff9f, Stride: 1},
+	},
+}
+
+// IsIdentifierStart reports whether r can start an identifier according to
+// Unicode Standard Annex #31, that is whether r has the XID_Start property.
+//
+// XID_Start does not include '_'. Languages that allow identifiers to start
+// with an underscore or other characters must check for them separately.
+//
+func IsIdentifierStart(r rune) bool {
+	if r < utf8.RuneSelf {
+		return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+	}
+	return unicode.In(r, unicode.L, unicode.Nl, unicode.Other_ID_Start) &&
+		!unicode.In(r, unicode.Pattern_Syntax, unicode.Pattern_White_Space, xidExcluded)
+}
+
+// IsIdentifierContinue reports whether r can continue an identifier according
+// to Unicode Standard Annex #31, that is whether r has the XID_Continue
+// property. XID_Continue is a superset of XID_Start that includes digits,
+// combining marks and connector punctuation like '_'.
+//
+func IsIdentifierContinue(r rune) bool {
+	if r < utf8.RuneSelf {
+		return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '_'
+	}
+	switch r {
+	case 0x0e33, 0x0eb3, 0xff9e, 0xff9f:
+		return true
+	}
+	return unicode.In(r, unicode.L, unicode.Nl, unicode.Other_ID_Start,
+		unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue) &&
+		!unicode.In(r, unicode.Pattern_Syntax, unicode.Pattern_White_Space, xidExcluded)
+}
+
+// Identifier classes for use with State.AcceptWhileClass. See
+// IsIdentifierStart and IsIdentifierContinue.
+//
+var (
+	IdentifierStart    = ClassFunc(IsIdentifierStart)
+	IdentifierContinue = ClassFunc(IsIdentifierContinue)
+)
@@ -0,0 +1,41 @@
+package lex_test
+
+import (
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestIdentifier(t *testing.T) {
+	td := []struct {
+		r           rune
+		start, cont bool
+	}{
+		{'a', true, true},
+		{'_', false, true},
+		{'7', false, true},
+		{'$', false, false},
+		{'é', true, true},
+		{'\u0301', false, true}, // combining acute accent
+		{'·', false, true},      // middle dot, Other_ID_Continue
+		{'℘', true, true},       // script capital P, Other_ID_Start
+		{'Ⅰ', true, true},       // roman numeral one, Nl
+		{'\u037a', false, false},
+		{'\u0e33', false, true},
+		{'\ufe70', false, false},
+		{'\ufe71', true, true},
+		{'\u2e2f', false, false}, // vertical tilde, Pattern_Syntax
+		{' ', false, false},
+	}
+	for _, d := range td {
+		if s := lex.IsIdentifierStart(d.r); s != d.start {
+			t.Errorf("IsIdentifierStart(%U) = %v, expected %v", d.r, s, d.start)
+		}
+		if c := lex.IsIdentifierContinue(d.r); c != d.cont {
+			t.Errorf("IsIdentifierContinue(%U) = %v, expected %v", d.r, c, d.cont)
+		}
+		if lex.IdentifierContinue.Contains(d.r) != d.cont {
+			t.Errorf("IdentifierContinue.Contains(%U) != %v", d.r, d.cont)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+)
+
+// checkpointInterval is the minimum distance in bytes between two checkpoints
+// of an Incremental lexer.
+//
+const checkpointInterval = 256
+
+// An Incremental lexer keeps the token stream of an in-memory input up to
+// date as the input is edited, as needed by editors and language servers.
+//
+// Edits are re-lexed from the nearest checkpoint before the edit. A checkpoint
+// is a point between two state function calls where the lexer has no current
+// state function and no pending tokens. At such a point, the tokens that
+// follow only depend on the input that follows and on the initial state
+// function, which is recorded along with the checkpoint in order to support
+// Lexer.Init. Re-lexing stops as soon as the lexer reaches a checkpoint of the
+// previous token stream past the edit, where the old and new streams converge.
+//
+// This assumes that state functions called without a current state (i.e. the
+// initial state function) do not depend on runes read before they are called,
+// with State.Backup or State.Current, nor on state kept across calls. Initial
+// state functions are compared by their code only: different closures of the
+// same function are considered identical.
+//
+type Incremental struct {
+	name  string
+	opts  []Option
+	src   []byte
+	items []Item
+	cps   []checkpoint
+}
+
+type checkpoint struct {
+	offs int     // offset of the next rune to be read
+	read int     // offset just past the input read so far
+	item int     // index of the next token
+	init StateFn // initial state function
+}
+
+// NewIncremental returns an Incremental lexer for src and lexes it. The name,
+// init and opts arguments are the same as for NewFile and NewLexer. src is
+// copied.
+//
+func NewIncremental(name string, src []byte, init StateFn, opts ...Option) *Incremental {
+	inc := &Incremental{
+		name: name,
+		opts: opts,
+		src:  append([]byte(nil), src...),
+	}
+	start := checkpoint{init: init}
+	inc.items, inc.cps, _ = inc.lex(start, -1, 0, nil)
+	inc.cps = append([]checkpoint{start}, inc.cps...)
+	return inc
+}
+
+// Source returns the current input. It must not be modified.
+//
+func (inc *Incremental) Source() []byte {
+	return inc.src
+}
+
+// Items returns the current token stream, including the EOF token. It must not
+// be modified and is only valid until the next call to Edit.
+//
+func (inc *Incremental) Items() []Item {
+	return inc.items
+}
+
+// Edit replaces del bytes of input at offset off with text and updates the
+// token stream. The tokens in Items()[start:newEnd] replace the tokens in the
+// range [start, oldEnd) of the token stream before the edit. The tokens that
+// follow have been kept and their offsets adjusted. Edit panics if off and del
+// do not describe a range of the current input.
+//
+func (inc *Incremental) Edit(off, del int, text []byte) (start, oldEnd, newEnd int) {
+	if off < 0 || del < 0 || off+del > len(inc.src) {
+		panic("lex: edit out of range")
+	}
+	src := make([]byte, 0, len(inc.src)-del+len(text))
+	src = append(src, inc.src[:off]...)
+	src = append(src, text...)
+	inc.src = append(src, inc.src[off+del:]...)
+
+	// restart from the last checkpoint that did not read the edited input. The
+	// first checkpoint is always valid.
+	i := sort.Search(len(inc.cps), func(i int) bool { return inc.cps[i].read >= off }) - 1
+	if i < 0 {
+		i = 0
+	}
+	cp := inc.cps[i]
+	old := inc.cps[i+1:]
+	delta := len(text) - del
+	items, cps, j := inc.lex(cp, off+len(text), delta, old)
+
+	start = cp.item
+	newEnd = start + len(items)
+	oldEnd = len(inc.items)
+	var tail []Item
+	if j >= 0 {
+		oldEnd = old[j].item
+		tail = inc.items[oldEnd:]
+	}
+	nitems := make([]Item, 0, newEnd+len(tail))
+	nitems = append(nitems, inc.items[:start]...)
+	nitems = append(nitems, items...)
+	for _, it := range tail {
+		it.Pos += delta
+		it.End += delta
+		nitems = append(nitems, it)
+	}
+
+	ncps := append(inc.cps[:i+1:i+1], cps...)
+	if j >= 0 {
+		for _, c := range old[j:] {
+			c.offs += delta
+			c.read += delta
+			c.item += newEnd - oldEnd
+			ncps = append(ncps, c)
+		}
+	}
+	inc.items, inc.cps = nitems, ncps
+	return start, oldEnd, newEnd
+}
+
+// lex lexes the input from checkpoint cp and returns the tokens and
+// checkpoints found. If end >= 0, lexing stops at the first checkpoint at or
+// after end that matches a checkpoint in old, whose offsets are delta bytes
+// before, and the index in old of that checkpoint is returned. Otherwise, lex
+// proceeds until the end of input and returns -1.
+//
+func (inc *Incremental) lex(cp checkpoint, end, delta int, old []checkpoint) (items []Item, cps []checkpoint, j int) {
+	l := NewLexer(NewFile(inc.name, bytes.NewReader(inc.src[cp.offs:])), cp.init, inc.opts...)
+	defer l.Release()
+	s := (*State)(l)
+	last := cp.offs
+	for {
+		s.step()
+		for l.count > 0 {
+			it := l.pop()
+			it.Pos += cp.offs
+			it.End += cp.offs
+			items = append(items, it)
+		}
+		if s.state != nil || len(s.pending) > 0 {
+			continue
+		}
+		u := s.undo[s.ur]
+		if u.r == EOF {
+			return items, cps, -1
+		}
+		if u.p < 0 && s.offs+s.r > 0 {
+			// backed up past the start of the undo buffer
+			continue
+		}
+		c := checkpoint{
+			offs: cp.offs + u.p + u.s,
+			read: cp.offs + s.offs + s.r,
+			item: cp.item + len(items),
+			init: s.init,
+		}
+		if end >= 0 && c.offs >= end {
+			k := sort.Search(len(old), func(k int) bool { return old[k].offs+delta >= c.offs })
+			if k < len(old) && old[k].offs+delta == c.offs && sameFunc(old[k].init, c.init) {
+				return items, cps, k
+			}
+		}
+		if c.offs-last >= checkpointInterval {
+			cps = append(cps, c)
+			last = c.offs
+		}
+	}
+}
+
+func sameFunc(f, g StateFn) bool {
+	return reflect.ValueOf(f).Pointer() == reflect.ValueOf(g).Pointer()
+}
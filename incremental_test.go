@@ -0,0 +1,93 @@
+package lex_test
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+const (
+	tokIncWord lex.Token = iota + 1
+	tokIncString
+)
+
+// lexIncremental lexes words and double quoted strings that may span
+// multiple lines.
+//
+func lexIncremental(s *lex.State) lex.StateFn {
+	r := s.Next()
+	pos := s.Pos()
+	switch r {
+	case lex.EOF:
+		s.Emit(pos, tokEOF, nil)
+	case ' ', '\n':
+	case '"':
+		for r = s.Next(); r != '"' && r != lex.EOF; r = s.Next() {
+		}
+		if r == lex.EOF {
+			s.Errorf(pos, "unterminated string")
+			return nil
+		}
+		s.Emit(pos, tokIncString, nil)
+	default:
+		for r = s.Next(); r != ' ' && r != '\n' && r != '"' && r != lex.EOF; r = s.Next() {
+		}
+		s.Backup()
+		s.Emit(pos, tokIncWord, nil)
+	}
+	return nil
+}
+
+func lexAllItems(src []byte) []lex.Item {
+	var items []lex.Item
+	l := lex.NewLexer(lex.NewFile("test", bytes.NewReader(src)), lexIncremental)
+	for !l.AtEOF() {
+		items = append(items, l.LexItem())
+	}
+	return items
+}
+
+func TestIncremental(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	const chars = "abc  \n\""
+	randBytes := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = chars[rng.Intn(len(chars)-1)]
+			if rng.Intn(100) == 0 {
+				b[i] = '"'
+			}
+		}
+		return b
+	}
+	src := randBytes(8 << 10)
+	inc := lex.NewIncremental("test", src, lexIncremental)
+	if !reflect.DeepEqual(inc.Items(), lexAllItems(src)) {
+		t.Fatal("initial token stream mismatch")
+	}
+	for i := 0; i < 500; i++ {
+		prev := append([]lex.Item(nil), inc.Items()...)
+		off := rng.Intn(len(src) + 1)
+		del := rng.Intn(8)
+		if off+del > len(src) {
+			del = len(src) - off
+		}
+		text := randBytes(rng.Intn(8))
+		src = append(src[:off:off], append(text, src[off+del:]...)...)
+		start, oldEnd, newEnd := inc.Edit(off, del, text)
+		exp := lexAllItems(src)
+		if !bytes.Equal(inc.Source(), src) {
+			t.Fatalf("edit %d: source mismatch", i)
+		}
+		got := inc.Items()
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("edit %d (%d, %d, %q): token stream mismatch", i, off, del, text)
+		}
+		if !reflect.DeepEqual(got[:start], prev[:start]) || len(got)-newEnd != len(prev)-oldEnd {
+			t.Fatalf("edit %d: bad change range [%d, %d) -> [%d, %d)", i, start, oldEnd, start, newEnd)
+		}
+	}
+}
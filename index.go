@@ -0,0 +1,135 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import "sort"
+
+// A TokenIndex answers position queries on a token stream, like finding the
+// token at the cursor position in an editor.
+//
+// A token covers the offsets in [Pos, End). Empty tokens, like EOF, cover
+// their offset only. Tokens may overlap, as Error tokens often cover part of
+// another token. Overlapping tokens are stored in separate layers, each of
+// which is searched in O(log n). Since the tokens of a lexer seldom overlap,
+// there are usually no more than two layers.
+//
+type TokenIndex struct {
+	items []Item      // all tokens, sorted by offset
+	layer []Item      // non-overlapping tokens, sorted by offset
+	next  *TokenIndex // tokens that overlap tokens in layer
+}
+
+// NewTokenIndex returns an index of items. items is copied and sorted by
+// offset. Error tokens are sorted after other tokens at the same offset.
+//
+func NewTokenIndex(items []Item) *TokenIndex {
+	return newTokenIndex(append([]Item(nil), items...), false)
+}
+
+func newTokenIndex(items []Item, sorted bool) *TokenIndex {
+	if !sorted {
+		sort.SliceStable(items, func(i, j int) bool { return itemLess(items[i], items[j]) })
+	}
+	x := &TokenIndex{items: items}
+	var rest []Item
+	last := 0
+	for _, it := range items {
+		if len(x.layer) > 0 && it.Pos < last {
+			rest = append(rest, it)
+			continue
+		}
+		x.layer = append(x.layer, it)
+		last = tokenEnd(it)
+	}
+	if len(rest) > 0 {
+		x.next = newTokenIndex(rest, true)
+	}
+	return x
+}
+
+// itemLess orders tokens by offset, with Error tokens after other tokens at the
+// same offset.
+//
+func itemLess(a, b Item) bool {
+	return a.Pos < b.Pos || a.Pos == b.Pos && a.Type != Error && b.Type == Error
+}
+
+// tokenEnd returns the end of the range covered by it.
+//
+func tokenEnd(it Item) int {
+	if it.End > it.Pos {
+		return it.End
+	}
+	return it.Pos + 1
+}
+
+// Items returns the indexed tokens, sorted by offset.
+//
+func (x *TokenIndex) Items() []Item {
+	return x.items
+}
+
+// At returns the token that covers offset. If several tokens cover it, At
+// prefers tokens other than Error, then the token that starts last. It returns
+// false if no token covers offset.
+//
+func (x *TokenIndex) At(offset int) (Item, bool) {
+	var (
+		r     Item
+		found bool
+	)
+	for ; x != nil; x = x.next {
+		i := sort.Search(len(x.layer), func(i int) bool { return x.layer[i].Pos > offset }) - 1
+		if i < 0 {
+			continue
+		}
+		it := x.layer[i]
+		if tokenEnd(it) <= offset {
+			continue
+		}
+		if !found || r.Type == Error && it.Type != Error || (r.Type == Error) == (it.Type == Error) && it.Pos > r.Pos {
+			r, found = it, true
+		}
+	}
+	return r, found
+}
+
+// Range returns the tokens that intersect the range [start, end), sorted like
+// Items.
+//
+func (x *TokenIndex) Range(start, end int) []Item {
+	if end <= start {
+		return nil
+	}
+	var r []Item
+	layers := 0
+	for ; x != nil; x = x.next {
+		i := sort.Search(len(x.layer), func(i int) bool { return tokenEnd(x.layer[i]) > start })
+		j := sort.Search(len(x.layer), func(j int) bool { return x.layer[j].Pos >= end })
+		if i < j {
+			r = append(r, x.layer[i:j]...)
+			layers++
+		}
+	}
+	if layers > 1 {
+		sort.SliceStable(r, func(i, j int) bool { return itemLess(r[i], r[j]) })
+	}
+	return r
+}
@@ -0,0 +1,69 @@
+package lex_test
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestTokenIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var items []lex.Item
+	for pos := 0; pos < 1000; {
+		n := rng.Intn(5)
+		items = append(items, lex.NewItem(tokChar, pos, pos+n, nil))
+		if rng.Intn(10) == 0 {
+			// errors overlapping the token or spanning several tokens
+			p := pos + rng.Intn(n+1)
+			items = append(items, lex.NewItem(lex.Error, p, p+rng.Intn(20), nil))
+		}
+		pos += n + rng.Intn(2)
+	}
+	items = append(items, lex.NewItem(tokEOF, 1000, 1000, nil))
+	x := lex.NewTokenIndex(items)
+
+	covers := func(it lex.Item, o int) bool {
+		return it.Pos <= o && o < it.End || it.Pos == it.End && it.Pos == o
+	}
+	for o := -1; o <= 1001; o++ {
+		var exp []lex.Item
+		for _, it := range x.Items() {
+			if covers(it, o) {
+				exp = append(exp, it)
+			}
+		}
+		got, ok := x.At(o)
+		if len(exp) == 0 {
+			if ok {
+				t.Fatalf("At(%d): got %v, expected none", o, got)
+			}
+			continue
+		}
+		tok := false
+		for _, it := range exp {
+			tok = tok || it.Type != lex.Error
+		}
+		if !ok || !covers(got, o) || tok && got.Type == lex.Error {
+			t.Fatalf("At(%d): got %v %v, expected one of %v", o, got, ok, exp)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		a := rng.Intn(1010) - 5
+		b := a + 1 + rng.Intn(30)
+		var exp []lex.Item
+		for _, it := range x.Items() {
+			e := it.End
+			if e == it.Pos {
+				e++
+			}
+			if it.Pos < b && e > a {
+				exp = append(exp, it)
+			}
+		}
+		if got := x.Range(a, b); !reflect.DeepEqual(got, exp) {
+			t.Fatalf("Range(%d, %d): got %v, expected %v", a, b, got, exp)
+		}
+	}
+}
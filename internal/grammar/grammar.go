@@ -0,0 +1,219 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package grammar parses lexical grammar files.
+//
+// A grammar file is line oriented. Empty lines and lines starting with '#' are
+// ignored. The other lines are either directives or rules:
+//
+//	package calc        # Go package name of the generated code
+//	eof EOF             # name of the EOF token (defaults to EOF)
+//	mode Default        # start a new mode; rules that come before the first
+//	                    # mode directive belong to mode Default
+//
+// A rule is a token name, a pattern enclosed in back quotes and an optional
+// list of actions:
+//
+//	Number  `[0-9]+`
+//	_       `[ \t\n]+`     skip
+//	LBrace  `\{`           -> Inner
+//
+// The skip action discards the matched text and "-> Mode" switches to the
+// given mode after the token has been emitted. "prio N" sets the priority of
+// the rule to the integer N (see dfa.Rule). The special token name "_" can
+// only be used with the skip action.
+//
+package grammar
+
+import (
+	"bufio"
+	"fmt"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A Grammar is a parsed grammar file.
+//
+type Grammar struct {
+	Package string
+	EOF     string   // name of the EOF token
+	Tokens  []string // token names, EOF first, in order of declaration
+	Modes   []*Mode  // Modes[0] is the initial mode
+}
+
+// A Mode is a named set of rules. Only the rules of the current mode are
+// active.
+//
+type Mode struct {
+	Name  string
+	Rules []Rule
+}
+
+// A Rule associates a pattern with a token.
+//
+type Rule struct {
+	Token    string // token name; "_" for anonymous rules
+	Pattern  string // regular expression
+	Skip     bool   // discard the matched text
+	Mode     string // if not empty, switch to this mode after a match
+	Priority int    // priority over rules matching the same input
+	Line     int    // line number of the rule in the grammar file
+}
+
+// Mode returns the mode with the given name or nil if no such mode exists.
+//
+func (g *Grammar) Mode(name string) *Mode {
+	for _, m := range g.Modes {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// Parse parses a grammar file. The name of the file is only used in error
+// messages.
+//
+func Parse(name string, r io.Reader) (*Grammar, error) {
+	g := &Grammar{EOF: "EOF"}
+	seen := make(map[string]bool)
+	var mode *Mode
+	errorf := func(line int, format string, args ...interface{}) error {
+		return fmt.Errorf("%s:%d: %s", name, line, fmt.Sprintf(format, args...))
+	}
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || l[0] == '#' {
+			continue
+		}
+		word, rest := cut(l)
+		switch word {
+		case "package", "eof", "mode":
+			arg, rest := cut(rest)
+			if !token.IsIdentifier(arg) || (rest != "" && rest[0] != '#') {
+				return nil, errorf(line, "%s directive requires a single identifier", word)
+			}
+			switch word {
+			case "package":
+				g.Package = arg
+			case "eof":
+				if len(g.Tokens) > 0 {
+					return nil, errorf(line, "eof directive must come before any rule")
+				}
+				g.EOF = arg
+			case "mode":
+				if g.Mode(arg) != nil {
+					return nil, errorf(line, "mode %s redeclared", arg)
+				}
+				mode = &Mode{Name: arg}
+				g.Modes = append(g.Modes, mode)
+			}
+			continue
+		}
+
+		// rule
+		ru := Rule{Token: word, Line: line}
+		if word != "_" && !token.IsIdentifier(word) {
+			return nil, errorf(line, "invalid token name %q", word)
+		}
+		if rest == "" || rest[0] != '`' {
+			return nil, errorf(line, "missing pattern for token %s", word)
+		}
+		end := strings.IndexByte(rest[1:], '`')
+		if end < 0 {
+			return nil, errorf(line, "unterminated pattern")
+		}
+		ru.Pattern, rest = rest[1:end+1], strings.TrimSpace(rest[end+2:])
+		for rest != "" && rest[0] != '#' {
+			word, rest = cut(rest)
+			switch word {
+			case "skip":
+				ru.Skip = true
+			case "->":
+				word, rest = cut(rest)
+				if !token.IsIdentifier(word) {
+					return nil, errorf(line, "-> requires a mode name")
+				}
+				ru.Mode = word
+			case "prio":
+				word, rest = cut(rest)
+				p, err := strconv.Atoi(word)
+				if err != nil {
+					return nil, errorf(line, "prio requires an integer")
+				}
+				ru.Priority = p
+			default:
+				return nil, errorf(line, "unknown action %q", word)
+			}
+		}
+		if ru.Token == "_" && !ru.Skip {
+			return nil, errorf(line, "anonymous rules must be skipped")
+		}
+		if mode == nil {
+			mode = &Mode{Name: "Default"}
+			g.Modes = append(g.Modes, mode)
+		}
+		mode.Rules = append(mode.Rules, ru)
+		if ru.Token != "_" && !ru.Skip {
+			if len(g.Tokens) == 0 {
+				g.Tokens = append(g.Tokens, g.EOF)
+				seen[g.EOF] = true
+			}
+			if !seen[ru.Token] {
+				g.Tokens = append(g.Tokens, ru.Token)
+				seen[ru.Token] = true
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if g.Package == "" {
+		return nil, fmt.Errorf("%s: missing package directive", name)
+	}
+	if len(g.Modes) == 0 {
+		return nil, fmt.Errorf("%s: no rules", name)
+	}
+	if len(g.Tokens) == 0 {
+		g.Tokens = append(g.Tokens, g.EOF)
+	}
+	for _, m := range g.Modes {
+		for _, ru := range m.Rules {
+			if ru.Mode != "" && g.Mode(ru.Mode) == nil {
+				return nil, errorf(ru.Line, "undefined mode %s", ru.Mode)
+			}
+		}
+	}
+	return g, nil
+}
+
+// cut splits s at the first white space.
+//
+func cut(s string) (string, string) {
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
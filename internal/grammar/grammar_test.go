@@ -0,0 +1,67 @@
+package grammar_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex/internal/grammar"
+)
+
+func TestParse(t *testing.T) {
+	src := "# test\npackage test\neof End\n\n" +
+		"Num `[0-9]+`\n" +
+		"_   `[ ]+`  skip # comment\n" +
+		"If  `if`    prio 1\n" +
+		"Str `\"`    -> Str\n" +
+		"mode Str\n" +
+		"Chr `[^\"]` \n" +
+		"Str `\"`    -> Default\n"
+	g, err := grammar.Parse("test", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Package != "test" || g.EOF != "End" {
+		t.Fatalf("bad package or eof: %q %q", g.Package, g.EOF)
+	}
+	if exp := []string{"End", "Num", "If", "Str", "Chr"}; !reflect.DeepEqual(g.Tokens, exp) {
+		t.Fatalf("got tokens %v, expected %v", g.Tokens, exp)
+	}
+	if len(g.Modes) != 2 || g.Modes[0].Name != "Default" || g.Modes[1].Name != "Str" {
+		t.Fatalf("bad modes: %v", g.Modes)
+	}
+	exp := []grammar.Rule{
+		{Token: "Num", Pattern: "[0-9]+", Line: 5},
+		{Token: "_", Pattern: "[ ]+", Skip: true, Line: 6},
+		{Token: "If", Pattern: "if", Priority: 1, Line: 7},
+		{Token: "Str", Pattern: `"`, Mode: "Str", Line: 8},
+	}
+	if !reflect.DeepEqual(g.Modes[0].Rules, exp) {
+		t.Fatalf("got rules %v, expected %v", g.Modes[0].Rules, exp)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	td := []struct {
+		src string
+		err string
+	}{
+		{"Num `[0-9]+`", "test: missing package directive"},
+		{"package x", "test: no rules"},
+		{"package x y", "test:1: package directive requires a single identifier"},
+		{"package x\nNum [0-9]+", "test:2: missing pattern for token Num"},
+		{"package x\nNum `[0-9]+", "test:2: unterminated pattern"},
+		{"package x\n_ `a`", "test:2: anonymous rules must be skipped"},
+		{"package x\nA `a` -> B", "test:2: undefined mode B"},
+		{"package x\nA `a` emit", `test:2: unknown action "emit"`},
+		{"package x\nA `a` prio high", "test:2: prio requires an integer"},
+		{"package x\nA `a`\neof E", "test:3: eof directive must come before any rule"},
+		{"package x\nmode A\nmode A", "test:3: mode A redeclared"},
+	}
+	for _, d := range td {
+		_, err := grammar.Parse("test", strings.NewReader(d.src))
+		if err == nil || err.Error() != d.err {
+			t.Errorf("%q: got error %v, expected %q", d.src, err, d.err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonItem is the JSON representation of an Item.
+//
+type jsonItem struct {
+	Type  string      `json:"type"`
+	Start int         `json:"start"`
+	End   int         `json:"end"`
+	Line  int         `json:"line"`
+	Col   int         `json:"col"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// DumpJSON reads all tokens from l and writes them to w as newline delimited
+// JSON objects, one per token:
+//
+//	{"type":"Ident","start":4,"end":7,"line":1,"col":5,"value":"foo"}
+//
+// Token type names are looked up in names, which may be nil. Types not found in
+// names are written as returned by Lexer.TokenName, that is their name set with
+// the TokenNames option or their numeric value.
+// The start and end fields are file offsets, line and col are the position of
+// the start offset as returned by File.Position. The value field is omitted if
+// the token value is nil, error values are written as their message and values
+// that cannot be encoded as JSON are formatted with fmt.Sprint.
+//
+// DumpJSON returns when the lexer has reached the end of input (see AtEOF) or
+// upon the first write error.
+//
+func DumpJSON(w io.Writer, l *Lexer, names map[Token]string) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for !l.AtEOF() {
+		it := l.LexItem()
+		pos := l.File().Position(it.Pos)
+		ji := jsonItem{
+			Type:  names[it.Type],
+			Start: it.Pos,
+			End:   it.End,
+			Line:  pos.Line,
+			Col:   pos.Column,
+			Value: it.Value(),
+		}
+		if ji.Type == "" {
+			ji.Type = l.TokenName(it.Type)
+		}
+		switch v := ji.Value.(type) {
+		case error:
+			ji.Value = v.Error()
+		case nil:
+		default:
+			if _, err := json.Marshal(v); err != nil {
+				ji.Value = fmt.Sprint(v)
+			}
+		}
+		if err := enc.Encode(&ji); err != nil {
+			return err
+		}
+	}
+	return nil
+}
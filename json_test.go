@@ -0,0 +1,46 @@
+package lex_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestDumpJSON(t *testing.T) {
+	f := lex.NewFile("test", strings.NewReader("a\n\x00<b"))
+	l := lex.NewLexer(f, func(s *lex.State) lex.StateFn {
+		switch r := s.Next(); r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case '\n':
+			s.Emit(s.Pos(), tokSpace, nil)
+		case '<':
+			s.Emit(s.Pos(), 42, func() {})
+		default:
+			s.Emit(s.Pos(), tokChar, string(r))
+		}
+		return nil
+	})
+	var b strings.Builder
+	if err := lex.DumpJSON(&b, l, map[lex.Token]string{tokEOF: "EOF", tokChar: "Char"}); err != nil {
+		t.Fatal(err)
+	}
+	exp := `{"type":"Char","start":0,"end":1,"line":1,"col":1,"value":"a"}
+{"type":"1","start":1,"end":2,"line":1,"col":2}
+{"type":"Error","start":2,"end":3,"line":2,"col":1,"value":"invalid NUL character"}
+`
+	if got := b.String(); !strings.HasPrefix(got, exp) {
+		t.Fatalf("got:\n%s\nexpected prefix:\n%s", got, exp)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("got %d lines, expected 6", len(lines))
+	}
+	if !strings.HasPrefix(lines[3], `{"type":"42","start":3,"end":4,"line":2,"col":2,"value":"0x`) {
+		t.Errorf("got %s", lines[3])
+	}
+	if exp := `{"type":"EOF","start":5,"end":5,"line":2,"col":4}`; lines[5] != exp {
+		t.Errorf("got %s, expected %s", lines[5], exp)
+	}
+}
@@ -20,9 +20,14 @@
 package lex
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 	"unicode/utf8"
 )
 
@@ -42,6 +47,25 @@ var (
 	ErrInvalidBOM  = &EncodingError{"invalid BOM in the middle of the file"}
 )
 
+// A ReadError is emitted by State.Next when reading from the input fails with
+// an error other than io.EOF. Err is the error returned by the input reader or
+// by the retry policy of the lexer (see Retry). In particular, lexers give up
+// on readers that make no progress with a ReadError wrapping io.ErrNoProgress:
+//
+//	if errors.Is(it.Err(), io.ErrNoProgress) {
+//		// ...
+//	}
+//
+type ReadError struct {
+	Err error
+}
+
+func (e *ReadError) Error() string { return e.Err.Error() }
+
+// Unwrap returns e.Err.
+//
+func (e *ReadError) Unwrap() error { return e.Err }
+
 // ErrInvalidUnreadRune is returned by State.UnreadRune if the undo buffer is
 // empty.
 //
@@ -66,48 +90,252 @@ type Token int
 //
 const Error Token = -1
 
-// queue is a FIFO queue.
+// An Item is a token as returned by Lexer.LexItem.
 //
-type queue struct {
-	items []item
-	head  int
-	tail  int
-	count int
+// Token values emitted with the typed emit methods of State (EmitRune,
+// EmitString, EmitInt64) are stored without being converted to an interface
+// value: they can be retrieved without allocation with the Rune, Str and Int64
+// methods. Value returns the token value as an interface regardless of the
+// method used to emit it.
+//
+type Item struct {
+	Type Token
+	Pos  int // file offset of the first byte of the token
+	End  int // file offset just past the last byte of the token
+	kind valueKind
+	n    int64
+	s    string
+	v    interface{}
 }
 
-type item struct {
-	t Token
-	p int
-	v interface{}
+type valueKind uint8
+
+const (
+	valIface valueKind = iota
+	valRune
+	valString
+	valInt64
+)
+
+// NewItem returns a new Item with the given type, offsets and value.
+//
+func NewItem(t Token, pos, end int, value interface{}) Item {
+	return Item{Type: t, Pos: pos, End: end, v: value}
+}
+
+// Value returns the token value.
+//
+func (it Item) Value() interface{} {
+	switch it.kind {
+	case valRune:
+		return rune(it.n)
+	case valString:
+		return it.s
+	case valInt64:
+		return it.n
+	}
+	return it.v
+}
+
+// Rune returns the token value if it is a rune.
+//
+func (it Item) Rune() (rune, bool) {
+	if it.kind == valRune {
+		return rune(it.n), true
+	}
+	r, ok := it.v.(rune)
+	return r, ok
+}
+
+// Str returns the token value if it is a string.
+//
+func (it Item) Str() (string, bool) {
+	if it.kind == valString {
+		return it.s, true
+	}
+	s, ok := it.v.(string)
+	return s, ok
+}
+
+// Int64 returns the token value if it is an int64.
+//
+func (it Item) Int64() (int64, bool) {
+	if it.kind == valInt64 {
+		return it.n, true
+	}
+	n, ok := it.v.(int64)
+	return n, ok
+}
+
+// Err returns the token value if it is an error. This is always the case for
+// Error tokens.
+//
+func (it Item) Err() error {
+	err, _ := it.v.(error)
+	return err
+}
+
+// String returns the offsets, type and value of it, like
+//
+//	[4,7) Ident "foo"
+//
+// The type is formatted with Token.String. Strings and runes are quoted, as
+// well as error messages. Nil values are omitted and other values are
+// formatted with fmt.Sprint. See File.FormatItem for a version that includes
+// the position of the token.
+//
+func (it Item) String() string {
+	return it.Named(it.Type.String())
+}
+
+// Named returns the string representation of it like String, with its type
+// written as name. Use it with Lexer.TokenName to get the names set with the
+// TokenNames option:
+//
+//	fmt.Println(it.Named(l.TokenName(it.Type)))
+//
+func (it Item) Named(name string) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	b.WriteString(strconv.Itoa(it.Pos))
+	b.WriteByte(',')
+	b.WriteString(strconv.Itoa(it.End))
+	b.WriteString(") ")
+	b.WriteString(name)
+	switch v := it.Value().(type) {
+	case nil:
+	case string:
+		b.WriteString(" " + strconv.Quote(v))
+	case rune:
+		b.WriteString(" " + strconv.QuoteRune(v))
+	case error:
+		b.WriteString(" " + strconv.Quote(v.Error()))
+	default:
+		fmt.Fprint(&b, " ", v)
+	}
+	return b.String()
 }
 
-func (q *queue) push(t Token, p int, v interface{}) {
-	if t == Error {
-		if _, ok := v.(error); !ok {
+// queue is a FIFO queue.
+//
+type queue struct {
+	items   []Item
+	head    int
+	tail    int
+	count   int
+	pending []Item        // deferred encoding errors
+	counts  map[Token]int // token counts, if stats are enabled
+	check   func(Item)    // item validation and tracing, if enabled
+	max     int           // maximum number of items, if full is not nil
+	full    func(*Item) bool
+	chans   map[Token]TokenChannel  // token channels, if enabled
+	side    map[TokenChannel][]Item // tokens not on the default channel
+}
+
+// push pushes it to the queue. If encoding errors have been deferred, those
+// that occurred before the offset of it are pushed first, and the others right
+// after it.
+//
+func (q *queue) push(it Item) {
+	if it.Type == Error {
+		if _, ok := it.v.(error); !ok {
 			panic("token value must implement the error interface for Error tokens")
 		}
 	}
+	if len(q.pending) > 0 {
+		p := q.pending
+		i := 0
+		for ; i < len(p) && p[i].Pos < it.Pos; i++ {
+			q.add(p[i])
+		}
+		q.add(it)
+		for ; i < len(p); i++ {
+			q.add(p[i])
+		}
+		q.clearPending()
+		return
+	}
+	q.add(it)
+}
+
+// flushPending pushes all deferred errors.
+//
+func (q *queue) flushPending() {
+	for _, it := range q.pending {
+		q.add(it)
+	}
+	q.clearPending()
+}
+
+func (q *queue) clearPending() {
+	for i := range q.pending {
+		q.pending[i] = Item{}
+	}
+	q.pending = q.pending[:0]
+}
+
+func (q *queue) add(it Item) {
+	c := DefaultChannel
+	if q.chans != nil {
+		c = q.chans[it.Type]
+	}
+	if c == DefaultChannel && q.full != nil && q.count >= q.max && !q.full(&it) {
+		return
+	}
+	if q.counts != nil {
+		q.counts[it.Type]++
+	}
+	if q.check != nil {
+		q.check(it)
+	}
+	if c != DefaultChannel {
+		q.route(c, it)
+		return
+	}
 	if q.head == q.tail && q.count > 0 {
-		items := make([]item, len(q.items)*2)
+		items := make([]Item, len(q.items)*2)
 		copy(items, q.items[q.head:])
 		copy(items[len(q.items)-q.head:], q.items[:q.head])
 		q.head = 0
 		q.tail = len(q.items)
 		q.items = items
 	}
-	q.items[q.tail] = item{t, p, v}
+	q.items[q.tail] = it
 	q.tail = (q.tail + 1) % len(q.items)
 	q.count++
 }
 
 // pop pops the first item from the queue. Callers must check that q.count > 0 beforehand.
 //
-func (q *queue) pop() (Token, int, interface{}) {
+func (q *queue) pop() Item {
 	i := q.head
 	q.head = (q.head + 1) % len(q.items)
 	q.count--
-	it := &q.items[i]
-	return it.t, it.p, it.v
+	it := q.items[i]
+	q.items[i].s, q.items[i].v = "", nil
+	return it
+}
+
+// popN pops up to len(dst) items from the queue into dst and returns the number
+// of items popped.
+//
+func (q *queue) popN(dst []Item) int {
+	n := 0
+	for n < len(dst) && q.count > 0 {
+		end := q.head + q.count
+		if end > len(q.items) {
+			end = len(q.items)
+		}
+		seg := q.items[q.head:end]
+		k := copy(dst[n:], seg)
+		for i := range seg[:k] {
+			seg[i].s, seg[i].v = "", nil
+		}
+		n += k
+		q.head = (q.head + k) % len(q.items)
+		q.count -= k
+	}
+	return n
 }
 
 // Lexer wraps the public methods of a lexer. This interface is intended for
@@ -115,6 +343,16 @@ func (q *queue) pop() (Token, int, interface{}) {
 //
 type Lexer state
 
+// A TokenSource is a source of tokens. Parsers should consume tokens through a
+// TokenSource rather than a *Lexer so that they can be fed from a Lexer, a
+// wrapper around another scanner or a test stub equally well.
+//
+type TokenSource interface {
+	Lex() (Token, int, interface{})
+}
+
+var _ TokenSource = (*Lexer)(nil)
+
 // State holds the internal state of the lexer while processing a given input.
 // Note that the public fields should only be accessed from custom StateFn
 // functions.
@@ -125,21 +363,252 @@ type undo struct {
 	p int
 	r rune
 	s int
+	t int // length of the token text up to this rune, if captured
 }
 
 type state struct {
-	buf    [4 << 10]byte          // byte buffer
-	undo   [BackupBufferSize]undo // undo buffer
-	queue                         // Item queue
-	f      *File
-	line   int     // line count
-	state  StateFn // current state
-	init   StateFn // current initial-state function.
-	offs   int     // offset of first byte in buffer
-	r, w   int     // read/write indices
-	ur, uh int     // undo buffer read pos and head
-	ts     int     // token start offset
-	ioErr  error   // if not nil, IO error @w
+	buf     []byte                 // byte buffer, allocated on first read
+	bufSize int                    // size of buf
+	undo    [BackupBufferSize]undo // undo buffer
+	queue                          // Item queue
+	f       *File
+	line    int         // line count
+	state   StateFn     // current state
+	init    StateFn     // current initial-state function.
+	offs    int         // offset of first byte in buffer
+	r, w    int         // read/write indices
+	ur, uh  int         // undo buffer read pos and head
+	ts      int         // token start offset
+	capt    bool        // capture the text of the current token
+	text    []byte      // text of the current token
+	ioErr   error       // if not nil, IO error @w
+	lazy    bool        // record lines lazily
+	ls      int         // in lazy mode, lines are recorded up to buf[ls]
+	stats   *stats      // performance counters, if enabled
+	nl      Newline     // recognized line terminators
+	retry   RetryPolicy // retry policy for empty reads
+	defErrs bool        // defer encoding errors
+	v       *validator  // validator, if enabled
+	trace   *tracer     // tracer, if enabled
+	rec     *recorder   // input recorder, if enabled
+	ll      *lossless   // filler token state, if enabled
+	nf      *normalizer // input normalizer, if enabled
+	dec     *decoder    // input decoder, if enabled
+	sc      *screen     // identifier and string screening, if enabled
+	bidi    BidiPolicy  // bidi control characters policy
+	lim     *limiter    // token queue limit, if enabled
+	incompl bool        // input ended in the middle of a construct
+
+	names map[Token]string // token type names, if set
+}
+
+// Buffer sizes.
+//
+const (
+	DefaultBufferSize = 4 << 10 // default size of the input buffer
+	MinBufferSize     = 16      // minimum size of the input buffer
+)
+
+// An Option configures a Lexer. Options describe themselves with String,
+// which returns the call of the option function that created them, like
+// "lex.BufferSize(16)".
+//
+type Option struct {
+	name  string        // name of the option function
+	args  []interface{} // arguments of the option function
+	set   func(*state)
+	debug bool // the option does not change the tokens produced
+}
+
+// option returns an Option that configures a lexer with set. name and args are
+// the name and arguments of the option function.
+//
+func option(set func(*state), name string, args ...interface{}) Option {
+	return Option{name: name, args: args, set: set}
+}
+
+// debugOption is like option for options that do not change the tokens
+// produced from a given input, like tracing or statistics. These options are
+// not recorded by Record.
+//
+func debugOption(set func(*state), name string, args ...interface{}) Option {
+	return Option{name: name, args: args, set: set, debug: true}
+}
+
+// String returns the call of the option function that created o, with its
+// arguments formatted with the %v verb of package fmt.
+//
+func (o Option) String() string {
+	var b strings.Builder
+	b.WriteString("lex." + o.name + "(")
+	for i, a := range o.args {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprint(&b, a)
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// BufferSize sets the size in bytes of the input buffer. The default is
+// DefaultBufferSize. Sizes smaller than MinBufferSize are rounded up to
+// MinBufferSize. Small buffers reduce the memory footprint of lexers for short
+// inputs, large buffers reduce the number of calls to the Read method of the
+// input file.
+//
+// The buffer is allocated when the lexer first reads from its input.
+//
+func BufferSize(n int) Option {
+	return option(func(s *state) {
+		if n < MinBufferSize {
+			n = MinBufferSize
+		}
+		s.bufSize = n
+	}, "BufferSize", n)
+}
+
+// LazyLines enables lazy recording of line information. By default, the lexer
+// calls File.AddLine every time State.Next reads a newline. With LazyLines, the
+// input buffer is instead scanned for newlines in bulk, just before it is
+// refilled or when line information is requested with File.Position or
+// File.LineOffset. This speeds up lexing of newline-dense inputs when
+// positions are seldom needed.
+//
+// Line information is still available at any time and File.Position returns
+// the same results in both modes. However, File.AddLine must not be called
+// while the lexer is in use.
+//
+func LazyLines() Option {
+	return option(func(s *state) {
+		s.lazy = true
+	}, "LazyLines")
+}
+
+// Newline is a set of line terminators recognized by the lexer in addition to
+// '\n'. See Newlines.
+//
+type Newline uint8
+
+// Line terminators.
+//
+const (
+	NewlineCRLF    Newline = 1 << iota // "\r\n"
+	NewlineCR                          // a '\r' not followed by '\n'
+	NewlineUnicode                     // U+0085 (NEL), U+2028 (LS) and U+2029 (PS)
+
+	newlineCR = NewlineCRLF | NewlineCR
+)
+
+// Newlines sets the line terminators recognized by the lexer in addition to
+// '\n' (the default), for example NewlineCRLF|NewlineCR for files with classic
+// Mac or mixed line endings. Recognized line terminators start a new line in
+// the line table of the input File and are returned by State.Next as a single
+// '\n' rune, so that state functions only need to check for '\n' and '\r'
+// does not end up in token values. The size returned by State.ReadRune is the
+// size of the line terminator in the input, so token offsets remain accurate.
+//
+// The LazyLines option is ignored if any line terminator other than '\n' is
+// enabled.
+//
+func Newlines(nl Newline) Option {
+	return option(func(s *state) {
+		s.nl = nl
+	}, "Newlines", nl)
+}
+
+// String returns the names of the line terminators in nl, separated by '|'.
+//
+func (nl Newline) String() string {
+	var names []string
+	for i, n := range [...]string{"NewlineCRLF", "NewlineCR", "NewlineUnicode"} {
+		if nl&(1<<i) != 0 {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		return "0"
+	}
+	return strings.Join(names, "|")
+}
+
+// A RetryPolicy decides what to do when a Read from the input of a lexer
+// returns no data and no error. It is called with the number of consecutive
+// empty reads so far and returns nil to retry or a non-nil error to give up.
+// The error is then returned by State.ReadRune and emitted by State.Next as a
+// ReadError, after which the lexer behaves as if it had reached EOF.
+//
+// A RetryPolicy may block, for example to wait before retrying.
+//
+type RetryPolicy func(n int) error
+
+// MaxRetries returns a RetryPolicy that gives up with io.ErrNoProgress after
+// n consecutive empty reads. This is the default policy with n = 100.
+//
+func MaxRetries(n int) RetryPolicy {
+	return func(i int) error {
+		if i >= n {
+			return io.ErrNoProgress
+		}
+		return nil
+	}
+}
+
+// Backoff returns a RetryPolicy that retries until ctx is done, sleeping
+// between retries for a duration that starts at min and doubles after each
+// empty read, up to max. It gives up with ctx.Err().
+//
+// This is suitable for slow or bursty readers, like network connections or
+// pipes, that may return empty reads while waiting for data.
+//
+func Backoff(ctx context.Context, min, max time.Duration) RetryPolicy {
+	return func(n int) error {
+		d := min
+		for i := 1; i < n && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			return nil
+		}
+	}
+}
+
+// Retry sets the retry policy of the lexer for empty reads. The default is
+// MaxRetries(100).
+//
+func Retry(p RetryPolicy) Option {
+	return debugOption(func(s *state) {
+		s.retry = p
+	}, "Retry", p)
+}
+
+// defaultRetry is the default RetryPolicy.
+//
+var defaultRetry = MaxRetries(100)
+
+// DeferErrors defers the Error tokens automatically emitted by State.Next
+// for invalid input (NUL characters, invalid UTF-8 and misplaced BOMs) until
+// the token being lexed is emitted. Deferred errors are then emitted in input
+// order relative to that token: errors that occurred before its start offset
+// are emitted before it, and errors within it are emitted right after it.
+// Pending errors are also emitted when a state function returns nil without
+// emitting a token, for example after skipping white space.
+//
+// For example, lexing numbers in "1\x002" yields a number token followed by
+// an Error token, instead of the Error token first.
+//
+func DeferErrors() Option {
+	return option(func(s *state) {
+		s.defErrs = true
+	}, "DeferErrors")
 }
 
 // A StateFn is a state function.
@@ -152,26 +621,131 @@ type StateFn func(l *State) StateFn
 // NewLexer creates a new lexer associated with the given source file. A new
 // lexer must be created for every source file to be lexed.
 //
-func NewLexer(f *File, init StateFn) *Lexer {
-	s := &state{
-		// initial q size must be an exponent of 2
-		queue: queue{items: make([]item, 2)},
-		f:     f,
-		line:  1,
-		init:  init,
-		uh:    1,
+// Lexers are allocated from an internal pool. Programs that create many
+// short-lived lexers can call Lexer.Release once done with a lexer so that its
+// buffers are reused by subsequent calls to NewLexer.
+//
+// The lexer is configured with the given options, if any.
+//
+func NewLexer(f *File, init StateFn, opts ...Option) *Lexer {
+	s := statePool.Get().(*state)
+	s.bufSize = DefaultBufferSize
+	s.lazy = false
+	s.stats = nil
+	s.nl = 0
+	s.retry = defaultRetry
+	s.defErrs = false
+	s.v = nil
+	s.trace = nil
+	s.rec = nil
+	s.ll = nil
+	s.nf = nil
+	s.dec = nil
+	s.sc = nil
+	s.bidi = BidiAllow
+	s.lim = nil
+	s.chans = nil
+	s.names = nil
+	for _, o := range opts {
+		if o.set != nil {
+			o.set(s)
+		}
+	}
+	if s.nl != 0 || s.dec != nil {
+		s.lazy = false
+	}
+	if len(s.buf) != s.bufSize {
+		s.buf = nil
+	}
+	s.queue = queue{items: s.items, pending: s.pending, chans: s.chans}
+	if s.stats != nil {
+		s.counts = s.stats.tokens
+	}
+	if s.v != nil {
+		s.initValidator()
 	}
+	if s.trace != nil {
+		s.initTrace()
+	}
+	if s.rec != nil {
+		s.initRecorder(opts)
+	}
+	if s.ll != nil {
+		s.initLossless()
+	}
+	if s.sc != nil {
+		s.initScreen()
+	}
+	if s.lim != nil {
+		s.initLimit()
+	}
+	if s.nf != nil {
+		s.nf.reset()
+	}
+	if s.dec != nil {
+		s.dec.reset()
+	}
+	s.f = f
+	s.line = 1
+	s.state = nil
+	s.init = init
+	s.offs, s.r, s.w = 0, 0, 0
+	s.ur, s.uh = 0, 1
+	s.ts = 0
+	s.capt = false
+	s.incompl = false
+	s.ioErr = nil
+	s.ls = 0
 
 	// add line 1 to file
 	f.AddLine(0, 1)
+	if s.lazy {
+		f.sync = (*State)(s).syncLines
+	}
 	// sentinel values
 	for i := range s.undo {
-		s.undo[i] = undo{-1, utf8.RuneSelf, 1}
+		s.undo[i] = undo{-1, utf8.RuneSelf, 1, 0}
 	}
 
 	return (*Lexer)(s)
 }
 
+// maxPooledQueue is the maximum size of the token queue of lexers returned to
+// the pool. Larger queues are released to the garbage collector.
+//
+const maxPooledQueue = 1024
+
+var statePool = sync.Pool{
+	New: func() interface{} {
+		// initial q size must be an exponent of 2
+		return &state{queue: queue{items: make([]Item, 2)}}
+	},
+}
+
+// Release returns the lexer to the internal pool used by NewLexer. Neither the
+// lexer nor any State pointer obtained from it can be used after calling
+// Release. Calling Release is optional: lexers that are not released are
+// garbage collected as usual.
+//
+func (l *Lexer) Release() {
+	if len(l.items) > maxPooledQueue {
+		l.items = make([]Item, 2)
+	} else {
+		for i := range l.items {
+			l.items[i] = Item{}
+		}
+	}
+	l.clearPending()
+	l.counts, l.check, l.v, l.trace, l.rec, l.ll, l.nf, l.dec, l.sc, l.lim = nil, nil, nil, nil, nil, nil, nil, nil, nil, nil
+	l.full, l.chans, l.side, l.names = nil, nil, nil, nil
+	if l.lazy {
+		(*State)(l).syncLines()
+		l.f.sync = nil
+	}
+	l.f, l.state, l.init, l.ioErr, l.stats, l.retry = nil, nil, nil, nil, nil, nil
+	statePool.Put((*state)(l))
+}
+
 // Init (re-)sets the initial state function for the lexer. It can be used by
 // state functions to implement context switches (e.g. switch from accepting
 // plain text to expressions in a template-like language). This function returns
@@ -191,17 +765,100 @@ func (s *State) Init(initState StateFn) StateFn {
 // io.EOF as a value.
 //
 func (l *Lexer) Lex() (Token, int, interface{}) {
+	it := l.LexItem()
+	return it.Type, it.Pos, it.Value()
+}
+
+// LexItem is like Lex but returns the token as an Item, which includes the end
+// offset of the token.
+//
+// The end offset is computed when the token is emitted: it is the offset just
+// past the last rune returned by State.Next (and not reverted by State.Backup)
+// or the token offset if greater. As a result, state functions should call
+// Backup before Emit when they read one rune past the end of a token.
+//
+func (l *Lexer) LexItem() Item {
 	for l.count == 0 {
-		st := (*State)(l)
-		if l.state == nil {
-			l.state = l.init(st)
-		} else {
-			l.state = l.state(st)
-		}
+		(*State)(l).step()
 	}
 	return l.pop()
 }
 
+// LexBatch fills dst with as many tokens as possible and returns the number of
+// tokens stored in dst. It is equivalent to calling LexItem len(dst) times,
+// except that it stops early when AtEOF becomes true. As a result, LexBatch
+// returns fewer than len(dst) tokens only at the end of input.
+//
+// Like LexItem, LexBatch always returns at least one token if len(dst) > 0,
+// even at the end of input. Callers can therefore check AtEOF after each call
+// to determine if they are done:
+//
+//	buf := make([]lex.Item, 64)
+//	for !l.AtEOF() {
+//		for _, it := range buf[:l.LexBatch(buf)] {
+//			// ...
+//		}
+//	}
+//
+func (l *Lexer) LexBatch(dst []Item) int {
+	n := 0
+	for n < len(dst) {
+		if l.count > 0 {
+			n += l.popN(dst[n:])
+			continue
+		}
+		if n > 0 && l.undo[l.ur].r == EOF {
+			break
+		}
+		(*State)(l).step()
+	}
+	return n
+}
+
+// step runs the current state function.
+//
+func (s *State) step() {
+	if s.lim != nil {
+		s.lim.dropping = false
+	}
+	if s.rec != nil {
+		defer s.recover()
+	}
+	fn := s.state
+	if fn == nil {
+		fn = s.init
+	}
+	if s.trace != nil {
+		s.trace.fn(TraceEvent{Kind: TraceEnter, State: s.trace.name(fn)})
+	}
+	if s.stats != nil {
+		s.state = s.stats.run(s, fn)
+	} else {
+		s.state = fn(s)
+	}
+	if s.trace != nil {
+		s.trace.fn(TraceEvent{Kind: TraceExit, State: s.trace.name(fn), Next: s.trace.name(s.state)})
+	}
+	if s.state == nil {
+		s.capt = false
+		if len(s.pending) > 0 {
+			s.flushPending()
+		}
+	}
+	if s.v != nil {
+		s.v.step()
+	}
+}
+
+// AtEOF reports whether the lexer has reached the end of input and all the
+// tokens emitted so far have been returned by Lex. This is usually the case
+// right after Lex returned the EOF token and can be used by generic consumers
+// that do not know which token type a lexer uses for EOF.
+//
+func (l *Lexer) AtEOF() bool {
+	return l.count == 0 && l.undo[l.ur].r == EOF
+}
+
 // File returns the File used as input for the lexer.
 //
 func (l *Lexer) File() *File {
@@ -214,33 +871,174 @@ func (l *Lexer) File() *File {
 // If the emitted token is Error, the value must be an error interface.
 //
 func (s *State) Emit(offset int, t Token, value interface{}) {
-	s.push(t, offset, value)
+	s.push(Item{Type: t, Pos: offset, End: s.end(offset), v: value})
+}
+
+// EmitRune is like Emit for rune values. Unlike Emit, it does not allocate.
+// The value can be retrieved with Item.Rune.
+//
+func (s *State) EmitRune(offset int, t Token, r rune) {
+	s.push(Item{Type: t, Pos: offset, End: s.end(offset), kind: valRune, n: int64(r)})
+}
+
+// EmitString is like Emit for string values. Unlike Emit, it does not
+// allocate. The value can be retrieved with Item.Str.
+//
+func (s *State) EmitString(offset int, t Token, str string) {
+	s.push(Item{Type: t, Pos: offset, End: s.end(offset), kind: valString, s: str})
+}
+
+// EmitInt64 is like Emit for int64 values. Unlike Emit, it does not allocate.
+// The value can be retrieved with Item.Int64.
+//
+func (s *State) EmitInt64(offset int, t Token, n int64) {
+	s.push(Item{Type: t, Pos: offset, End: s.end(offset), kind: valInt64, n: n})
 }
 
 // Errorf emits an error token with type Error. The Item value is set to the
 // result of calling fmt.Errorf(format, args...) and offset is the file offset.
 //
 func (s *State) Errorf(offset int, format string, args ...interface{}) {
-	s.push(Error, offset, fmt.Errorf(format, args...))
+	s.push(Item{Type: Error, Pos: offset, End: s.end(offset), v: fmt.Errorf(format, args...)})
+}
+
+// ErrorfToken is like Errorf at the start offset of the current token, as set
+// by StartToken. Use it for errors that concern the token as a whole, like an
+// unterminated string.
+//
+func (s *State) ErrorfToken(format string, args ...interface{}) {
+	s.Errorf(s.ts, format, args...)
+}
+
+// ErrorfHere is like Errorf at the offset of the current rune, as returned by
+// Pos. Use it for errors about the last rune read, like an invalid escape
+// sequence.
+//
+func (s *State) ErrorfHere(format string, args ...interface{}) {
+	s.Errorf(s.Pos(), format, args...)
+}
+
+// Expect reads the next rune and reports whether it is r. If not, the rune is
+// not consumed and Expect emits an error like
+//
+//	expected '=' after key
+//
+// at its offset, where what describes the construct that r must follow. If
+// the end of input is reached instead of r, the input is marked as incomplete
+// (see MarkIncomplete).
+//
+func (s *State) Expect(r rune, what string) bool {
+	if s.Next() == r {
+		return true
+	}
+	if s.Current() == EOF {
+		s.MarkIncomplete()
+	}
+	off := s.Pos()
+	s.Backup()
+	s.Errorf(off, "expected %q after %s", r, what)
+	return false
+}
+
+// EmitCurrent emits a token of type t that spans from the offset set by
+// StartCapture to the end of the last rune returned by Next, with the text of
+// the token as a string value. This replaces the common pattern of collecting
+// runes in a buffer while lexing a token:
+//
+//	func stateIdentifier(s *lex.State) lex.StateFn {
+//		s.StartCapture(s.Pos())
+//		for r := s.Next(); isLetter(r); r = s.Next() {
+//		}
+//		s.Backup()
+//		s.EmitCurrent(tokIdent)
+//		return nil
+//	}
+//
+// The text is made of the runes returned by Next from the offset set by
+// StartCapture, so that it is the same as the text collected by such a state
+// function: invalid input reported by Next is left out and input transformed
+// by the Encoding, Normalize or Newlines options is included as transformed.
+//
+// The lexer captures the text of the token from the call to StartCapture until
+// EmitCurrent or StartToken is called or the state function returns nil,
+// whichever comes first. EmitCurrent panics if it is called outside of that
+// time.
+//
+func (s *State) EmitCurrent(t Token) {
+	if !s.capt {
+		panic("lex: EmitCurrent called without StartCapture")
+	}
+	n := 0
+	if u := &s.undo[s.ur]; u.p >= s.ts {
+		n = u.t
+	}
+	text := string(s.text[:n])
+	s.capt, s.text = false, s.text[:0]
+	s.EmitString(s.ts, t, text)
+}
+
+// EmitRuneToken emits a token of type t for the current rune, with the rune as
+// value. It is a shorthand for
+//
+//	s.EmitRune(s.Pos(), t, s.Current())
+//
+func (s *State) EmitRuneToken(t Token) {
+	s.EmitRune(s.Pos(), t, s.Current())
+}
+
+// captureRune appends r to the text of the current token and returns the new
+// length of the text.
+//
+func (s *State) captureRune(r rune) int {
+	if r >= utf8.RuneSelf {
+		var b [utf8.UTFMax]byte
+		s.text = append(s.text, b[:utf8.EncodeRune(b[:], r)]...)
+	} else if r >= 0 {
+		s.text = append(s.text, byte(r))
+	}
+	return len(s.text)
+}
+
+// end returns the offset just past the last rune returned by Next, or offset if
+// it is greater.
+//
+func (s *State) end(offset int) int {
+	u := &s.undo[s.ur]
+	e := u.p
+	if e >= 0 && u.r != EOF {
+		e += u.s
+	}
+	if e < offset {
+		return offset
+	}
+	return e
 }
 
 // Next returns the next rune in the input stream. If the end of the input
 // has ben reached it will return EOF. If an I/O error occurs other than io.EOF,
 // it will report the I/O error by calling Errorf then return EOF.
 //
+// EOF is sticky: once Next has returned EOF, subsequent calls return EOF
+// without advancing, Pos returns the input size and a single call to Backup
+// reverts all of them at once.
+//
 // Next only returns valid runes or -1 to indicate EOF. It filters out invalid
 // runes, nul bytes (0x00) and BOMs (U+FEFF) and reports them as errors by
 // calling Errorf (except for a BOM at the beginning of the file which is simply
-// ignored).
+// ignored). Bidirectional control characters are handled according to the
+// BidiControls option.
 //
 func (s *State) Next() rune {
 	r, _, err := s.ReadRune()
 	if err != nil {
 		if err != io.EOF {
-			s.Emit(s.Pos(), Error, err)
+			s.Emit(s.Pos(), Error, &ReadError{err})
 			s.ioErr = io.EOF
 		}
-		return EOF
+		r = EOF
+	}
+	if s.trace != nil {
+		s.traceRune()
 	}
 	return r
 }
@@ -259,8 +1057,14 @@ func (s *State) ReadRune() (rune, int, error) {
 		s.ur = u
 		return s.undo[u].r, s.undo[u].s, nil
 	}
+	if s.nf != nil {
+		return s.readNormalized()
+	}
+	if s.dec != nil {
+		return s.readDecoded()
+	}
 again:
-	for s.r+utf8.UTFMax > s.w && !utf8.FullRune(s.buf[s.r:s.w]) && s.ioErr == nil && s.w-s.r < len(s.buf) {
+	for s.r+utf8.UTFMax > s.w && !utf8.FullRune(s.buf[s.r:s.w]) && s.ioErr == nil && s.w-s.r < s.bufSize {
 		s.fill()
 	}
 
@@ -278,12 +1082,13 @@ again:
 	if b := s.buf[s.r]; b < utf8.RuneSelf {
 		s.r++
 		if b == 0 {
-			s.Emit(off, Error, ErrNulChar)
+			s.pushEncodingError(Item{Type: Error, Pos: off, End: off + 1, v: ErrNulChar})
 			goto again
 		}
-		if b == '\n' {
-			s.line++
-			s.f.AddLine(off+1, s.line)
+		if b == '\n' && !s.lazy {
+			s.newline(off + 1)
+		} else if b == '\r' && s.nl&newlineCR != 0 {
+			return s.readCR(off)
 		}
 		s.pushUndo(off, rune(b), 1)
 		return rune(b), 1, nil
@@ -293,41 +1098,101 @@ again:
 	r, w := utf8.DecodeRune(s.buf[s.r:s.w])
 	s.r += w
 	if r == utf8.RuneError && w == 1 {
-		s.Emit(off, Error, ErrInvalidRune)
+		s.pushEncodingError(Item{Type: Error, Pos: off, End: off + w, v: ErrInvalidRune})
 		goto again
 	}
 
 	// BOM only allowed as first rune in the file
 	if r == 0xfeff {
 		if off > 0 {
-			s.Emit(off, Error, ErrInvalidBOM)
+			s.pushEncodingError(Item{Type: Error, Pos: off, End: off + w, v: ErrInvalidBOM})
 		}
 		goto again
 	}
 
+	if s.bidi != BidiAllow && isBidiControl(r) && !s.bidiControl(off, w, r) {
+		goto again
+	}
+
+	if s.nl&NewlineUnicode != 0 && (r == 0x85 || r == 0x2028 || r == 0x2029) {
+		s.newline(off + w)
+		r = '\n'
+	}
+
 	s.pushUndo(off, r, w)
 	return r, w, nil
 }
 
+// readCR reads a line terminator starting with the '\r' at offset off, which
+// has just been consumed.
+//
+func (s *State) readCR(off int) (rune, int, error) {
+	if s.r == s.w && s.ioErr == nil {
+		s.fill()
+	}
+	if s.r < s.w && s.buf[s.r] == '\n' {
+		if s.nl&NewlineCRLF != 0 {
+			s.r++
+			s.newline(off + 2)
+			s.pushUndo(off, '\n', 2)
+			return '\n', 2, nil
+		}
+	} else if s.nl&NewlineCR != 0 {
+		s.newline(off + 1)
+		s.pushUndo(off, '\n', 1)
+		return '\n', 1, nil
+	}
+	s.pushUndo(off, '\r', 1)
+	return '\r', 1, nil
+}
+
+// newline records a new line starting at offset off.
+//
+func (s *State) newline(off int) {
+	s.line++
+	s.f.AddLine(off, s.line)
+}
+
+// pushEncodingError pushes an error detected by ReadRune, deferring it if
+// requested.
+//
+func (s *State) pushEncodingError(it Item) {
+	if s.defErrs {
+		s.pending = append(s.pending, it)
+		return
+	}
+	s.push(it)
+}
+
 func (s *State) pushUndo(off int, r rune, sz int) {
+	t := 0
+	if s.capt {
+		t = s.captureRune(r)
+	}
 	s.ur = s.uh
-	s.undo[s.uh] = undo{off, r, sz}
+	s.undo[s.uh] = undo{off, r, sz, t}
 	s.uh = (s.uh + 1) & undoMask
-	s.undo[s.uh] = undo{-1, utf8.RuneSelf, 1}
+	s.undo[s.uh] = undo{-1, utf8.RuneSelf, 1, 0}
 }
 
-// Backup reverts the last call to Next. Backup can be called at most
-// (BackupBufferSize-1) times in a row (i.e. with no calls to Next in between).
-// Calling Backup beyond the start of the undo buffer or at the beginning
-// of the input stream will fail silently, Pos will return -1 (an invalid
-// offset) and Current will return utf8.RuneSelf, a value impossible to get
-// by any other means.
+// Backup reverts the last call to Next, or all the consecutive calls to Next
+// that returned EOF. After Backup, the next call to Next returns the same rune
+// again, and Current and Pos return the rune before it and its offset.
+//
+// Backup can be called at most (BackupBufferSize-1) times in a row (i.e. with
+// no calls to Next in between). When Backup reverts the first rune of the
+// input or reaches the start of the undo buffer, Pos returns -1 (an invalid
+// offset) and Current returns utf8.RuneSelf, a value impossible to get by any
+// other means. Calling Backup in that state has no effect.
 //
 func (s *State) Backup() {
 	if s.undo[s.ur].p == -1 {
 		return
 	}
 	s.ur = (s.ur - 1) & undoMask
+	if s.trace != nil {
+		s.trace.fn(TraceEvent{Kind: TraceBackup, Rune: s.Current(), Pos: s.Pos()})
+	}
 }
 
 // UnreadRune reverts the last call to ReadRune. It is essentially the same as
@@ -341,46 +1206,277 @@ func (s *State) UnreadRune() error {
 	return nil
 }
 
-// Current returns the last rune returned by State.Next.
+// Current returns the last rune returned by State.Next and not reverted by
+// Backup, or utf8.RuneSelf if there is no such rune (see Backup).
 //
 func (s *State) Current() rune {
 	return s.undo[s.ur].r
 }
 
-// Pos returns the byte offset of the last rune returned by State.Next.
-// Returns -1 if no input has been read yet.
+// Pos returns the byte offset of Current. At EOF, this is the size of the
+// input. Pos returns -1 if no input has been read yet or if Current returns
+// utf8.RuneSelf (see Backup).
 //
 func (s *State) Pos() int {
 	return s.undo[s.ur].p
 }
 
+// Line returns the 1-based line number of Current, or 0 if Pos returns -1.
+//
+// Unlike File.Position, Line and Column do not need to search the line table
+// of the input file when Current is on the last line read so far, which is the
+// common case. This makes them cheap enough to implement line sensitive rules
+// in state functions, like directives that must start at column 1.
+//
+func (s *State) Line() int {
+	l, _ := s.lineCol()
+	return l
+}
+
+// Column returns the 1-based column number of Current, as a byte index in the
+// line, or 0 if Pos returns -1. See Line.
+//
+func (s *State) Column() int {
+	_, c := s.lineCol()
+	return c
+}
+
+func (s *State) lineCol() (int, int) {
+	off := s.Pos()
+	if off < 0 {
+		return 0, 0
+	}
+	if !s.lazy {
+		lines := s.f.lines
+		if n := len(lines); lines[n-1] <= off {
+			return n, off - lines[n-1] + 1
+		}
+	}
+	p := s.f.Position(off)
+	return p.Line, p.Column
+}
+
 func (s *State) fill() {
+	if s.buf == nil {
+		s.buf = make([]byte, s.bufSize)
+	}
+	if s.stats != nil {
+		s.stats.fills++
+	}
+	if s.lazy {
+		s.syncLines()
+	}
 	// slide buffer contents
 	if n := s.r; n > 0 {
-		copy(s.buf[:], s.buf[n:s.w])
+		if s.ll != nil {
+			s.saveGap(n)
+		}
+		copy(s.buf, s.buf[n:s.w])
 		s.offs += n
 		s.w -= n
 		s.r = 0
+		s.ls -= n
 	}
 
-	for i := 0; i < 100; i++ {
+	for empty := 1; ; empty++ {
 		n, err := s.f.Read(s.buf[s.w:len(s.buf)])
+		if s.rec != nil && n > 0 {
+			s.rec.buf = append(s.rec.buf, s.buf[s.w:s.w+n]...)
+		}
 		s.w += n
 		if err != nil {
 			s.ioErr = err
 			return
 		}
-		if s.w-s.r >= utf8.UTFMax {
+		if n > 0 {
+			return
+		}
+		if err = s.retry(empty); err != nil {
+			s.ioErr = err
 			return
 		}
 	}
+}
+
+// syncLines records the lines of the input read so far in lazy mode.
+//
+func (s *State) syncLines() {
+	lines := s.f.lines
+	for i, b := range s.buf[s.ls:s.r] {
+		if b == '\n' {
+			lines = append(lines, s.offs+s.ls+i+1)
+		}
+	}
+	s.line += len(lines) - len(s.f.lines)
+	s.f.lines = lines
+	s.ls = s.r
+}
+
+// AcceptWhileByteSet advances over the longest run of ASCII characters c such
+// that set[c] is true and returns the number of characters read. It is
+// equivalent to calling Next until it returns a rune not in set, then Backup,
+// but scans the input buffer directly instead of decoding runes one by one.
+// This makes it much faster for long runs of identifier characters, digits or
+// white space.
+//
+// Only ASCII characters other than NUL can be accepted: the values of set for
+// bytes >= utf8.RuneSelf and 0 are ignored. NUL bytes, invalid UTF-8 and BOMs
+// are reported and skipped like with Next. Upon return, Current and Pos return
+// the last character read and Backup can undo up to BackupBufferSize-1
+// characters.
+//
+func (s *State) AcceptWhileByteSet(set *[256]bool) int {
+	in := func(r rune) bool { return r < utf8.RuneSelf && set[r] }
+	n, ok := s.acceptStart(in)
+	for ok && s.available() {
+		i := s.r
+		for ; i < s.w; i++ {
+			b := s.buf[i]
+			if b == 0 || b >= utf8.RuneSelf || !set[b] {
+				break
+			}
+			if b == '\n' && !s.lazy {
+				s.newline(s.offs + i + 1)
+			} else if b == '\r' && s.nl&newlineCR != 0 {
+				break
+			}
+		}
+		var k int
+		k, ok = s.acceptEnd(i, in)
+		n += k
+	}
+	return n
+}
+
+// acceptRun advances over the longest run of runes for which in returns true
+// and returns the number of runes read.
+//
+func (s *State) acceptRun(in func(r rune) bool) int {
+	n, ok := s.acceptStart(in)
+	for ok && s.available() {
+		i := s.r
+		for ; i < s.w; i++ {
+			b := s.buf[i]
+			if b == 0 || b >= utf8.RuneSelf || !in(rune(b)) {
+				break
+			}
+			if b == '\n' && !s.lazy {
+				s.newline(s.offs + i + 1)
+			} else if b == '\r' && s.nl&newlineCR != 0 {
+				break
+			}
+		}
+		var k int
+		k, ok = s.acceptEnd(i, in)
+		n += k
+	}
+	return n
+}
 
-	s.ioErr = io.ErrNoProgress
+// acceptStart starts a bulk scan of the runes for which in returns true by
+// accepting the runes pending in the undo buffer and, if the input is
+// transformed, reading all runes with Next. It returns the number of runes
+// accepted and true if the scan must continue in the input buffer.
+//
+func (s *State) acceptStart(in func(r rune) bool) (int, bool) {
+	n, ok := s.acceptPending(in)
+	for ok && (s.nf != nil || s.dec != nil) {
+		if r := s.Next(); r <= 0 || !in(r) {
+			s.Backup()
+			return n, false
+		}
+		n++
+	}
+	return n, ok
 }
 
-// Peek returns the next rune in the input stream without consuming it. This
-// is equivalent to calling Next followed by Backup. At EOF, it simply returns
-// EOF.
+// available fills the input buffer if all of it has been read. It returns
+// false at the end of the input.
+//
+func (s *State) available() bool {
+	for s.r == s.w {
+		if s.ioErr != nil {
+			return false
+		}
+		s.fill()
+	}
+	return true
+}
+
+// acceptEnd ends a bulk scan of the input buffer, stopped by the caller at
+// buf[i]. It advances over the runes scanned and, if buf[i] needs decoding,
+// reads it with Next. It returns the number of runes read and true if the
+// scan must continue.
+//
+func (s *State) acceptEnd(i int, in func(r rune) bool) (int, bool) {
+	n := s.advance(i)
+	if i == s.w {
+		return n, true
+	}
+	if b := s.buf[i]; b != 0 && b < utf8.RuneSelf && (b != '\r' || s.nl&newlineCR == 0) {
+		return n, false
+	}
+	// let Next deal with NUL bytes, line terminators, non-ASCII runes,
+	// invalid UTF-8 and BOMs
+	if r := s.Next(); r <= 0 || !in(r) {
+		s.Backup()
+		return n, false
+	}
+	return n + 1, true
+}
+
+// acceptPending accepts the runes pending in the undo buffer while in returns
+// true. It returns the number of runes accepted and false if a rune was
+// rejected.
+//
+func (s *State) acceptPending(in func(r rune) bool) (int, bool) {
+	n := 0
+	for (s.ur+1)&undoMask != s.uh {
+		if r := s.Next(); r <= 0 || !in(r) {
+			s.Backup()
+			return n, false
+		}
+		n++
+	}
+	return n, true
+}
+
+// advance moves the read index to i, recording the single byte runes in
+// buf[s.r:i] in the undo buffer. It returns the number of runes read.
+//
+func (s *State) advance(i int) int {
+	// only the last runes are needed in the undo buffer
+	j := i - undoMask
+	if j < s.r {
+		j = s.r
+	}
+	t := 0
+	if s.capt {
+		t = len(s.text) - s.r + 1
+		s.text = append(s.text, s.buf[s.r:i]...)
+	}
+	if j < i {
+		for ; j < i; j++ {
+			s.undo[s.uh] = undo{s.offs + j, rune(s.buf[j]), 1, t + j}
+			s.uh = (s.uh + 1) & undoMask
+		}
+		s.ur = (s.uh - 1) & undoMask
+		s.undo[s.uh] = undo{-1, utf8.RuneSelf, 1, 0}
+	}
+	n := i - s.r
+	if s.trace != nil {
+		for j := s.r; j < i; j++ {
+			s.trace.fn(TraceEvent{Kind: TraceRune, Rune: rune(s.buf[j]), Pos: s.offs + j})
+		}
+	}
+	s.r = i
+	return n
+}
+
+// Peek returns the rune that the next call to Next would return, without
+// consuming it: Current, Pos and subsequent calls to Next and Backup are not
+// affected. This is equivalent to calling Next followed by Backup, except at
+// EOF, where Next does not advance (see Next) and Peek simply returns EOF.
 //
 func (s *State) Peek() rune {
 	if s.Current() == EOF {
@@ -424,6 +1520,25 @@ func (s *State) Peek() rune {
 //
 func (s *State) StartToken(offset int) {
 	s.ts = offset
+	s.capt = false
+}
+
+// StartCapture is like StartToken and also starts capturing the text of the
+// token for EmitCurrent. Capturing has a cost on every call to Next, so it is
+// only done for tokens started with StartCapture.
+//
+func (s *State) StartCapture(offset int) {
+	s.ts = offset
+	s.capt, s.text = true, s.text[:0]
+	// capture the runes from offset that have already been read
+	for i := 1; i < BackupBufferSize; i++ {
+		u := &s.undo[(s.uh+i)&undoMask]
+		if u.p >= offset {
+			u.t = s.captureRune(u.r)
+		} else {
+			u.t = 0
+		}
+	}
 }
 
 // TokenPos returns the last offset set by StartToken.
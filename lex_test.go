@@ -1,15 +1,23 @@
 package lex_test
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/db47h/lex"
+	xunicode "golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/unicode/norm"
 )
 
 type testData struct {
@@ -54,6 +62,8 @@ func TestLexer_Next(t *testing.T) {
 		"aéb",
 		"c",
 		"\n\n",
+		"0123456789abcdefghij",
+		"",
 	}
 
 	data := [][]struct {
@@ -101,6 +111,36 @@ func TestLexer_Next(t *testing.T) {
 			{"nl1", next, 0, '\n'},
 			{"nl2", peek, 0, '\n'},
 		},
+		{
+			// consume 0123456789abcdefghij, then back up
+			{"n0", func(s *lex.State) rune {
+				for i := 0; i < 19; i++ {
+					s.Next()
+				}
+				return s.Next()
+			}, 19, 'j'},
+			{"b14", func(s *lex.State) rune {
+				for i := 0; i < 13; i++ {
+					s.Backup()
+				}
+				return backup(s)
+			}, 5, '5'},
+			{"p5", peek, 5, '6'},
+			{"b15", backup, -1, utf8.RuneSelf},
+			{"b16", backup, -1, utf8.RuneSelf},
+			{"p6", peek, -1, '5'},
+			{"n5", next, 5, '5'},
+			{"n6", next, 6, '6'},
+		},
+		{
+			{"e0", cur, -1, utf8.RuneSelf},
+			{"ep0", peek, -1, lex.EOF},
+			{"en0", next, 0, lex.EOF},
+			{"en1", next, 0, lex.EOF},
+			{"ep1", peek, 0, lex.EOF},
+			{"eb0", backup, -1, utf8.RuneSelf},
+			{"en2", next, 0, lex.EOF},
+		},
 	}
 
 	for i, in := range input {
@@ -206,6 +246,456 @@ func TestLexer_Lex(t *testing.T) {
 	}
 }
 
+func TestLexer_LexItem(t *testing.T) {
+	stateWord := func(s *lex.State) lex.StateFn {
+		var b strings.Builder
+		for r := s.Current(); unicode.IsLetter(r); r = s.Next() {
+			b.WriteRune(r)
+		}
+		s.Backup()
+		s.Emit(s.TokenPos(), tokChar, b.String())
+		return nil
+	}
+	//                                            01234 5 67
+	f := lex.NewFile("test", strings.NewReader("ab  é\x00c"))
+	l := lex.NewLexer(f, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		s.StartToken(s.Pos())
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case unicode.IsLetter(r):
+			return stateWord
+		}
+		return nil
+	})
+	data := []lex.Item{
+		lex.NewItem(tokChar, 0, 2, "ab"),
+		lex.NewItem(lex.Error, 6, 7, lex.ErrNulChar),
+		lex.NewItem(tokChar, 4, 8, "éc"),
+		lex.NewItem(tokEOF, 8, 8, nil),
+	}
+	for i, exp := range data {
+		if it := l.LexItem(); it != exp {
+			t.Errorf("Got: %v, expected: %v", it, exp)
+		}
+		if eof := l.AtEOF(); eof != (i == len(data)-1) {
+			t.Errorf("AtEOF after %v: got %v", exp, eof)
+		}
+	}
+}
+
+func TestState_EmitTyped(t *testing.T) {
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader("abc")), func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case 'a':
+			s.EmitRune(s.Pos(), tokChar, r)
+		case 'b':
+			s.EmitString(s.Pos(), tokChar, "b")
+		default:
+			s.EmitInt64(s.Pos(), tokChar, int64(r))
+		}
+		return nil
+	})
+	it := l.LexItem()
+	if r, ok := it.Rune(); !ok || r != 'a' || it.Value() != 'a' {
+		t.Errorf("got rune %q %v, value %v", r, ok, it.Value())
+	}
+	if _, ok := it.Str(); ok {
+		t.Error("rune value returned as string")
+	}
+	it = l.LexItem()
+	if s, ok := it.Str(); !ok || s != "b" || it.Value() != "b" {
+		t.Errorf("got string %q %v, value %v", s, ok, it.Value())
+	}
+	it = l.LexItem()
+	if n, ok := it.Int64(); !ok || n != 'c' || it.Value() != int64('c') {
+		t.Errorf("got int64 %d %v, value %v", n, ok, it.Value())
+	}
+	// interface values are available from typed accessors
+	it = lex.NewItem(tokChar, 0, 1, "x")
+	if s, ok := it.Str(); !ok || s != "x" {
+		t.Errorf("got string %q %v", s, ok)
+	}
+	if it.Err() != nil {
+		t.Errorf("got error %v", it.Err())
+	}
+}
+
+func TestState_AcceptWhileByteSet(t *testing.T) {
+	var set [256]bool
+	for _, c := range "abc \n" {
+		set[c] = true
+	}
+	set[0] = true    // ignored
+	set[0xc3] = true // ignored
+	// lex runs of characters in set followed by a single other character,
+	// either with AcceptWhileByteSet or Next.
+	lexer := func(fast bool) lex.StateFn {
+		return func(s *lex.State) lex.StateFn {
+			r := s.Next()
+			if r == lex.EOF {
+				s.Emit(s.Pos(), tokEOF, nil)
+				return nil
+			}
+			s.StartToken(s.Pos())
+			if r >= utf8.RuneSelf || !set[r] {
+				s.Emit(s.Pos(), tokChar, r)
+				return nil
+			}
+			n := 1
+			if fast {
+				n += s.AcceptWhileByteSet(&set)
+			} else {
+				for r = s.Next(); r > 0 && r < utf8.RuneSelf && set[r]; r = s.Next() {
+					n++
+				}
+				s.Backup()
+			}
+			// check that Backup works as expected after a run
+			if n > 2 {
+				s.Backup()
+				s.Backup()
+				s.Next()
+				s.Next()
+			}
+			s.Emit(s.TokenPos(), tokSpace, fmt.Sprint(n, s.Pos(), s.Current()))
+			return nil
+		}
+	}
+	rnd := rand.New(rand.NewSource(42))
+	chars := []byte("abc \n\rxé\x00")
+	for i := 0; i < 100; i++ {
+		in := make([]byte, rnd.Intn(8192))
+		for j := range in {
+			in[j] = chars[rnd.Intn(len(chars)-3)]
+			if rnd.Intn(200) == 0 {
+				in[j] = chars[len(chars)-3+rnd.Intn(3)]
+			}
+		}
+		var r1, r2 io.Reader = bytes.NewReader(in), bytes.NewReader(in)
+		if i&1 != 0 {
+			r1, r2 = iotest.OneByteReader(r1), iotest.HalfReader(r2)
+		}
+		f1, f2 := lex.NewFile("test", r1), lex.NewFile("test", r2)
+		var nl lex.Newline
+		if i%3 == 2 {
+			nl = lex.NewlineCRLF | lex.NewlineCR
+		}
+		l1, l2 := lex.NewLexer(f1, lexer(false), lex.Newlines(nl)), lex.NewLexer(f2, lexer(true), lex.Newlines(nl))
+		for !l1.AtEOF() {
+			i1, i2 := l1.LexItem(), l2.LexItem()
+			if fmt.Sprint(i1.Type, i1.Pos, i1.End, i1.Value()) != fmt.Sprint(i2.Type, i2.Pos, i2.End, i2.Value()) {
+				t.Fatalf("input %d: got %v, expected %v", i, i2, i1)
+			}
+			if p1, p2 := f1.Position(i1.Pos), f2.Position(i2.Pos); p1 != p2 {
+				t.Fatalf("input %d: got position %v, expected %v", i, p2, p1)
+			}
+		}
+		if !l2.AtEOF() {
+			t.Fatalf("input %d: not at EOF", i)
+		}
+	}
+}
+
+func TestLexer_Release(t *testing.T) {
+	init := func(s *lex.State) lex.StateFn {
+		switch r := s.Next(); r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case ' ':
+			s.Errorf(s.Pos(), "space")
+		default:
+			s.EmitRune(s.Pos(), tokChar, r)
+		}
+		return nil
+	}
+	for i, in := range []string{"ab c\nd", "x", "", "\n\nyz"} {
+		f := lex.NewFile("test", strings.NewReader(in))
+		l := lex.NewLexer(f, init)
+		var got []string
+		for !l.AtEOF() {
+			it := l.LexItem()
+			got = append(got, fmt.Sprint(f.Position(it.Pos), " ", it.Value()))
+		}
+		// the next lexer reuses this one
+		l.Release()
+		exp := [][]string{
+			{"test:1:1 97", "test:1:2 98", "test:1:3 space", "test:1:4 99", "test:1:5 10", "test:2:1 100", "test:2:2 <nil>"},
+			{"test:1:1 120", "test:1:2 <nil>"},
+			{"test:1:1 <nil>"},
+			{"test:1:1 10", "test:2:1 10", "test:3:1 121", "test:3:2 122", "test:3:3 <nil>"},
+		}[i]
+		if strings.Join(got, ",") != strings.Join(exp, ",") {
+			t.Errorf("%q: got %v, expected %v", in, got, exp)
+		}
+	}
+}
+
+func TestLexer_LexBatch(t *testing.T) {
+	// emits each rune twice and an error before EOF so that the queue holds
+	// several items and wraps around.
+	init := func(s *lex.State) lex.StateFn {
+		switch r := s.Next(); r {
+		case lex.EOF:
+			s.Errorf(s.Pos(), "eof")
+			return func(s *lex.State) lex.StateFn {
+				s.Emit(s.Pos(), tokEOF, nil)
+				return nil
+			}
+		default:
+			s.EmitRune(s.Pos(), tokChar, r)
+			s.EmitRune(s.Pos(), tokChar, r)
+		}
+		return nil
+	}
+	in := "abcdefg\nhij"
+	str := func(it lex.Item) string { return fmt.Sprint(it.Type, it.Pos, it.End, it.Value()) }
+	var exp []string
+	l := lex.NewLexer(lex.NewFile("", strings.NewReader(in)), init)
+	for !l.AtEOF() {
+		exp = append(exp, str(l.LexItem()))
+	}
+	for _, n := range []int{1, 2, 3, 7, 64} {
+		l := lex.NewLexer(lex.NewFile("", strings.NewReader(in)), init)
+		buf := make([]lex.Item, n)
+		var got []string
+		for !l.AtEOF() {
+			k := l.LexBatch(buf)
+			if k == 0 {
+				t.Fatalf("batch size %d: no tokens", n)
+			}
+			for _, it := range buf[:k] {
+				got = append(got, str(it))
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(exp, ",") {
+			t.Errorf("batch size %d: got %v, expected %v", n, got, exp)
+		}
+		if k := l.LexBatch(buf); k != 1 || buf[0].Type != tokEOF {
+			t.Errorf("batch size %d: got %d tokens after EOF", n, k)
+		}
+	}
+}
+
+func TestBufferSize(t *testing.T) {
+	init := func(s *lex.State) lex.StateFn {
+		switch r := s.Next(); r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		default:
+			s.EmitRune(s.Pos(), tokChar, r)
+		}
+		return nil
+	}
+	in := strings.Repeat("héllo, 世界\n", 50)
+	lexAll := func(opts ...lex.Option) []string {
+		f := lex.NewFile("test", iotest.OneByteReader(strings.NewReader(in)))
+		l := lex.NewLexer(f, init, opts...)
+		defer l.Release()
+		var got []string
+		for !l.AtEOF() {
+			it := l.LexItem()
+			got = append(got, fmt.Sprint(f.Position(it.Pos), " ", it.Value()))
+		}
+		return got
+	}
+	exp := strings.Join(lexAll(), ",")
+	for _, n := range []int{0, lex.MinBufferSize, 17, 100} {
+		if got := strings.Join(lexAll(lex.BufferSize(n)), ","); got != exp {
+			t.Errorf("BufferSize(%d): got %v, expected %v", n, got, exp)
+		}
+	}
+}
+
+func TestLazyLines(t *testing.T) {
+	init := func(s *lex.State) lex.StateFn {
+		switch r := s.Next(); r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case '\n':
+		case ' ':
+			// exercise AcceptWhileByteSet
+			var set [256]bool
+			set[' '], set['\n'] = true, true
+			s.AcceptWhileByteSet(&set)
+		default:
+			s.Backup()
+			s.Next()
+			s.EmitRune(s.Pos(), tokChar, r)
+		}
+		return nil
+	}
+	in := strings.Repeat("a\n\nbc \n  d\n世\n", 20) + "x"
+	lexAll := func(opts ...lex.Option) []string {
+		f := lex.NewFile("test", iotest.OneByteReader(strings.NewReader(in)))
+		l := lex.NewLexer(f, init, append(opts, lex.BufferSize(lex.MinBufferSize))...)
+		var got []string
+		for !l.AtEOF() {
+			it := l.LexItem()
+			got = append(got, fmt.Sprint(f.Position(it.Pos), " ", f.Position(it.End), " ", it.Value()))
+		}
+		got = append(got, fmt.Sprint(f.LineOffset(100)))
+		l.Release()
+		got = append(got, fmt.Sprint(f.Position(len(in))))
+		return got
+	}
+	exp := lexAll()
+	if got := lexAll(lex.LazyLines()); strings.Join(got, ",") != strings.Join(exp, ",") {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+}
+
+func TestNewlines(t *testing.T) {
+	in := "a\nb\r\nc\rd\u2028e\r"
+	td := []struct {
+		nl  lex.Newline
+		exp string
+	}{
+		{0, `1:1 'a',1:2 '\n',2:1 'b',2:2 '\r',2:3 '\n',3:1 'c',3:2 '\r',3:3 'd',3:4 '\u2028',3:7 'e',3:8 '\r'`},
+		{lex.NewlineCRLF, `1:1 'a',1:2 '\n',2:1 'b',2:2 '\n',3:1 'c',3:2 '\r',3:3 'd',3:4 '\u2028',3:7 'e',3:8 '\r'`},
+		{lex.NewlineCR, `1:1 'a',1:2 '\n',2:1 'b',2:2 '\r',2:3 '\n',3:1 'c',3:2 '\n',4:1 'd',4:2 '\u2028',4:5 'e',4:6 '\n'`},
+		{lex.NewlineCRLF | lex.NewlineCR | lex.NewlineUnicode, `1:1 'a',1:2 '\n',2:1 'b',2:2 '\n',3:1 'c',3:2 '\n',4:1 'd',4:2 '\n',5:1 'e',5:2 '\n'`},
+	}
+	for _, d := range td {
+		for _, r := range []io.Reader{strings.NewReader(in), iotest.OneByteReader(strings.NewReader(in))} {
+			f := lex.NewFile("", r)
+			var got []string
+			l := lex.NewLexer(f, func(s *lex.State) lex.StateFn {
+				r := s.Next()
+				if r == lex.EOF {
+					s.Emit(s.Pos(), tokEOF, nil)
+				} else {
+					s.EmitRune(s.Pos(), tokChar, r)
+				}
+				return nil
+			}, lex.Newlines(d.nl), lex.LazyLines())
+			for !l.AtEOF() {
+				if it := l.LexItem(); it.Type == tokChar {
+					r, _ := it.Rune()
+					p := f.Position(it.Pos)
+					got = append(got, fmt.Sprintf("%d:%d %q", p.Line, p.Column, r))
+				}
+			}
+			if g := strings.Join(got, ","); g != d.exp {
+				t.Errorf("%b: got %s, expected %s", d.nl, g, d.exp)
+			}
+		}
+	}
+}
+
+// stallReader returns stall empty reads before each byte of its input.
+//
+type stallReader struct {
+	s     string
+	stall int
+	n     int
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	if len(r.s) == 0 {
+		return 0, io.EOF
+	}
+	if r.n < r.stall {
+		r.n++
+		return 0, nil
+	}
+	r.n = 0
+	p[0] = r.s[0]
+	r.s = r.s[1:]
+	return 1, nil
+}
+
+func TestRetry(t *testing.T) {
+	init := func(s *lex.State) lex.StateFn {
+		switch r := s.Next(); r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		default:
+			s.EmitRune(s.Pos(), tokChar, r)
+		}
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	td := []struct {
+		name  string
+		stall int
+		opts  []lex.Option
+		err   error
+	}{
+		{"default", 99, nil, nil},
+		{"default_fail", 100, nil, io.ErrNoProgress},
+		{"max", 150, []lex.Option{lex.Retry(lex.MaxRetries(200))}, nil},
+		{"backoff", 3, []lex.Option{lex.Retry(lex.Backoff(context.Background(), time.Microsecond, 2*time.Microsecond))}, nil},
+		{"cancel", 1, []lex.Option{lex.Retry(lex.Backoff(ctx, time.Hour, time.Hour))}, context.Canceled},
+	}
+	for _, d := range td {
+		l := lex.NewLexer(lex.NewFile("", &stallReader{s: "abc", stall: d.stall}), init, d.opts...)
+		var got []string
+		var err error
+		for !l.AtEOF() {
+			it := l.LexItem()
+			if it.Type == lex.Error {
+				err = it.Err()
+				continue
+			}
+			got = append(got, fmt.Sprint(it.Value()))
+		}
+		if d.err == nil {
+			if err != nil || strings.Join(got, ",") != "97,98,99,<nil>" {
+				t.Errorf("%s: got %v, error %v", d.name, got, err)
+			}
+			continue
+		}
+		var re *lex.ReadError
+		if !errors.As(err, &re) || !errors.Is(err, d.err) {
+			t.Errorf("%s: got error %#v, expected a ReadError wrapping %v", d.name, err, d.err)
+		}
+	}
+}
+
+func TestDeferErrors(t *testing.T) {
+	init := func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r == ' ':
+		case r >= '0' && r <= '9':
+			pos := s.Pos()
+			for r = s.Next(); r >= '0' && r <= '9'; r = s.Next() {
+			}
+			s.Backup()
+			s.Emit(pos, tokChar, "num")
+		default:
+			s.Errorf(s.Pos(), "unexpected %q", r)
+		}
+		return nil
+	}
+	in := "1\x002 \xff x3\xfe4\x00"
+	for _, d := range []struct {
+		opts []lex.Option
+		exp  string
+	}{
+		{nil, "1 invalid NUL character,0 num,4 invalid UTF-8 encoding,6 unexpected 'x',8 invalid UTF-8 encoding,10 invalid NUL character,7 num,11 <nil>"},
+		{[]lex.Option{lex.DeferErrors()}, "0 num,1 invalid NUL character,4 invalid UTF-8 encoding,6 unexpected 'x',7 num,8 invalid UTF-8 encoding,10 invalid NUL character,11 <nil>"},
+	} {
+		l := lex.NewLexer(lex.NewFile("", strings.NewReader(in)), init, d.opts...)
+		var got []string
+		for !l.AtEOF() {
+			it := l.LexItem()
+			got = append(got, fmt.Sprint(it.Pos, " ", it.Value()))
+		}
+		if g := strings.Join(got, ","); g != d.exp {
+			t.Errorf("got      %s\nexpected %s", g, d.exp)
+		}
+	}
+}
+
 func TestEncodingError(t *testing.T) {
 	e := errors.New("foo error")
 	var ee *lex.EncodingError
@@ -217,3 +707,177 @@ func TestEncodingError(t *testing.T) {
 		t.Fatal("unexpected As not working")
 	}
 }
+
+func TestItem_String(t *testing.T) {
+	f := lex.NewFile("input", strings.NewReader(""))
+	f.AddLine(0, 1)
+	f.AddLine(3, 2)
+	items := []struct {
+		it  lex.Item
+		exp string
+	}{
+		{lex.NewItem(tokChar, 4, 5, 'a'), `input:2:2 [4,5) 2 'a'`},
+		{lex.NewItem(tokSpace, 0, 3, "a\nb"), `input:1:1 [0,3) 1 "a\nb"`},
+		{lex.NewItem(lex.Error, 3, 3, errors.New("bad\x00")), `input:2:1 [3,3) Error "bad\x00"`},
+		{lex.NewItem(tokEOF, 5, 5, nil), `input:2:3 [5,5) 0`},
+		{lex.NewItem(tokEOF, 5, 5, 42), `input:2:3 [5,5) 0 42`},
+	}
+	for _, i := range items {
+		if got := f.FormatItem(i.it); got != i.exp {
+			t.Errorf("got %s, expected %s", got, i.exp)
+		}
+	}
+}
+
+func TestState_ErrorfToken(t *testing.T) {
+	l := lex.NewLexer(lex.NewFile("input", strings.NewReader(`ab"cd`)), func(s *lex.State) lex.StateFn {
+		s.Next()
+		s.StartToken(s.Pos())
+		for r := s.Next(); r != lex.EOF; r = s.Next() {
+			if r == '"' {
+				s.ErrorfHere("unexpected %q", r)
+			}
+		}
+		s.ErrorfToken("unterminated")
+		s.Emit(s.Pos(), tokEOF, nil)
+		return nil
+	})
+	var res []string
+	for !l.AtEOF() {
+		res = append(res, l.LexItem().String())
+	}
+	if got, exp := strings.Join(res, ", "), `[2,3) Error "unexpected '\"'", [0,5) Error "unterminated", [5,5) 0`; got != exp {
+		t.Errorf("got %s, expected %s", got, exp)
+	}
+}
+
+func TestState_EmitCurrent(t *testing.T) {
+	input := "abcdefghijklmnopqrstuvwxyz,abc;" + strings.Repeat("x", 40)
+	l := lex.NewLexer(lex.NewFile("input", strings.NewReader(input)), func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r >= 'a' && r <= 'z':
+			s.StartCapture(s.Pos())
+			for r = s.Next(); r >= 'a' && r <= 'z'; r = s.Next() {
+			}
+			s.Backup()
+			s.EmitCurrent(tokSpace)
+		default:
+			s.EmitRuneToken(tokChar)
+		}
+		return nil
+	}, lex.BufferSize(16))
+	exp := []string{
+		`[0,26) 1 "abcdefghijklmnopqrstuvwxyz"`,
+		`[26,27) 2 ','`,
+		`[27,30) 1 "abc"`,
+		`[30,31) 2 ';'`,
+		`[31,71) 1 "` + strings.Repeat("x", 40) + `"`,
+		`[71,71) 0`,
+	}
+	for i := 0; !l.AtEOF(); i++ {
+		if got := l.LexItem().String(); i >= len(exp) || got != exp[i] {
+			t.Fatalf("token %d: got %s", i, got)
+		}
+	}
+}
+
+func TestState_Expect(t *testing.T) {
+	var res []string
+	for _, input := range []string{"a=", "a b", "a"} {
+		l := lex.NewLexer(lex.NewFile("input", strings.NewReader(input)), func(s *lex.State) lex.StateFn {
+			switch r := s.Next(); {
+			case r == lex.EOF:
+				s.Emit(s.Pos(), tokEOF, nil)
+			case r >= 'a' && r <= 'z':
+				if s.Expect('=', "key") {
+					s.EmitRuneToken(tokChar)
+				}
+			}
+			return nil
+		})
+		for !l.AtEOF() {
+			res = append(res, l.LexItem().String())
+		}
+		res = append(res, fmt.Sprint(l.Incomplete()))
+	}
+	exp := `[1,2) 2 '=', [2,2) 0, false, ` +
+		`[1,1) Error "expected '=' after key", [3,3) Error "expected '=' after key", [3,3) 0, true, ` +
+		`[1,1) Error "expected '=' after key", [1,1) 0, true`
+	if got := strings.Join(res, ", "); got != exp {
+		t.Errorf("got %s, expected %s", got, exp)
+	}
+}
+
+func TestState_Line(t *testing.T) {
+	for _, lazy := range []bool{false, true} {
+		var opts []lex.Option
+		if lazy {
+			opts = append(opts, lex.LazyLines())
+		}
+		var res []string
+		l := lex.NewLexer(lex.NewFile("input", strings.NewReader("ab\n#c\r\nd")), func(s *lex.State) lex.StateFn {
+			r := s.Next()
+			if r == lex.EOF {
+				s.Emit(s.Pos(), tokEOF, nil)
+				return nil
+			}
+			res = append(res, fmt.Sprintf("%q %d:%d", r, s.Line(), s.Column()))
+			if r == '\n' {
+				s.Backup()
+				res = append(res, fmt.Sprintf("backup %d:%d", s.Line(), s.Column()))
+				s.Next()
+			}
+			return nil
+		}, opts...)
+		for !l.AtEOF() {
+			l.LexItem()
+		}
+		exp := `'a' 1:1, 'b' 1:2, '\n' 1:3, backup 1:2, '#' 2:1, 'c' 2:2, '\r' 2:3, '\n' 2:4, backup 2:3, 'd' 3:1`
+		if got := strings.Join(res, ", "); got != exp {
+			t.Errorf("lazy %v: got %s, expected %s", lazy, got, exp)
+		}
+	}
+}
+
+func TestState_EmitCurrent_transformed(t *testing.T) {
+	words := func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r != ' ':
+			s.StartCapture(s.Pos())
+			for r = s.Next(); r != ' ' && r != lex.EOF; r = s.Next() {
+			}
+			s.Backup()
+			s.EmitCurrent(tokSpace)
+		}
+		return nil
+	}
+	utf16 := xunicode.UTF16(xunicode.LittleEndian, xunicode.IgnoreBOM)
+	in16, _ := utf16.NewEncoder().String("hé\r\nl lo")
+	for _, tc := range []struct {
+		in   string
+		opts []lex.Option
+		exp  string
+	}{
+		{"fo\x00o b\xffar", nil, `"foo" "bar"`},
+		{"a\r\nb c\rd", []lex.Option{lex.Newlines(lex.NewlineCRLF | lex.NewlineCR)}, `"a\nb" "c\nd"`},
+		{in16, []lex.Option{lex.Encoding(utf16), lex.Newlines(lex.NewlineCRLF)}, `"hé\nl" "lo"`},
+		{"e\u0301 x", []lex.Option{lex.Normalize(norm.NFC)}, "\"\u00e9\" \"x\""},
+	} {
+		l := lex.NewLexer(lex.NewFile("input", strings.NewReader(tc.in)), words, tc.opts...)
+		var res []string
+		for !l.AtEOF() {
+			if it := l.LexItem(); it.Type == tokSpace {
+				res = append(res, strconv.Quote(it.Value().(string)))
+			}
+		}
+		if got := strings.Join(res, " "); got != tc.exp {
+			t.Errorf("%q: got %s, expected %s", tc.in, got, tc.exp)
+		}
+	}
+}
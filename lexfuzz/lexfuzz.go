@@ -0,0 +1,125 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package lexfuzz provides helpers to fuzz custom lexers.
+//
+// Check runs a lexer on arbitrary input and verifies a set of invariants that
+// any lexer should satisfy. It can be used with native Go fuzzing:
+//
+//	func FuzzLexer(f *testing.F) {
+//		f.Add([]byte("x := 42"))
+//		f.Fuzz(func(t *testing.T, data []byte) {
+//			if err := lexfuzz.Check(data, newInitState); err != nil {
+//				t.Fatal(err)
+//			}
+//		})
+//	}
+//
+// or with go-fuzz:
+//
+//	func Fuzz(data []byte) int {
+//		if err := lexfuzz.Check(data, newInitState); err != nil {
+//			panic(err)
+//		}
+//		return 0
+//	}
+//
+package lexfuzz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/db47h/lex"
+)
+
+// Limits on the work done by a lexer per byte of input. They are deliberately
+// generous: they are meant to catch infinite loops, not slow lexers.
+//
+const (
+	stepsPerByte  = 64 // state function calls
+	tokensPerByte = 16 // emitted tokens
+)
+
+var errSteps = errors.New("too many state function calls without reaching EOF")
+
+// Check lexes data with a lexer whose initial state function is returned by
+// init and returns an error if any of the following invariants is violated:
+//
+//   - the lexer does not panic.
+//   - the lexer reaches EOF (see lex.Lexer.AtEOF) within a number of state
+//     function calls and tokens proportional to the input size.
+//   - token offsets are within the bounds of the input and the end offset of
+//     a token is not before its start offset.
+//   - the start offsets of tokens other than Error tokens are non-decreasing.
+//     Error tokens are exempt since lex.State.Next reports invalid input as
+//     soon as it is read, that is possibly before the token it is part of.
+//
+// Infinite loops that occur in a single call to a state function cannot be
+// detected; they are left to the fuzzing engine's timeouts. Only state
+// functions reached from the initial state function returned by init are
+// monitored: initial state functions set with lex.State.Init are not.
+//
+func Check(data []byte, init func() lex.StateFn) (err error) {
+	steps := stepsPerByte * (len(data) + 1)
+	var wrap func(fn lex.StateFn) lex.StateFn
+	wrap = func(fn lex.StateFn) lex.StateFn {
+		return func(s *lex.State) lex.StateFn {
+			if steps--; steps < 0 {
+				panic(errSteps)
+			}
+			if next := fn(s); next != nil {
+				return wrap(next)
+			}
+			return nil
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if r == errSteps {
+				err = errSteps
+				return
+			}
+			err = fmt.Errorf("lexer panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	l := lex.NewLexer(lex.NewFile("fuzz", bytes.NewReader(data)), wrap(init()))
+	last := 0
+	for n := tokensPerByte * (len(data) + 1); !l.AtEOF(); n-- {
+		if n == 0 {
+			return errors.New("too many tokens without reaching EOF")
+		}
+		it := l.LexItem()
+		if it.Pos < 0 || it.Pos > len(data) || it.End < it.Pos || it.End > len(data) {
+			return fmt.Errorf("token %d: offsets [%d, %d) out of bounds [0, %d]", it.Type, it.Pos, it.End, len(data))
+		}
+		if it.Type == lex.Error {
+			continue
+		}
+		if it.Pos < last {
+			return fmt.Errorf("token %d: offset %d before previous token offset %d", it.Type, it.Pos, last)
+		}
+		last = it.Pos
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package lexfuzz_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+	"github.com/db47h/lex/lexfuzz"
+	"github.com/db47h/lex/state"
+)
+
+const (
+	tokEOF lex.Token = iota
+	tokInt
+	tokFloat
+	tokString
+)
+
+func newInit() lex.StateFn {
+	num := state.Number(tokInt, tokFloat, '.')
+	str := state.QuotedString(tokString)
+	return func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		s.StartToken(s.Pos())
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r >= '1' && r <= '9':
+			return num
+		case r == '"':
+			return str
+		}
+		return nil
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, in := range []string{"", "12 3.5e4 \"foo\\n\" \"bar", "\x00\xff 1\x002"} {
+		if err := lexfuzz.Check([]byte(in), newInit); err != nil {
+			t.Errorf("%q: %v", in, err)
+		}
+	}
+}
+
+func TestCheck_errors(t *testing.T) {
+	td := []struct {
+		name string
+		init lex.StateFn
+		err  string
+	}{
+		{"no EOF", func(s *lex.State) lex.StateFn { s.Next(); return nil },
+			"too many state function calls without reaching EOF"},
+		{"loop", func(s *lex.State) lex.StateFn {
+			s.Emit(0, tokInt, nil)
+			return nil
+		}, "too many tokens without reaching EOF"},
+		{"panic", func(s *lex.State) lex.StateFn { panic("boom") }, "lexer panic: boom"},
+		{"bounds", func(s *lex.State) lex.StateFn {
+			s.Next()
+			s.Emit(10, tokEOF, nil)
+			return nil
+		}, "token 0: offsets [10, 10) out of bounds [0, 3]"},
+		{"order", func(s *lex.State) lex.StateFn {
+			if s.Next() == lex.EOF {
+				s.Emit(s.Pos(), tokEOF, nil)
+			} else {
+				s.Emit(3-s.Pos(), tokInt, nil)
+			}
+			return nil
+		}, "token 1: offset 2 before previous token offset 3"},
+	}
+	for _, d := range td {
+		init := d.init
+		err := lexfuzz.Check([]byte("abc"), func() lex.StateFn { return init })
+		if err == nil || !strings.HasPrefix(err.Error(), d.err) {
+			t.Errorf("%s: got error %v, expected %q", d.name, err, d.err)
+		}
+	}
+}
+
+func FuzzCheck(f *testing.F) {
+	f.Add([]byte("12 3.5e4 \"foo\\n\""))
+	f.Add([]byte("0x1f 0777 .5"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := lexfuzz.Check(data, newInit); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,306 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package lextest provides helpers for testing lexers against golden files.
+//
+// A golden test lexes some input and compares the canonical text of the
+// resulting tokens with the contents of a golden file:
+//
+//	func TestLexer(t *testing.T) {
+//		f, err := os.Open("testdata/input.txt")
+//		// ...
+//		l := lex.NewLexer(lex.NewFile("input.txt", f), initState)
+//		lextest.Golden(t, l, tokNames, "testdata/input.golden")
+//	}
+//
+// Golden writes the golden files instead of comparing them when the tests are
+// run with the -update flag. The flag is not registered by this package: test
+// packages that want it declare it themselves:
+//
+//	var _ = flag.Bool("update", false, "update golden files")
+//
+package lextest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+// Format reads all tokens from l until it reaches the end of input (see
+// lex.Lexer.AtEOF) and returns their canonical text, one token per line:
+//
+//	1:5 [4,7) Ident "foo"
+//
+// that is the line and column of the token followed by the item formatted
+// with lex.Item.Named. Type names are looked up in names, which may be nil.
+// Types not found in names are written as returned by lex.Lexer.TokenName.
+//
+func Format(l *lex.Lexer, names map[lex.Token]string) string {
+	var b strings.Builder
+	for !l.AtEOF() {
+		it := l.LexItem()
+		p := l.File().Position(it.Pos)
+		n, ok := names[it.Type]
+		if !ok {
+			n = l.TokenName(it.Type)
+		}
+		fmt.Fprintf(&b, "%d:%d %s\n", p.Line, p.Column, it.Named(n))
+	}
+	return b.String()
+}
+
+// Golden compares the output of Format(l, names) with the contents of the
+// golden file and reports differences as a unified diff. If the test binary
+// has a boolean -update flag and it is set, Golden writes the golden file
+// instead.
+//
+func Golden(t testing.TB, l *lex.Lexer, names map[lex.Token]string, golden string) {
+	t.Helper()
+	got := Format(l, names)
+	if update() {
+		if err := os.WriteFile(golden, []byte(got), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	exp, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Diff(golden, string(exp), "got", got); d != "" {
+		t.Errorf("tokens differ from golden file (run with -update to update):\n%s", d)
+	}
+}
+
+// update reports whether the -update flag is defined and set.
+//
+func update() bool {
+	f := flag.Lookup("update")
+	if f == nil {
+		return false
+	}
+	g, ok := f.Value.(flag.Getter)
+	if !ok {
+		return false
+	}
+	b, _ := g.Get().(bool)
+	return b
+}
+
+// context is the number of context lines in diffs.
+//
+const context = 3
+
+// Diff returns a unified diff of the lines of a and b, or an empty string if
+// they are equal. aName and bName are used in the diff header. A missing
+// newline at the end of a or b is reported like with diff -u.
+//
+// Diff uses the linear space variant of Myers' algorithm, so that it runs in
+// O((N+M)·D) time and O(N+M) space for inputs of N and M lines that differ
+// by D lines.
+//
+func Diff(aName, a, bName, b string) string {
+	if a == b {
+		return ""
+	}
+	d := differ{x: lines(a), y: lines(b)}
+	d.compare(0, len(d.x), 0, len(d.y))
+	ed := d.ed
+
+	// line numbers in a and b at each position in ed
+	an, bn := make([]int, len(ed)+1), make([]int, len(ed)+1)
+	an[0], bn[0] = 1, 1
+	for k, l := range ed {
+		an[k+1], bn[k+1] = an[k], bn[k]
+		if l[0] != '+' {
+			an[k+1]++
+		}
+		if l[0] != '-' {
+			bn[k+1]++
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for k := 0; k < len(ed); k++ {
+		if ed[k][0] == ' ' {
+			continue
+		}
+		// group changes separated by at most 2*context unchanged lines
+		last := k
+		for n := k + 1; n < len(ed) && n-last <= 2*context+1; n++ {
+			if ed[n][0] != ' ' {
+				last = n
+			}
+		}
+		s, e := k-context, last+1+context
+		if s < 0 {
+			s = 0
+		}
+		if e > len(ed) {
+			e = len(ed)
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", an[s], an[e]-an[s], bn[s], bn[e]-bn[s])
+		for _, l := range ed[s:e] {
+			out.WriteString(l)
+			if !strings.HasSuffix(l, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		k = last
+	}
+	return out.String()
+}
+
+// lines splits s into lines, keeping the line terminators so that a last line
+// without a newline differs from the same line with one.
+//
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	ls := strings.SplitAfter(s, "\n")
+	if ls[len(ls)-1] == "" {
+		ls = ls[:len(ls)-1]
+	}
+	return ls
+}
+
+// A differ computes the edit script that turns x into y.
+//
+type differ struct {
+	x, y []string
+	ed   []string // edit script: ' ', '-' or '+' followed by the line
+}
+
+// compare appends to the edit script the edits that turn x[x0:x1] into
+// y[y0:y1].
+//
+func (d *differ) compare(x0, x1, y0, y1 int) {
+	for x0 < x1 && y0 < y1 && d.x[x0] == d.y[y0] {
+		d.ed = append(d.ed, " "+d.x[x0])
+		x0, y0 = x0+1, y0+1
+	}
+	suffix := x1
+	for x1 > x0 && y1 > y0 && d.x[x1-1] == d.y[y1-1] {
+		x1, y1 = x1-1, y1-1
+	}
+	switch {
+	case x0 == x1:
+		for _, l := range d.y[y0:y1] {
+			d.ed = append(d.ed, "+"+l)
+		}
+	case y0 == y1:
+		for _, l := range d.x[x0:x1] {
+			d.ed = append(d.ed, "-"+l)
+		}
+	default:
+		if x, y, ok := d.bisect(x0, x1, y0, y1); ok {
+			d.compare(x0, x, y0, y)
+			d.compare(x, x1, y, y1)
+		} else {
+			for _, l := range d.x[x0:x1] {
+				d.ed = append(d.ed, "-"+l)
+			}
+			for _, l := range d.y[y0:y1] {
+				d.ed = append(d.ed, "+"+l)
+			}
+		}
+	}
+	for _, l := range d.x[x1:suffix] {
+		d.ed = append(d.ed, " "+l)
+	}
+}
+
+// bisect finds the middle snake of an optimal path from (x0, y0) to (x1, y1)
+// by searching from both ends at the same time, and returns the point where
+// the forward and reverse searches overlap.
+//
+func (d *differ) bisect(x0, x1, y0, y1 int) (int, int, bool) {
+	n, m := x1-x0, y1-y0
+	max := (n + m + 1) / 2
+	// vf[off+k] and vr[off+k] are the furthest x reached on diagonal k by the
+	// forward and reverse searches, or -1.
+	off := max + 1
+	vf, vr := make([]int, 2*max+3), make([]int, 2*max+3)
+	for i := range vf {
+		vf[i], vr[i] = -1, -1
+	}
+	vf[off+1], vr[off+1] = 0, 0
+	delta := n - m
+	odd := delta&1 != 0
+	// bounds of the diagonals still within the edit graph
+	kfStart, kfEnd, krStart, krEnd := 0, 0, 0, 0
+	for e := 0; e < max; e++ {
+		for k := -e + kfStart; k <= e-kfEnd; k += 2 {
+			var x int
+			if k == -e || k != e && vf[off+k-1] < vf[off+k+1] {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.x[x0+x] == d.y[y0+y] {
+				x, y = x+1, y+1
+			}
+			vf[off+k] = x
+			switch {
+			case x > n:
+				kfEnd += 2
+			case y > m:
+				kfStart += 2
+			case odd:
+				if i := off + delta - k; i >= 0 && i < len(vr) && vr[i] != -1 && x >= n-vr[i] {
+					return x0 + x, y0 + y, true
+				}
+			}
+		}
+		for k := -e + krStart; k <= e-krEnd; k += 2 {
+			var x int
+			if k == -e || k != e && vr[off+k-1] < vr[off+k+1] {
+				x = vr[off+k+1]
+			} else {
+				x = vr[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.x[x1-x-1] == d.y[y1-y-1] {
+				x, y = x+1, y+1
+			}
+			vr[off+k] = x
+			switch {
+			case x > n:
+				krEnd += 2
+			case y > m:
+				krStart += 2
+			case !odd:
+				if i := off + delta - k; i >= 0 && i < len(vf) && vf[i] != -1 && vf[i] >= n-x {
+					xf := vf[i]
+					return x0 + xf, y0 + xf - (i - off), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,83 @@
+package lextest_test
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/db47h/lex"
+	"github.com/db47h/lex/lextest"
+)
+
+const (
+	tokEOF lex.Token = iota
+	tokWord
+	tokPunct
+)
+
+var _ = flag.Bool("update", false, "update golden files")
+
+var tokNames = map[lex.Token]string{
+	tokEOF:  "EOF",
+	tokWord: "Word",
+}
+
+func TestGolden(t *testing.T) {
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader("Hello, 世界!\n\x00bye.")), func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		s.StartToken(s.Pos())
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case unicode.IsLetter(r):
+			for unicode.IsLetter(s.Next()) {
+			}
+			s.Backup()
+			s.Emit(s.TokenPos(), tokWord, "word")
+		case unicode.IsPunct(r):
+			s.Emit(s.Pos(), tokPunct, r)
+		}
+		return nil
+	}, lex.TokenNames(tokNames))
+	lextest.Golden(t, l, nil, "testdata/words.golden")
+}
+
+func TestDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n"
+	b := "1\n2\n3\n4\n5\nsix\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17\n"
+	exp := `--- a
++++ b
+@@ -3,7 +3,7 @@
+ 3
+ 4
+ 5
+-6
++six
+ 7
+ 8
+ 9
+@@ -14,3 +14,4 @@
+ 14
+ 15
+ 16
++17
+`
+	if d := lextest.Diff("a", a, "b", b); d != exp {
+		t.Errorf("got:\n%s\nexpected:\n%s", d, exp)
+	}
+	if d := lextest.Diff("a", a, "b", a); d != "" {
+		t.Errorf("got diff for equal inputs:\n%s", d)
+	}
+	exp = `--- a
++++ b
+@@ -1,2 +1,2 @@
+ x
+-y
+\ No newline at end of file
++y
+`
+	if d := lextest.Diff("a", "x\ny", "b", "x\ny\n"); d != exp {
+		t.Errorf("got:\n%s\nexpected:\n%s", d, exp)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrQueueFull is the value of the Error token emitted when tokens are
+// discarded because the token queue is full. See MaxQueue.
+//
+var ErrQueueFull = errors.New("token queue full")
+
+// An OverflowPolicy tells the lexer what to do when a state function emits a
+// token while the token queue is full. See MaxQueue.
+//
+type OverflowPolicy uint8
+
+// Overflow policies.
+//
+const (
+	OverflowError OverflowPolicy = iota // emit an Error token and discard tokens
+	OverflowBlock                       // suspend the state function
+)
+
+var overflowNames = [...]string{"OverflowError", "OverflowBlock"}
+
+// MaxQueue limits the number of tokens in the token queue to n, so that a
+// state function that emits many tokens before returning, like a greedy state
+// function driven by malicious input, cannot exhaust memory. n is rounded up to
+// 1. Without this option, the queue grows as needed.
+//
+// When a token is emitted while the queue is full:
+//
+//   - with OverflowError, the token is discarded. The first discarded token of
+//     a state function call is replaced by an Error token with ErrQueueFull
+//     as value, so the queue may hold up to n+1 tokens.
+//   - with OverflowBlock, the token is queued and the state machine is
+//     suspended between state function calls: the lexer does not call the
+//     next state function until the consumer has read all the tokens in the
+//     queue, that is until the next call to Lexer.LexItem or Lexer.LexBatch
+//     that finds the queue empty.
+//
+// Since a state function cannot be suspended in the middle of a call, state
+// functions that emit many tokens in a single call must check State.QueueFull
+// and return when it reports true for the queue to stay within n tokens with
+// OverflowBlock. The lexer then resumes lexing with the returned state
+// function once the queue has been read.
+//
+func MaxQueue(n int, p OverflowPolicy) Option {
+	return option(func(s *state) {
+		if n < 1 {
+			n = 1
+		}
+		s.lim = &limiter{max: n, policy: p}
+	}, "MaxQueue", n, p)
+}
+
+func (p OverflowPolicy) String() string {
+	if int(p) < len(overflowNames) {
+		return overflowNames[p]
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", p)
+}
+
+type limiter struct {
+	max      int
+	policy   OverflowPolicy
+	dropping bool // tokens are being discarded
+}
+
+func (s *state) initLimit() {
+	s.queue.max = s.lim.max
+	if s.lim.policy == OverflowError {
+		s.queue.full = (*State)(s).drop
+	}
+}
+
+// QueueFull reports whether the token queue holds as many tokens as allowed by
+// the MaxQueue option. It always returns false if the option is not set.
+//
+// State functions that emit many tokens in a single call can check QueueFull
+// to return before the queue overflows and continue on the next call:
+//
+//	func stateChars(s *lex.State) lex.StateFn {
+//		for !s.QueueFull() {
+//			r := s.Next()
+//			if r == lex.EOF {
+//				s.Emit(s.Pos(), tokEOF, nil)
+//				return nil
+//			}
+//			s.EmitRune(s.Pos(), tokChar, r)
+//		}
+//		return stateChars
+//	}
+//
+func (s *State) QueueFull() bool {
+	return s.lim != nil && s.count >= s.lim.max
+}
+
+// drop handles a full queue with the OverflowError policy.
+//
+func (s *State) drop(it *Item) bool {
+	if s.lim.dropping {
+		return false
+	}
+	s.lim.dropping = true
+	*it = Item{Type: Error, Pos: it.Pos, End: it.Pos, v: ErrQueueFull}
+	return true
+}
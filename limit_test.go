@@ -0,0 +1,77 @@
+package lex_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestMaxQueue(t *testing.T) {
+	// greedy emits one token per input rune in a single state function call.
+	greedy := func(s *lex.State) lex.StateFn {
+		for r := s.Next(); r != lex.EOF; r = s.Next() {
+			s.EmitRune(s.Pos(), tokChar, r)
+		}
+		s.Emit(s.Pos(), tokEOF, nil)
+		return nil
+	}
+	in := strings.Repeat("abcdefghij", 10)
+	lexAll := func(l *lex.Lexer) (string, int) {
+		var b strings.Builder
+		errs := 0
+		for it := l.LexItem(); it.Type != tokEOF; it = l.LexItem() {
+			if it.Type == lex.Error {
+				if !errors.Is(it.Err(), lex.ErrQueueFull) {
+					t.Fatalf("unexpected error %v", it.Err())
+				}
+				errs++
+				continue
+			}
+			r, _ := it.Rune()
+			b.WriteRune(r)
+		}
+		return b.String(), errs
+	}
+
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader(in)), greedy, lex.MaxQueue(4, lex.OverflowError))
+	if s, errs := lexAll(l); s != in[:4] || errs != 1 {
+		t.Errorf("OverflowError: got %q, %d errors", s, errs)
+	}
+
+	// without checking QueueFull, greedy grows the queue past the limit
+	l = lex.NewLexer(lex.NewFile("test", strings.NewReader(in)), greedy, lex.MaxQueue(4, lex.OverflowBlock))
+	if s, errs := lexAll(l); s != in || errs != 0 {
+		t.Errorf("OverflowBlock: got %q, %d errors", s, errs)
+	}
+
+	// state functions checking QueueFull are suspended and resumed once the
+	// queue has been read.
+	calls, emitted := 0, 0
+	var chars lex.StateFn
+	chars = func(s *lex.State) lex.StateFn {
+		calls++
+		n := 0
+		defer func() {
+			if n > 4 {
+				t.Errorf("%d tokens emitted in a single call", n)
+			}
+			emitted += n
+		}()
+		for !s.QueueFull() {
+			r := s.Next()
+			if r == lex.EOF {
+				s.Emit(s.Pos(), tokEOF, nil)
+				return nil
+			}
+			s.EmitRune(s.Pos(), tokChar, r)
+			n++
+		}
+		return chars
+	}
+	l = lex.NewLexer(lex.NewFile("test", strings.NewReader(in)), chars, lex.MaxQueue(4, lex.OverflowBlock))
+	if s, errs := lexAll(l); s != in || errs != 0 || emitted != len(in) || calls != len(in)/4+1 {
+		t.Errorf("QueueFull: got %q, %d errors, %d calls", s, errs, calls)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+// An ItemSource is a source of tokens as Items. It is implemented by Lexer,
+// Recorder, TeeSource and Pipeline.
+//
+type ItemSource interface {
+	LexItem() Item
+}
+
+var (
+	_ ItemSource = (*Lexer)(nil)
+	_ ItemSource = (*Recorder)(nil)
+	_ ItemSource = (*TeeSource)(nil)
+	_ ItemSource = (*Pipeline)(nil)
+)
+
+// A TokenReader provides arbitrary lookahead over the tokens of an ItemSource
+// for recursive descent parsers, with an interface similar to ANTLR's token
+// streams:
+//
+//	r := lex.NewTokenReader(l)
+//	switch r.LA(1).Type {
+//	case tokIdent:
+//		if r.LA(2).Type == tokLParen {
+//			return parseCall(r)
+//		}
+//		// ...
+//	}
+//
+// Tokens are read from the source as needed by LA and buffered until they are
+// consumed. Mark and Release delimit sections of the token stream that must
+// stay buffered, so that the parser can go back to a previous token with Seek,
+// for example for speculative parsing:
+//
+//	m := r.Mark()
+//	i := r.Index()
+//	ok := tryRule(r)
+//	if !ok {
+//		r.Seek(i)
+//	}
+//	r.Release(m)
+//
+type TokenReader struct {
+	src     ItemSource
+	buf     []Item // buffered tokens
+	p       int    // index in buf of the next token
+	off     int    // index of buf[0] in the token stream
+	markers int    // number of active markers
+}
+
+// NewTokenReader returns a new TokenReader that reads tokens from src.
+//
+func NewTokenReader(src ItemSource) *TokenReader {
+	return &TokenReader{src: src}
+}
+
+// LA returns the k-th token of lookahead: LA(1) is the next token to be
+// consumed, LA(2) the one after it, and so on. LA(-1) returns the last
+// consumed token, provided that it is still buffered, which is always the case
+// between calls to Mark and Release. LA panics if k is 0 or if the requested
+// token is no longer buffered.
+//
+func (r *TokenReader) LA(k int) Item {
+	switch {
+	case k > 0:
+		for r.p+k > len(r.buf) {
+			r.buf = append(r.buf, r.src.LexItem())
+		}
+		return r.buf[r.p+k-1]
+	case k < 0 && r.p+k >= 0:
+		return r.buf[r.p+k]
+	}
+	panic("lex: lookahead out of range")
+}
+
+// Consume consumes the next token.
+//
+func (r *TokenReader) Consume() {
+	if r.p == len(r.buf) {
+		r.buf = append(r.buf, r.src.LexItem())
+	}
+	r.p++
+	// discard consumed tokens, except the last one for LA(-1), once they
+	// take up at least half of the buffer.
+	if d := r.p - 1; r.markers == 0 && d > 0 && d >= len(r.buf)-r.p {
+		n := copy(r.buf, r.buf[d:])
+		for i := n; i < len(r.buf); i++ {
+			r.buf[i] = Item{}
+		}
+		r.buf = r.buf[:n]
+		r.off += d
+		r.p = 1
+	}
+}
+
+// Next consumes the next token and returns it.
+//
+func (r *TokenReader) Next() Item {
+	it := r.LA(1)
+	r.Consume()
+	return it
+}
+
+// Index returns the index in the token stream of the next token, that is the
+// number of tokens consumed so far.
+//
+func (r *TokenReader) Index() int {
+	return r.off + r.p
+}
+
+// Mark requests that tokens not be discarded from the buffer until the
+// returned marker is released. Markers can be released in any order but must
+// be released exactly once.
+//
+func (r *TokenReader) Mark() int {
+	r.markers++
+	return r.Index()
+}
+
+// Release releases a marker returned by Mark.
+//
+func (r *TokenReader) Release(marker int) {
+	if r.markers <= 0 {
+		panic("lex: release of unknown marker")
+	}
+	r.markers--
+}
+
+// Seek moves the reader to the token at index i in the token stream, as
+// returned by Index. This is only possible for tokens that are still buffered,
+// that is tokens consumed after the oldest active marker, and tokens
+// requested by LA. Seek panics otherwise.
+//
+func (r *TokenReader) Seek(i int) {
+	if i < r.off || i > r.off+len(r.buf) {
+		panic("lex: seek out of range")
+	}
+	r.p = i - r.off
+}
@@ -0,0 +1,57 @@
+package lex_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestTokenReader(t *testing.T) {
+	init := func(s *lex.State) lex.StateFn {
+		if r := s.Next(); r == lex.EOF {
+			s.Emit(s.Pos(), tokEOF, nil)
+		} else {
+			s.EmitRune(s.Pos(), tokChar, r)
+		}
+		return nil
+	}
+	r := lex.NewTokenReader(lex.NewLexer(lex.NewFile("test", strings.NewReader("abcdef")), init))
+	la := func(k int) rune {
+		v, _ := r.LA(k).Rune()
+		return v
+	}
+	if la(3) != 'c' || la(1) != 'a' {
+		t.Fatalf("got LA(1) = %q, LA(3) = %q", la(1), la(3))
+	}
+	r.Consume()
+	if la(-1) != 'a' || la(1) != 'b' || r.Index() != 1 {
+		t.Fatalf("got LA(-1) = %q, LA(1) = %q, Index() = %d", la(-1), la(1), r.Index())
+	}
+	m := r.Mark()
+	i := r.Index()
+	for r.LA(1).Type != tokEOF {
+		r.Consume()
+	}
+	if r.Index() != 6 {
+		t.Fatalf("got Index() = %d, expected 6", r.Index())
+	}
+	r.Seek(i)
+	if it := r.Next(); it.Pos != 1 {
+		t.Fatalf("got token at %d after Seek, expected 1", it.Pos)
+	}
+	r.Release(m)
+	r.Consume()
+	r.Consume()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Seek to a discarded token did not panic")
+			}
+		}()
+		r.Seek(i)
+	}()
+	if la(1) != 'e' {
+		t.Fatalf("got LA(1) = %q, expected e", la(1))
+	}
+}
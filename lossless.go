@@ -0,0 +1,143 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import "fmt"
+
+// Lossless makes the lexer emit tokens of type t for the input that is not
+// covered by the tokens emitted by state functions, like skipped white space
+// and comments, a BOM at the start of the input or bytes skipped because of
+// encoding errors. The value of these tokens is the input text they cover, as
+// a string.
+//
+// As a result, if state functions emit tokens in input order that do not
+// overlap, the input text of the tokens other than Error and Warning tokens
+// reproduces the input byte for byte, up to the offset of the last token (see
+// VerifyLossless). State functions should emit an EOF token at the end of
+// input so that trailing input is covered.
+//
+// Filler tokens are emitted right before the token that follows them, with
+// the input they cover as value. In order to do so, the lexer keeps the input
+// that follows the end of the last token in memory until the next token is
+// emitted, regardless of the buffer size.
+//
+func Lossless(t Token) Option {
+	return option(func(s *state) {
+		s.ll = &lossless{tok: t}
+	}, "Lossless", t)
+}
+
+type lossless struct {
+	tok Token
+	off int    // end offset of the input covered by tokens
+	raw []byte // input from off that is no longer in the lexer's buffer
+}
+
+// initLossless resets the filler state and sets up the queue hook that emits
+// filler tokens.
+//
+func (s *state) initLossless() {
+	ll := s.ll
+	ll.off, ll.raw = 0, ll.raw[:0]
+	check := s.check
+	s.check = func(it Item) {
+		if it.Type != Error && it.Type != Warning {
+			(*State)(s).fillGap(it)
+		}
+		if check != nil {
+			check(it)
+		}
+	}
+}
+
+// fillGap emits a filler token for the input between the end of the last
+// token and the start of it.
+//
+func (s *State) fillGap(it Item) {
+	ll := s.ll
+	if pos := it.Pos; pos > ll.off {
+		if max := s.offs + s.w; pos > max {
+			pos = max
+		}
+		var text string
+		if n := pos - ll.off; n <= len(ll.raw) {
+			text = string(ll.raw[:n])
+			ll.raw = append(ll.raw[:0], ll.raw[n:]...)
+		} else {
+			start := ll.off + len(ll.raw)
+			text = string(append(ll.raw, s.buf[start-s.offs:pos-s.offs]...))
+			ll.raw = ll.raw[:0]
+		}
+		gap := Item{Type: ll.tok, Pos: ll.off, End: pos, kind: valString, s: text}
+		ll.off = pos
+		s.add(gap)
+	}
+	if it.End <= ll.off {
+		return
+	}
+	if n := it.End - ll.off; n < len(ll.raw) {
+		ll.raw = append(ll.raw[:0], ll.raw[n:]...)
+	} else {
+		ll.raw = ll.raw[:0]
+	}
+	ll.off = it.End
+}
+
+// saveGap saves the first n bytes of the input buffer before they are
+// discarded, if they are not covered by a token yet.
+//
+func (s *State) saveGap(n int) {
+	ll := s.ll
+	start := ll.off + len(ll.raw) - s.offs
+	if start < 0 {
+		start = 0
+	}
+	if start < n {
+		ll.raw = append(ll.raw, s.buf[start:n]...)
+	}
+}
+
+// VerifyLossless checks that the tokens in items other than Error and Warning
+// tokens are sorted, do not overlap and cover src entirely, so that
+// concatenating their text reproduces src. Tokens may be empty.
+//
+func VerifyLossless(src []byte, items []Item) error {
+	off := 0
+	for _, it := range items {
+		if it.Type == Error || it.Type == Warning {
+			continue
+		}
+		switch {
+		case it.Pos > off:
+			return fmt.Errorf("input in [%d, %d) not covered by any token", off, it.Pos)
+		case it.Pos < off:
+			return fmt.Errorf("token %d at offset %d overlaps the previous token ending at %d", it.Type, it.Pos, off)
+		case it.End > len(src):
+			return fmt.Errorf("token %d at offset %d ends past the end of input", it.Type, it.Pos)
+		}
+		if it.End > off {
+			off = it.End
+		}
+	}
+	if off < len(src) {
+		return fmt.Errorf("input in [%d, %d) not covered by any token", off, len(src))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package lex_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+const tokFiller lex.Token = 100
+
+func TestLossless(t *testing.T) {
+	// words are emitted, white space and #comments are skipped.
+	init := func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		pos := s.Pos()
+		switch r {
+		case lex.EOF:
+			s.Emit(pos, tokEOF, nil)
+		case ' ', '\n':
+		case '#':
+			for r = s.Next(); r != '\n' && r != lex.EOF; r = s.Next() {
+			}
+		default:
+			for r = s.Next(); r != ' ' && r != '\n' && r != '#' && r != lex.EOF; r = s.Next() {
+			}
+			s.Backup()
+			s.Emit(pos, tokChar, nil)
+		}
+		return nil
+	}
+	src := "\ufeffabc  def # a comment longer than the buffer\n\x00\n  ghi\xff jkl  #"
+	for _, size := range []int{lex.MinBufferSize, lex.DefaultBufferSize} {
+		l := lex.NewLexer(lex.NewFile("test", strings.NewReader(src)), init, lex.BufferSize(size), lex.Lossless(tokFiller))
+		var (
+			items []lex.Item
+			b     strings.Builder
+		)
+		for !l.AtEOF() {
+			it := l.LexItem()
+			items = append(items, it)
+			switch it.Type {
+			case lex.Error:
+			case tokFiller:
+				v, _ := it.Str()
+				if v != src[it.Pos:it.End] {
+					t.Errorf("size %d: filler at %d: got %q, expected %q", size, it.Pos, v, src[it.Pos:it.End])
+				}
+				b.WriteString(v)
+			default:
+				b.WriteString(src[it.Pos:it.End])
+			}
+		}
+		if err := lex.VerifyLossless([]byte(src), items); err != nil {
+			t.Errorf("size %d: %v", size, err)
+		}
+		if b.String() != src {
+			t.Errorf("size %d: got %q", size, b.String())
+		}
+	}
+	if err := lex.VerifyLossless([]byte("abc"), []lex.Item{lex.NewItem(tokChar, 1, 3, nil)}); err == nil {
+		t.Error("expected error for uncovered input")
+	}
+}
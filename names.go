@@ -0,0 +1,71 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"strconv"
+)
+
+// TokenNames sets the human readable names of token types returned by
+// Lexer.TokenName. These are used in debug output, like tracing (see
+// TraceWriter), DumpJSON or lextest.Format:
+//
+//	l := lex.NewLexer(f, initState, lex.TokenNames(map[lex.Token]string{
+//		tokEOF:    "EOF",
+//		tokIdent:  "Ident",
+//		tokNumber: "Number",
+//	}))
+//
+// Names are set per lexer since token types are small integers specific to
+// each lexer. The names map must not be modified while the lexer is in use.
+//
+func TokenNames(names map[Token]string) Option {
+	return debugOption(func(s *state) {
+		s.names = names
+	}, "TokenNames", names)
+}
+
+// TokenName returns the name of token type t set with the TokenNames option,
+// or t.String() if it has none.
+//
+func (l *Lexer) TokenName(t Token) string {
+	return (*state)(l).tokenName(t)
+}
+
+func (s *state) tokenName(t Token) string {
+	if n, ok := s.names[t]; ok {
+		return n
+	}
+	return t.String()
+}
+
+// String returns "Error" and "Warning" for the Error and Warning token types
+// and the numeric value of t for other types. See Lexer.TokenName for the
+// names of the token types of a given lexer.
+//
+func (t Token) String() string {
+	switch t {
+	case Error:
+		return "Error"
+	case Warning:
+		return "Warning"
+	}
+	return strconv.Itoa(int(t))
+}
@@ -0,0 +1,23 @@
+package lex_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestTokenNames(t *testing.T) {
+	const tokFoo, tokBar lex.Token = 1, 2
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader("")), nil, lex.TokenNames(map[lex.Token]string{tokFoo: "Foo"}))
+	got := fmt.Sprintf("%s %s %s %v %v", l.TokenName(tokFoo), l.TokenName(tokBar), l.TokenName(lex.Error), tokFoo, lex.Warning)
+	if exp := "Foo 2 Error 1 Warning"; got != exp {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+	// names are per lexer
+	l = lex.NewLexer(lex.NewFile("test", strings.NewReader("")), nil, lex.TokenNames(map[lex.Token]string{tokFoo: "Bar"}))
+	if got := l.TokenName(tokFoo); got != "Bar" {
+		t.Errorf("got %q, expected Bar", got)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize makes the lexer normalize its input to the given Unicode
+// normalization form, typically norm.NFC or norm.NFD, as it is read. State
+// functions then see the normalized runes, so that identifiers that only
+// differ in their representation of combining characters compare equal in
+// token values.
+//
+// Offsets and sizes returned by State.ReadRune still refer to the original
+// input, and consecutive runes cover consecutive ranges of the input.
+// Normalization is applied to segments made of a starter followed by
+// combining characters: the runes of a normalized segment get the offsets and
+// sizes of the original runes in order, except that the last rune that has an
+// original counterpart covers the rest of the segment. If the segment gets
+// longer, the extra runes have a size of zero and the offset of the end of the
+// segment.
+//
+// Normalization disables the fast paths of AcceptWhileByteSet and
+// AcceptWhileClass, which then read runes one by one.
+//
+func Normalize(form norm.Form) Option {
+	return option(func(s *state) {
+		s.nf = &normalizer{form: form}
+	}, "Normalize", formNames[form])
+}
+
+var formNames = [...]string{norm.NFC: "NFC", norm.NFD: "NFD", norm.NFKC: "NFKC", norm.NFKD: "NFKD"}
+
+// maxSegment is the maximum number of runes in a segment. Longer sequences of
+// non-starters are split like with the stream-safe text format.
+//
+const maxSegment = 30
+
+type normalizer struct {
+	form norm.Form
+	next undo   // raw rune following the current segment, if next.p >= 0
+	seg  []undo // raw runes of the current segment
+	out  []undo // normalized runes not yet returned
+	buf  []byte // UTF-8 encoding of seg
+	nbuf []byte // normalized buf
+}
+
+func (nf *normalizer) reset() {
+	nf.next = undo{-1, utf8.RuneSelf, 1, 0}
+	nf.seg, nf.out = nf.seg[:0], nf.out[:0]
+}
+
+// readNormalized returns the next normalized rune.
+//
+func (s *State) readNormalized() (rune, int, error) {
+	nf := s.nf
+	if len(nf.out) == 0 {
+		s.normalize()
+		if len(nf.out) == 0 {
+			if s.Current() != EOF {
+				s.pushUndo(s.offs+s.r, EOF, 1)
+			}
+			return 0, 0, s.ioErr
+		}
+	}
+	u := nf.out[0]
+	nf.out = nf.out[1:]
+	s.pushUndo(u.p, u.r, u.s)
+	return u.r, u.s, nil
+}
+
+// normalize reads the next segment of raw runes and normalizes it into nf.out.
+//
+func (s *State) normalize() {
+	nf := s.nf
+	saved, ur, uh, capt := s.undo, s.ur, s.uh, s.capt
+	s.nf, s.capt = nil, false // read raw runes
+	nf.seg, nf.out = nf.seg[:0], nf.out[:0]
+	if nf.next.p >= 0 {
+		nf.seg = append(nf.seg, nf.next)
+		nf.next.p = -1
+	}
+	var rb [utf8.UTFMax]byte
+	for len(nf.seg) < maxSegment {
+		r, _, err := s.ReadRune()
+		if err != nil {
+			break
+		}
+		u := s.undo[s.ur]
+		if len(nf.seg) > 0 && nf.form.Properties(rb[:utf8.EncodeRune(rb[:], r)]).BoundaryBefore() {
+			nf.next = u
+			break
+		}
+		nf.seg = append(nf.seg, u)
+	}
+	s.nf, s.capt = nf, capt
+	s.undo, s.ur, s.uh = saved, ur, uh
+	if len(nf.seg) == 0 {
+		return
+	}
+	if len(nf.seg) == 1 && nf.seg[0].r < utf8.RuneSelf {
+		nf.out = append(nf.out, nf.seg[0])
+		return
+	}
+
+	nf.buf = nf.buf[:0]
+	for _, u := range nf.seg {
+		nf.buf = utf8.AppendRune(nf.buf, u.r)
+	}
+	nf.nbuf = nf.form.Append(nf.nbuf[:0], nf.buf...)
+	last := nf.seg[len(nf.seg)-1]
+	end := last.p + last.s
+	i := 0
+	for b := nf.nbuf; len(b) > 0; i++ {
+		r, w := utf8.DecodeRune(b)
+		b = b[w:]
+		var u undo
+		switch {
+		case i < len(nf.seg)-1 && len(b) > 0:
+			u = nf.seg[i]
+		case i < len(nf.seg):
+			u = undo{nf.seg[i].p, 0, end - nf.seg[i].p, 0}
+		default:
+			u = undo{end, 0, 0, 0}
+		}
+		u.r = r
+		nf.out = append(nf.out, u)
+	}
+}
@@ -0,0 +1,61 @@
+package lex_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/db47h/lex"
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestNormalize(t *testing.T) {
+	// runes are emitted one by one, words are read with AcceptWhileClass.
+	word := lex.NewClass(unicode.Letter)
+	init := func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		pos := s.Pos()
+		switch {
+		case r == lex.EOF:
+			s.Emit(pos, tokEOF, nil)
+		case r == '#':
+			s.AcceptWhileClass(word)
+			s.Backup()
+			s.Next()
+			s.EmitString(pos, tokChar, "#")
+		default:
+			s.EmitRune(pos, tokChar, r)
+		}
+		return nil
+	}
+	td := []struct {
+		form norm.Form
+		in   string
+		res  string
+	}{
+		{norm.NFC, "cafe\u0301 n\u0303\u0323x", "c0-1 a1-2 f2-3 é3-6 ' '6-7 \u1e477-8 \u03038-12 x12-13"},
+		{norm.NFD, "caf\u00e9 \u1e47", "c0-1 a1-2 f2-3 e3-5 \u03015-5 ' '5-6 n6-9 \u03239-9"},
+		{norm.NFC, "#a\u0301bc x", "#0-6 ' '6-7 x7-8"},
+	}
+	for _, d := range td {
+		l := lex.NewLexer(lex.NewFile("test", strings.NewReader(d.in)), init, lex.BufferSize(lex.MinBufferSize), lex.Normalize(d.form))
+		var res []string
+		for it := l.LexItem(); it.Type != tokEOF; it = l.LexItem() {
+			if it.Type == lex.Error {
+				t.Fatal(it.Err())
+			}
+			v, ok := it.Str()
+			if !ok {
+				r, _ := it.Rune()
+				if v = string(r); v == " " {
+					v = "' '"
+				}
+			}
+			res = append(res, fmt.Sprintf("%s%d-%d", v, it.Pos, it.End))
+		}
+		if got := strings.Join(res, " "); got != d.res {
+			t.Errorf("%q:\nGot     : %s\nExpected: %s", d.in, got, d.res)
+		}
+	}
+}
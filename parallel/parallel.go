@@ -0,0 +1,190 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package parallel lexes large in-memory inputs on multiple cores.
+//
+// The input is split into chunks at boundaries where the lexer is known to be
+// in its initial state, like newlines in a line-oriented language. Each chunk
+// is lexed by an independent lexer in its own goroutine, then the token
+// streams are merged and token offsets adjusted so that the result is the same
+// as if the whole input had been lexed by a single lexer:
+//
+//	f, items := parallel.Lex("app.log", src, tokEOF, newInit, parallel.Lines, 0)
+//	for _, it := range items {
+//		fmt.Println(f.Position(it.Pos), it.Type, it.Value())
+//	}
+//
+// Splitting at newlines is only correct for languages where tokens never span
+// multiple lines. Lexers for other languages need a custom Splitter, for
+// example one that only splits at blank lines or at newlines outside of
+// comments and strings.
+//
+package parallel
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+
+	"github.com/db47h/lex"
+)
+
+// A Splitter returns the offsets at which src should be split in order to be
+// lexed in n chunks of roughly equal size. The returned offsets must be in
+// increasing order and in the range (0, len(src)). Offsets that are not are
+// ignored. A Splitter may return fewer than n-1 offsets, for example if src is
+// too small to be worth splitting.
+//
+type Splitter func(src []byte, n int) []int
+
+// minChunk is the minimum size of a chunk for Lines.
+//
+const minChunk = 64 << 10
+
+// Lines is a Splitter that splits src right after newlines, in chunks of at
+// least 64KiB.
+//
+func Lines(src []byte, n int) []int {
+	if max := len(src) / minChunk; n > max {
+		n = max
+	}
+	var offs []int
+	prev := 0
+	for i := 1; i < n; i++ {
+		o := i * len(src) / n
+		if o <= prev {
+			o = prev + 1
+		}
+		// split after the first newline at or after o-1
+		j := bytes.IndexByte(src[o-1:], '\n')
+		if j < 0 {
+			break
+		}
+		o += j
+		if o >= len(src) {
+			break
+		}
+		offs = append(offs, o)
+		prev = o
+	}
+	return offs
+}
+
+// chunk is the result of lexing a single chunk.
+//
+type chunk struct {
+	offs  int
+	src   []byte
+	items []lex.Item
+	lines []int // chunk relative line offsets
+}
+
+// Lex splits src with split and lexes the resulting chunks in parallel with at
+// most n goroutines. If n <= 0, it defaults to runtime.GOMAXPROCS(0). name is
+// the file name used for the returned File.
+//
+// init is called once per chunk to obtain the initial state function of the
+// chunk's lexer, so that state functions with internal state (like the ones
+// returned by dfa.Machine.StateFn) are not shared between goroutines.
+//
+// Chunks are lexed until lex.Lexer.AtEOF reports true and the eof tokens of
+// all chunks except the last one are dropped. Lex returns a File that has all
+// the line information of src, suitable to convert token offsets to
+// positions, along with all the lexed tokens in input order.
+//
+func Lex(name string, src []byte, eof lex.Token, init func() lex.StateFn, split Splitter, n int) (*lex.File, []lex.Item) {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	var chunks []*chunk
+	prev := 0
+	for _, o := range split(src, n) {
+		if o <= prev || o >= len(src) {
+			continue
+		}
+		chunks = append(chunks, &chunk{offs: prev, src: src[prev:o]})
+		prev = o
+	}
+	chunks = append(chunks, &chunk{offs: prev, src: src[prev:]})
+
+	var wg sync.WaitGroup
+	work := make(chan *chunk)
+	for i := 0; i < n && i < len(chunks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				c.lex(init())
+			}
+		}()
+	}
+	for _, c := range chunks {
+		work <- c
+	}
+	close(work)
+	wg.Wait()
+
+	f := lex.NewFile(name, bytes.NewReader(src))
+	line := 0
+	size := 0
+	for _, c := range chunks {
+		size += len(c.items)
+	}
+	items := make([]lex.Item, 0, size)
+	for i, c := range chunks {
+		for _, o := range c.lines {
+			// the first line of a chunk is either a continuation of the last
+			// line of the previous chunk or has been added by the lexer of the
+			// previous chunk when reading its final newline.
+			if o == 0 && c.offs > 0 {
+				continue
+			}
+			line++
+			f.AddLine(c.offs+o, line)
+		}
+		last := i == len(chunks)-1
+		for _, it := range c.items {
+			if it.Type == eof && !last {
+				continue
+			}
+			it.Pos += c.offs
+			it.End += c.offs
+			items = append(items, it)
+		}
+	}
+	return f, items
+}
+
+// lex lexes the chunk with a lexer starting in state init.
+//
+func (c *chunk) lex(init lex.StateFn) {
+	f := lex.NewFile("", bytes.NewReader(c.src))
+	l := lex.NewLexer(f, init)
+	for !l.AtEOF() {
+		c.items = append(c.items, l.LexItem())
+	}
+	l.Release()
+	for i := 1; ; i++ {
+		o := f.LineOffset(i)
+		if o < 0 {
+			break
+		}
+		c.lines = append(c.lines, o)
+	}
+}
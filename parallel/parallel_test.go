@@ -0,0 +1,114 @@
+package parallel_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/db47h/lex"
+	"github.com/db47h/lex/parallel"
+)
+
+const (
+	tokEOF lex.Token = iota
+	tokWord
+)
+
+func newInit() lex.StateFn {
+	return func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case unicode.IsLetter(r):
+			pos := s.Pos()
+			for unicode.IsLetter(s.Peek()) {
+				s.Next()
+			}
+			s.Emit(pos, tokWord, nil)
+		case !unicode.IsSpace(r):
+			s.Errorf(s.Pos(), "unexpected %q", r)
+		}
+		return nil
+	}
+}
+
+// splitAt returns a Splitter that splits right after every occurrence of c.
+//
+func splitAt(c byte) parallel.Splitter {
+	return func(src []byte, n int) []int {
+		var offs []int
+		for i, b := range src {
+			if b == c {
+				offs = append(offs, i+1)
+			}
+		}
+		return offs
+	}
+}
+
+func dump(f *lex.File, items []lex.Item) string {
+	var b strings.Builder
+	for _, it := range items {
+		fmt.Fprintln(&b, f.Position(it.Pos), f.Position(it.End), it.Type, it.Value())
+	}
+	return b.String()
+}
+
+func TestLex(t *testing.T) {
+	src := []byte("foo bar\n\nbaz 42 quux\r\n  x\ny z\n")
+	f := lex.NewFile("test", bytes.NewReader(src))
+	l := lex.NewLexer(f, newInit())
+	var items []lex.Item
+	for !l.AtEOF() {
+		items = append(items, l.LexItem())
+	}
+	exp := dump(f, items)
+
+	for _, tc := range []struct {
+		name  string
+		split parallel.Splitter
+	}{
+		{"lines", parallel.Lines},
+		{"newline", splitAt('\n')},
+		{"space", splitAt(' ')},
+		{"bogus", func([]byte, int) []int { return []int{-1, 0, 4, 2, 4, 1000} }},
+	} {
+		for _, n := range []int{0, 1, 3} {
+			f, items := parallel.Lex("test", src, tokEOF, newInit, tc.split, n)
+			if got := dump(f, items); got != exp {
+				t.Errorf("%s/%d: got\n%s\nexpected\n%s", tc.name, n, got, exp)
+			}
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	line := strings.Repeat("x", 1023) + "\n"
+	src := []byte(strings.Repeat(line, 256))
+	offs := parallel.Lines(src, 4)
+	if len(offs) != 3 {
+		t.Fatalf("got %d offsets, expected 3", len(offs))
+	}
+	for i, o := range offs {
+		if o != (i+1)*len(src)/4 {
+			t.Errorf("offset %d: got %d, expected %d", i, o, (i+1)*len(src)/4)
+		}
+	}
+	if offs := parallel.Lines(src[:1000], 4); len(offs) != 0 {
+		t.Errorf("got %d offsets for small input, expected 0", len(offs))
+	}
+}
+
+func benchmarkLex(b *testing.B, n int) {
+	src := []byte(strings.Repeat("lorem ipsum dolor sit amet\n", 1<<16))
+	b.SetBytes(int64(len(src)))
+	for i := 0; i < b.N; i++ {
+		parallel.Lex("", src, tokEOF, newInit, parallel.Lines, n)
+	}
+}
+
+func BenchmarkLex_1(b *testing.B) { benchmarkLex(b, 1) }
+func BenchmarkLex_n(b *testing.B) { benchmarkLex(b, 0) }
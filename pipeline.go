@@ -0,0 +1,191 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+// A Stage is a step of a Pipeline. Process is called for each token read from
+// the previous stage, in order, and passes zero or more tokens to the next
+// stage by calling emit. A stage can therefore rewrite, drop or insert tokens,
+// and hold tokens back until it sees the following ones, for example to join
+// adjacent tokens.
+//
+// Stages see the EOF token of the lexer like any other token and must pass it
+// on, after any token they held back.
+//
+type Stage interface {
+	Process(it Item, emit func(Item))
+}
+
+// StageFunc is an adapter to use ordinary functions as stages.
+//
+type StageFunc func(it Item, emit func(Item))
+
+// Process calls f(it, emit).
+//
+func (f StageFunc) Process(it Item, emit func(Item)) {
+	f(it, emit)
+}
+
+// Map returns a stage that replaces every token it by f(it), for example to
+// promote identifiers to keywords:
+//
+//	lex.Map(func(it lex.Item) lex.Item {
+//		if s, _ := it.Str(); it.Type == tokIdent && keywords[s] != 0 {
+//			it.Type = keywords[s]
+//		}
+//		return it
+//	})
+//
+func Map(f func(it Item) Item) Stage {
+	return StageFunc(func(it Item, emit func(Item)) {
+		emit(f(it))
+	})
+}
+
+// Filter returns a stage that drops the tokens for which keep returns false.
+//
+func Filter(keep func(it Item) bool) Stage {
+	return StageFunc(func(it Item, emit func(Item)) {
+		if keep(it) {
+			emit(it)
+		}
+	})
+}
+
+// ConcatStrings returns a stage that merges runs of adjacent tokens of the
+// given types that have a string value into a single token, like the implicit
+// concatenation of string literals in C or Python: "foo" "bar" becomes
+// "foobar". The merged token has the type and start offset of the first token
+// of the run, the end offset of the last one, and the concatenation of their
+// values as value. Tokens of different types in the list can be merged.
+//
+// The returned stage holds back string tokens until it sees the next token. It
+// must not be shared between pipelines.
+//
+func ConcatStrings(types ...Token) Stage {
+	return &concat{types: types}
+}
+
+type concat struct {
+	types []Token
+	run   Item   // first token of the current run
+	n     int    // number of tokens in the run
+	buf   []byte // concatenated values
+}
+
+func (c *concat) Process(it Item, emit func(Item)) {
+	if s, ok := it.Str(); ok && c.match(it.Type) {
+		if c.n == 0 {
+			c.run, c.buf = it, append(c.buf[:0], s...)
+		} else {
+			c.run.End, c.buf = it.End, append(c.buf, s...)
+		}
+		c.n++
+		return
+	}
+	c.flush(emit)
+	emit(it)
+}
+
+func (c *concat) match(t Token) bool {
+	for _, ct := range c.types {
+		if t == ct {
+			return true
+		}
+	}
+	return false
+}
+
+// flush emits the current run.
+//
+func (c *concat) flush(emit func(Item)) {
+	switch {
+	case c.n == 1:
+		emit(c.run)
+	case c.n > 1:
+		emit(Item{Type: c.run.Type, Pos: c.run.Pos, End: c.run.End, kind: valString, s: string(c.buf)})
+	}
+	c.run, c.n = Item{}, 0
+}
+
+// A Pipeline reads tokens from an ItemSource and passes them through a
+// sequence of stages that can rewrite them between the lexer and the parser:
+//
+//	p := lex.NewPipeline(l,
+//		lex.Filter(func(it lex.Item) bool { return it.Type != tokComment }),
+//		lex.Map(promoteKeywords),
+//		insertSemicolons,
+//	)
+//	for it := p.LexItem(); it.Type != tokEOF; it = p.LexItem() {
+//		// ...
+//	}
+//
+// Tokens are read from the source on demand, one at a time, until the last
+// stage emits a token.
+//
+type Pipeline struct {
+	src  ItemSource
+	emit func(Item) // input of the first stage
+	out  []Item     // output of the last stage
+	head int        // index of the next token in out
+}
+
+var _ TokenSource = (*Pipeline)(nil)
+
+// NewPipeline returns a new Pipeline that passes the tokens of src through the
+// given stages, in order.
+//
+func NewPipeline(src ItemSource, stages ...Stage) *Pipeline {
+	p := &Pipeline{src: src}
+	p.emit = func(it Item) { p.out = append(p.out, it) }
+	for i := len(stages) - 1; i >= 0; i-- {
+		st, next := stages[i], p.emit
+		p.emit = func(it Item) { st.Process(it, next) }
+	}
+	return p
+}
+
+// LexItem returns the next token emitted by the last stage.
+//
+func (p *Pipeline) LexItem() Item {
+	for p.head == len(p.out) {
+		p.out, p.head = p.out[:0], 0
+		p.emit(p.src.LexItem())
+	}
+	it := p.out[p.head]
+	p.out[p.head] = Item{}
+	p.head++
+	return it
+}
+
+// Lex returns the next token like Lexer.Lex.
+//
+func (p *Pipeline) Lex() (Token, int, interface{}) {
+	it := p.LexItem()
+	return it.Type, it.Pos, it.Value()
+}
+
+// AtEOF reports whether the source has reached the end of input and all the
+// tokens emitted by the last stage have been returned. The source must
+// implement an AtEOF method like Lexer.AtEOF, otherwise AtEOF returns false.
+//
+func (p *Pipeline) AtEOF() bool {
+	src, ok := p.src.(interface{ AtEOF() bool })
+	return ok && p.head == len(p.out) && src.AtEOF()
+}
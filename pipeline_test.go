@@ -0,0 +1,94 @@
+package lex_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestPipeline(t *testing.T) {
+	init := func(s *lex.State) lex.StateFn {
+		if r := s.Next(); r == lex.EOF {
+			s.Emit(s.Pos(), tokEOF, nil)
+		} else {
+			s.EmitRune(s.Pos(), tokChar, r)
+		}
+		return nil
+	}
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader("a b\nc\n")), init)
+	p := lex.NewPipeline(l,
+		// drop spaces
+		lex.Filter(func(it lex.Item) bool {
+			r, _ := it.Rune()
+			return r != ' '
+		}),
+		// upper case
+		lex.Map(func(it lex.Item) lex.Item {
+			if r, ok := it.Rune(); ok && r >= 'a' && r <= 'z' {
+				return lex.NewItem(it.Type, it.Pos, it.End, r-'a'+'A')
+			}
+			return it
+		}),
+		// replace newlines with semicolons, except at the end of input.
+		lex.StageFunc(func() func(lex.Item, func(lex.Item)) {
+			var nl []lex.Item
+			return func(it lex.Item, emit func(lex.Item)) {
+				if r, _ := it.Rune(); r == '\n' {
+					nl = append(nl, lex.NewItem(tokChar, it.Pos, it.End, ';'))
+					return
+				}
+				if it.Type != tokEOF {
+					for _, n := range nl {
+						emit(n)
+					}
+				}
+				nl = nl[:0]
+				emit(it)
+			}
+		}()),
+	)
+	var b strings.Builder
+	for !p.AtEOF() {
+		if r, ok := p.LexItem().Rune(); ok {
+			b.WriteRune(r)
+		}
+	}
+	if b.String() != "AB;C" {
+		t.Errorf("got %q, expected %q", b.String(), "AB;C")
+	}
+}
+
+func TestConcatStrings(t *testing.T) {
+	const tokString = tokSpace
+	// words are emitted as strings, other runes as runes.
+	init := func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		pos := s.Pos()
+		switch {
+		case r == lex.EOF:
+			s.Emit(pos, tokEOF, nil)
+		case r >= 'a' && r <= 'z':
+			var b strings.Builder
+			for ; r >= 'a' && r <= 'z'; r = s.Next() {
+				b.WriteRune(r)
+			}
+			s.Backup()
+			s.EmitString(pos, tokString, b.String())
+		case r != ' ':
+			s.EmitRune(pos, tokChar, r)
+		}
+		return nil
+	}
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader("foo bar baz, qux")), init)
+	p := lex.NewPipeline(l, lex.ConcatStrings(tokString))
+	var res []string
+	for !p.AtEOF() {
+		it := p.LexItem()
+		res = append(res, fmt.Sprintf("%v %d-%d", it.Value(), it.Pos, it.End))
+	}
+	if got, exp := strings.Join(res, ", "), "foobarbaz 0-11, 44 11-12, qux 13-16, <nil> 16-16"; got != exp {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+}
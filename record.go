@@ -0,0 +1,161 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A Recording holds the input read by a lexer up to the point where a problem
+// occurred, along with the lexer options needed to reproduce it. See Record.
+//
+type Recording struct {
+	Name    string      // file name
+	Options []string    // options that affect lexing, as returned by Option.String
+	Input   []byte      // input read so far
+	Pos     Position    // position of the error, or of the current rune upon panic
+	Err     error       // first error reported by the lexer, nil upon panic
+	Panic   interface{} // value passed to panic, if any
+	opts    []Option
+}
+
+// Record captures all the input read by the lexer and calls fn with a
+// Recording when the first Error token is emitted, and again if a state
+// function panics. This makes it possible to reproduce problems with streamed
+// input that cannot be read twice, like network connections or standard
+// input:
+//
+//	l := lex.NewLexer(f, initState, lex.Record(func(r *lex.Recording) {
+//		if f, err := os.Create("crash.lex"); err == nil {
+//			r.WriteTo(f)
+//			f.Close()
+//		}
+//	}))
+//
+// All the options given to NewLexer are recorded, in order, except for those
+// that do not change the tokens produced from the recorded input, like
+// WithTrace, CollectStats, TokenNames or Record itself. Upon panic, the panic
+// is resumed with the same value after fn returns.
+//
+// The whole input is kept in memory for the lifetime of the lexer. fn is
+// called from Lex or LexBatch and must not call methods of the lexer. The
+// recorded input is not modified after fn returns and can be retained.
+//
+func Record(fn func(*Recording)) Option {
+	return debugOption(func(s *state) {
+		s.rec = &recorder{fn: fn}
+	}, "Record", "fn")
+}
+
+type recorder struct {
+	fn    func(*Recording)
+	buf   []byte
+	opts  []Option // recorded options
+	error bool     // the first error has been reported
+}
+
+// initRecorder resets the recorder, records the options in opts that change
+// the tokens produced and sets up the queue hook for Error tokens.
+//
+func (s *state) initRecorder(opts []Option) {
+	r := s.rec
+	r.buf, r.opts, r.error = nil, nil, false
+	for _, o := range opts {
+		if o.set != nil && !o.debug {
+			r.opts = append(r.opts, o)
+		}
+	}
+	check := s.check
+	s.check = func(it Item) {
+		if check != nil {
+			check(it)
+		}
+		if it.Type == Error && !r.error {
+			r.error = true
+			err, ok := it.Value().(error)
+			if !ok {
+				err = fmt.Errorf("%v", it.Value())
+			}
+			r.fn((*State)(s).recording(s.f.Position(it.Pos), err, nil))
+		}
+	}
+}
+
+// recover reports a panic in a state function and resumes it.
+//
+func (s *State) recover() {
+	if p := recover(); p != nil {
+		pos := s.Pos()
+		if pos < 0 {
+			pos = s.offs + s.r
+		}
+		s.rec.fn(s.recording(s.f.Position(pos), nil, p))
+		panic(p)
+	}
+}
+
+func (s *State) recording(pos Position, err error, p interface{}) *Recording {
+	r := &Recording{
+		Name:  s.f.Name(),
+		Input: s.rec.buf[:len(s.rec.buf):len(s.rec.buf)],
+		Pos:   pos,
+		Err:   err,
+		Panic: p,
+		opts:  s.rec.opts,
+	}
+	for _, o := range s.rec.opts {
+		r.Options = append(r.Options, o.String())
+	}
+	return r
+}
+
+// Replay returns a new lexer for the recorded input, configured with the
+// recorded options.
+//
+func (r *Recording) Replay(init StateFn) *Lexer {
+	return NewLexer(NewFile(r.Name, strings.NewReader(string(r.Input))), init, r.opts...)
+}
+
+// WriteTo writes a report of the recording to w: a header with the file name,
+// options, error or panic value and input size, one per line and prefixed with
+// "# ", followed by the raw input.
+//
+func (r *Recording) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# file: %s\n", r.Name)
+	if len(r.Options) > 0 {
+		fmt.Fprintf(&b, "# options: %s\n", strings.Join(r.Options, ", "))
+	}
+	if r.Err != nil {
+		fmt.Fprintf(&b, "# error: %v: %v\n", r.Pos, r.Err)
+	}
+	if r.Panic != nil {
+		fmt.Fprintf(&b, "# panic: %v: %v\n", r.Pos, r.Panic)
+	}
+	fmt.Fprintf(&b, "# input: %d bytes\n", len(r.Input))
+	n, err := io.WriteString(w, b.String())
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(r.Input)
+	return int64(n + m), err
+}
@@ -0,0 +1,85 @@
+package lex_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestRecord(t *testing.T) {
+	var recs []*lex.Recording
+	init := func(s *lex.State) lex.StateFn {
+		switch r := s.Next(); r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case '!':
+			panic("bang")
+		default:
+			s.Emit(s.Pos(), tokChar, r)
+		}
+		return nil
+	}
+	f := lex.NewFile("test", strings.NewReader("ab\r\nc\x00d!e"))
+	l := lex.NewLexer(f, init, lex.BufferSize(16), lex.Newlines(lex.NewlineCRLF), lex.Record(func(r *lex.Recording) {
+		recs = append(recs, r)
+	}))
+	func() {
+		defer func() {
+			if p := recover(); p != "bang" {
+				t.Errorf("unexpected panic value %v", p)
+			}
+		}()
+		for tt, _, _ := l.Lex(); tt != tokEOF; tt, _, _ = l.Lex() {
+		}
+	}()
+	if len(recs) != 2 {
+		t.Fatalf("got %d recordings, expected 2", len(recs))
+	}
+	var b strings.Builder
+	recs[0].WriteTo(&b)
+	exp := "# file: test\n" +
+		"# options: lex.BufferSize(16), lex.Newlines(NewlineCRLF)\n" +
+		"# error: test:2:2: invalid NUL character\n" +
+		"# input: 9 bytes\n" +
+		"ab\r\nc\x00d!e"
+	if got := b.String(); got != exp {
+		t.Errorf("got:\n%q\nexpected:\n%q", got, exp)
+	}
+	if r := recs[1]; r.Panic != "bang" || r.Err != nil || r.Pos.String() != "test:2:4" {
+		t.Errorf("unexpected panic recording %v %v %v", r.Pos, r.Err, r.Panic)
+	}
+
+	// replay up to the error
+	var got []lex.Token
+	l = recs[0].Replay(func(s *lex.State) lex.StateFn {
+		if s.Next() == lex.EOF {
+			s.Emit(s.Pos(), tokEOF, nil)
+		} else {
+			s.Emit(s.Pos(), tokChar, nil)
+		}
+		return nil
+	})
+	for tt, _, _ := l.Lex(); tt != tokEOF; tt, _, _ = l.Lex() {
+		got = append(got, tt)
+	}
+	if len(got) != 8 || got[4] != lex.Error {
+		t.Errorf("unexpected tokens on replay: %v", got)
+	}
+}
+
+func TestRecord_Options(t *testing.T) {
+	var rec *lex.Recording
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader("")), func(s *lex.State) lex.StateFn {
+		s.Errorf(0, "error")
+		return nil
+	}, lex.Encoding(charmap.ISO8859_1), lex.TokenNames(map[lex.Token]string{tokSpace: "Space"}), lex.Lossless(tokSpace),
+		lex.WithTrace(func(lex.TraceEvent) {}), lex.Channels(map[lex.Token]lex.TokenChannel{tokSpace: lex.HiddenChannel, tokChar: 3}),
+		lex.Record(func(r *lex.Recording) { rec = r }))
+	l.Lex()
+	exp := "lex.Encoding(ISO 8859-1), lex.Lossless(1), lex.Channels(map[1:1 2:3])"
+	if got := strings.Join(rec.Options, ", "); got != exp {
+		t.Errorf("got %s, expected %s", got, exp)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import "bytes"
+
+// MarkIncomplete tells that the end of input has been reached in the middle of
+// a construct that more input could complete, like a string literal or a
+// block comment. It is meant to be called by state functions upon reading EOF,
+// usually right before reporting an error. See Lexer.Incomplete and Feeder.
+//
+func (s *State) MarkIncomplete() {
+	s.incompl = true
+}
+
+// Incomplete reports whether a state function has called
+// State.MarkIncomplete.
+//
+func (l *Lexer) Incomplete() bool {
+	return l.incompl
+}
+
+// A Feeder lexes input fed one line, or chunk, at a time, as typed in a REPL.
+// After each chunk, it tells whether the input is complete or whether the
+// REPL should show a continuation prompt and read more input.
+//
+// Since input is lexed from the start after each chunk, a Feeder is meant for
+// interactive input of moderate size.
+//
+// Chunks fed with FeedChunk carry their own name and line number, like
+// "repl:3" for the third entry of a session, so that Position can report
+// positions relative to the entry they belong to.
+//
+type Feeder struct {
+	name   string
+	init   func() StateFn
+	pairs  map[Token]Token
+	opts   []Option
+	src    []byte
+	f      *File
+	chunks []chunk
+}
+
+// chunk is the start of an input chunk with its own name and line base.
+//
+type chunk struct {
+	off  int
+	name string
+	line int
+}
+
+// NewFeeder returns a new Feeder. The name and opts arguments are the same as
+// for NewFile and NewLexer. init is called to get the initial state function
+// of a new lexer every time the input is lexed. pairs maps the types of
+// opening brackets to the type of the matching closing brackets (see
+// MatchBrackets), or is nil.
+//
+func NewFeeder(name string, init func() StateFn, pairs map[Token]Token, opts ...Option) *Feeder {
+	return &Feeder{name: name, init: init, pairs: pairs, opts: opts}
+}
+
+// Feed appends text to the input and lexes all the input fed since the last
+// call to Reset, until the lexer reaches the end of input (see
+// Lexer.AtEOF). It returns the tokens and reports whether the input is
+// complete. The input is incomplete if a state function has called
+// State.MarkIncomplete or if there are opening brackets that have not been
+// closed.
+//
+// Tokens are returned even if the input is incomplete, so that errors other
+// than incomplete input can be reported right away.
+//
+func (fd *Feeder) Feed(text []byte) (items []Item, complete bool) {
+	fd.src = append(fd.src, text...)
+	fd.f = NewFile(fd.name, bytes.NewReader(fd.src))
+	l := NewLexer(fd.f, fd.init(), fd.opts...)
+	for !l.AtEOF() {
+		items = append(items, l.LexItem())
+	}
+	complete = !l.Incomplete()
+	l.Release()
+	if complete && fd.pairs != nil {
+		complete = MatchBrackets(items, fd.pairs).Depth(len(fd.src)) == 0
+	}
+	return items, complete
+}
+
+// FeedChunk is like Feed, but positions in text, and in text fed afterwards
+// with Feed, are reported by Position with the given name and relative to
+// the given line number, which is the line number of the first line of text.
+//
+func (fd *Feeder) FeedChunk(name string, line int, text []byte) (items []Item, complete bool) {
+	fd.chunks = append(fd.chunks, chunk{off: len(fd.src), name: name, line: line})
+	return fd.Feed(text)
+}
+
+// Position returns the position of offset in the input. If offset is part of
+// a chunk fed with FeedChunk, the position is relative to that chunk.
+// Otherwise it is the position in the whole input, with the name passed to
+// NewFeeder.
+//
+func (fd *Feeder) Position(offset int) Position {
+	if fd.f == nil {
+		return Position{Filename: fd.name, Line: 1, Column: 1}
+	}
+	p := fd.f.Position(offset)
+	for i := len(fd.chunks) - 1; i >= 0; i-- {
+		if c := fd.chunks[i]; c.off <= offset {
+			p.Filename = c.name
+			p.Line = c.line + p.Line - fd.f.Position(c.off).Line
+			break
+		}
+	}
+	return p
+}
+
+// Input returns the input fed since the last call to Reset.
+//
+func (fd *Feeder) Input() []byte {
+	return fd.src
+}
+
+// Reset discards the input, usually after a complete input has been
+// processed.
+//
+func (fd *Feeder) Reset() {
+	fd.src = fd.src[:0]
+	fd.f = nil
+	fd.chunks = fd.chunks[:0]
+}
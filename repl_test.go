@@ -0,0 +1,82 @@
+package lex_test
+
+import (
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestFeeder(t *testing.T) {
+	const (
+		tokLParen lex.Token = iota + 10
+		tokRParen
+		tokString
+	)
+	init := func() lex.StateFn {
+		return func(s *lex.State) lex.StateFn {
+			r := s.Next()
+			pos := s.Pos()
+			switch r {
+			case lex.EOF:
+				s.Emit(pos, tokEOF, nil)
+			case '(':
+				s.Emit(pos, tokLParen, nil)
+			case ')':
+				s.Emit(pos, tokRParen, nil)
+			case '"':
+				for r = s.Next(); r != '"'; r = s.Next() {
+					if r == lex.EOF {
+						s.MarkIncomplete()
+						s.Errorf(pos, "unterminated string")
+						return nil
+					}
+				}
+				s.Emit(pos, tokString, nil)
+			}
+			return nil
+		}
+	}
+	fd := lex.NewFeeder("repl", init, map[lex.Token]lex.Token{tokLParen: tokRParen})
+	for i, d := range []struct {
+		line     string
+		complete bool
+	}{
+		{"(a \"b\n", false},
+		{"c\" \n", false},
+		{"d))\n", true},
+		{"", true}, // after Reset
+		{"\"\n", false},
+		{"\"\n", true},
+	} {
+		items, complete := fd.Feed([]byte(d.line))
+		if complete != d.complete {
+			t.Errorf("line %d: got complete %v, input %q, tokens %v", i, complete, fd.Input(), items)
+		}
+		if complete {
+			fd.Reset()
+		}
+	}
+}
+
+func TestFeeder_Position(t *testing.T) {
+	init := func() lex.StateFn {
+		return func(s *lex.State) lex.StateFn {
+			if s.Next() == lex.EOF {
+				s.Emit(s.Pos(), tokEOF, nil)
+			}
+			return nil
+		}
+	}
+	fd := lex.NewFeeder("stdin", init, nil)
+	fd.Feed([]byte("a\n"))
+	fd.FeedChunk("repl:2", 1, []byte("bc\nd"))
+	fd.Feed([]byte("e\nf\n"))
+	for _, d := range []struct {
+		off int
+		exp string
+	}{{0, "stdin:1:1"}, {3, "repl:2:1:2"}, {6, "repl:2:2:2"}, {8, "repl:2:3:1"}} {
+		if p := fd.Position(d.off).String(); p != d.exp {
+			t.Errorf("Position(%d): got %s, expected %s", d.off, p, d.exp)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+// A Recorder wraps a Lexer and records all the tokens it returns so that they
+// can be replayed any number of times. This is useful for multi-pass
+// processing, like two-pass assemblers, or for speculative parsing:
+//
+//	m := r.Mark()
+//	if !parseRuleA(r) {
+//		r.Rewind(m)
+//		parseRuleB(r)
+//	}
+//
+// Tokens are lexed on demand and kept in memory for the lifetime of the
+// Recorder. Once a Recorder has been created, the lexer must not be read
+// directly.
+//
+type Recorder struct {
+	l     *Lexer
+	items []Item
+	pos   int
+}
+
+var _ TokenSource = (*Recorder)(nil)
+
+// NewRecorder returns a new Recorder for the tokens of l.
+//
+func NewRecorder(l *Lexer) *Recorder {
+	return &Recorder{l: l}
+}
+
+// Lex returns the next token like Lexer.Lex.
+//
+func (r *Recorder) Lex() (Token, int, interface{}) {
+	it := r.LexItem()
+	return it.Type, it.Pos, it.Value()
+}
+
+// LexItem returns the next token like Lexer.LexItem. If the Recorder has been
+// rewound, the next recorded token is returned instead of a new one.
+//
+func (r *Recorder) LexItem() Item {
+	if r.pos == len(r.items) {
+		r.items = append(r.items, r.l.LexItem())
+	}
+	r.pos++
+	return r.items[r.pos-1]
+}
+
+// AtEOF reports whether all the recorded tokens have been returned and the
+// lexer has reached the end of input, like Lexer.AtEOF.
+//
+func (r *Recorder) AtEOF() bool {
+	return r.pos == len(r.items) && r.l.AtEOF()
+}
+
+// File returns the File used as input for the lexer.
+//
+func (r *Recorder) File() *File {
+	return r.l.File()
+}
+
+// Mark returns the number of tokens returned so far, to be used with Rewind.
+//
+func (r *Recorder) Mark() int {
+	return r.pos
+}
+
+// Rewind moves the Recorder to the given mark: the next token returned by
+// LexItem is the token that followed the mark. Rewind(0) replays all the
+// tokens from the start. Marks can be used in any order, but Rewind panics if
+// mark is negative or past the last recorded token.
+//
+func (r *Recorder) Rewind(mark int) {
+	if mark < 0 || mark > len(r.items) {
+		panic("lex: mark out of range")
+	}
+	r.pos = mark
+}
+
+// Items returns the tokens recorded so far. The returned slice must not be
+// modified.
+//
+func (r *Recorder) Items() []Item {
+	return r.items[:len(r.items):len(r.items)]
+}
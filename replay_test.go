@@ -0,0 +1,52 @@
+package lex_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestRecorder(t *testing.T) {
+	init := func(s *lex.State) lex.StateFn {
+		if r := s.Next(); r == lex.EOF {
+			s.Emit(s.Pos(), tokEOF, nil)
+		} else {
+			s.EmitRune(s.Pos(), tokChar, r)
+		}
+		return nil
+	}
+	r := lex.NewRecorder(lex.NewLexer(lex.NewFile("test", strings.NewReader("abcd")), init))
+	read := func(n int) string {
+		var b strings.Builder
+		for ; n > 0; n-- {
+			if v, ok := r.LexItem().Rune(); ok {
+				b.WriteRune(v)
+			}
+		}
+		return b.String()
+	}
+	if s := read(2); s != "ab" {
+		t.Fatalf("got %q, expected ab", s)
+	}
+	m := r.Mark()
+	if s := read(2); s != "cd" {
+		t.Fatalf("got %q, expected cd", s)
+	}
+	end := r.Mark()
+	r.Rewind(m)
+	if s := read(1); s != "c" {
+		t.Fatalf("got %q after Rewind, expected c", s)
+	}
+	r.Rewind(0)
+	if s := read(4); s != "abcd" {
+		t.Fatalf("got %q after Rewind(0), expected abcd", s)
+	}
+	r.Rewind(end)
+	if tok, _, _ := r.Lex(); tok != tokEOF || !r.AtEOF() {
+		t.Fatalf("got %d, expected EOF", tok)
+	}
+	if n := len(r.Items()); n != 5 {
+		t.Fatalf("got %d recorded items, expected 5", n)
+	}
+}
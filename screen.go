@@ -0,0 +1,219 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Warning is the token type for warnings emitted by the lexer. Like Error
+// tokens, Warning tokens have an error value.
+//
+const Warning Token = -2
+
+// Warnings emitted by the Screen option. The values of Warning tokens wrap
+// these errors and can be tested with errors.Is.
+//
+var (
+	ErrBidiControl = errors.New("bidirectional control character")
+	ErrInvisible   = errors.New("invisible character")
+	ErrMixedScript = errors.New("mixed-script identifier")
+)
+
+// Screen enables security screening of identifiers and strings, along the
+// lines of Unicode Technical Report #39 and the "Trojan Source" attacks, where
+// characters that are invisible or that look like others make code read
+// differently from how it is compiled. Tokens of types in idents and strs
+// that have a string value are checked for:
+//
+//   - bidirectional control characters like U+202E (RIGHT-TO-LEFT OVERRIDE),
+//     which can reorder the display of source code.
+//   - invisible characters like U+200B (ZERO WIDTH SPACE), U+200D (ZERO WIDTH
+//     JOINER) or U+00AD (SOFT HYPHEN).
+//   - in identifiers only, characters from several scripts, like a Cyrillic
+//     'а' in an otherwise Latin identifier. Characters common to all scripts,
+//     like digits and '_', are ignored and the combinations of Han with
+//     Hiragana, Katakana, Bopomofo or Hangul, possibly with Latin, used to
+//     write Japanese, Chinese and Korean are allowed.
+//
+// Each problem is reported as a Warning token emitted right before the
+// offending token. If the string value of the token has the same length as
+// the token in the input, it is assumed to be the token text and Warning
+// tokens cover the offending characters. Otherwise, they cover the whole token
+// (for example a quoted string with escape sequences). Warnings for mixed
+// scripts always cover the whole token.
+//
+func Screen(idents, strs []Token) Option {
+	return option(func(s *state) {
+		sc := &screen{idents: idents, strs: strs, kinds: make(map[Token]bool)}
+		for _, t := range strs {
+			sc.kinds[t] = false
+		}
+		for _, t := range idents {
+			sc.kinds[t] = true
+		}
+		s.sc = sc
+	}, "Screen", idents, strs)
+}
+
+type screen struct {
+	idents  []Token
+	strs    []Token
+	kinds   map[Token]bool // true for identifiers, false for strings
+	scripts []string       // scripts found in the current identifier
+}
+
+// invisible contains invisible characters other than bidi controls and white
+// space.
+//
+var invisible = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00ad, Hi: 0x00ad, Stride: 1},
+		{Lo: 0x034f, Hi: 0x034f, Stride: 1},
+		{Lo: 0x115f, Hi: 0x1160, Stride: 1},
+		{Lo: 0x17b4, Hi: 0x17b5, Stride: 1},
+		{Lo: 0x180b, Hi: 0x180e, Stride: 1},
+		{Lo: 0x200b, Hi: 0x200d, Stride: 1},
+		{Lo: 0x2060, Hi: 0x2064, Stride: 1},
+		{Lo: 0x3164, Hi: 0x3164, Stride: 1},
+		{Lo: 0xfe00, Hi: 0xfe0f, Stride: 1},
+		{Lo: 0xfeff, Hi: 0xfeff, Stride: 1},
+		{Lo: 0xffa0, Hi: 0xffa0, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0xe0000, Hi: 0xe0fff, Stride: 1},
+	},
+}
+
+// cjkScripts lists the sets of scripts allowed together in identifiers.
+//
+var cjkScripts = [...]string{
+	"Han Hiragana Katakana Latin",
+	"Bopomofo Han Latin",
+	"Hangul Han Latin",
+}
+
+// scriptNames are the names of the scripts in unicode.Scripts in a fixed order.
+//
+var scriptNames = func() []string {
+	names := make([]string, 0, len(unicode.Scripts))
+	for n := range unicode.Scripts {
+		if n != "Common" && n != "Inherited" {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}()
+
+func (s *state) initScreen() {
+	check := s.check
+	s.check = func(it Item) {
+		if ident, ok := s.sc.kinds[it.Type]; ok {
+			(*State)(s).screen(it, ident)
+		}
+		if check != nil {
+			check(it)
+		}
+	}
+}
+
+// screen checks the value of it and emits warnings.
+//
+func (s *State) screen(it Item, ident bool) {
+	v, ok := it.Str()
+	if !ok {
+		return
+	}
+	sc := s.sc
+	sc.scripts = sc.scripts[:0]
+	exact := len(v) == it.End-it.Pos
+	for i, r := range v {
+		if r < utf8.RuneSelf {
+			if ident && ('a' <= r|0x20 && r|0x20 <= 'z') {
+				sc.addScript(r)
+			}
+			continue
+		}
+		var err error
+		switch {
+		case unicode.Is(unicode.Bidi_Control, r):
+			err = ErrBidiControl
+		case unicode.Is(invisible, r):
+			err = ErrInvisible
+		case ident:
+			sc.addScript(r)
+			continue
+		default:
+			continue
+		}
+		w := Item{Type: Warning, Pos: it.Pos, End: it.End, v: fmt.Errorf("%w %U", err, r)}
+		if exact {
+			w.Pos += i
+			w.End = w.Pos + utf8.RuneLen(r)
+		}
+		s.add(w)
+	}
+	if len(sc.scripts) > 1 && !sc.cjk() {
+		sort.Strings(sc.scripts)
+		s.add(Item{Type: Warning, Pos: it.Pos, End: it.End, v: fmt.Errorf("%w: %s", ErrMixedScript, strings.Join(sc.scripts, ", "))})
+	}
+}
+
+// addScript adds the script of r to the list of scripts of the current
+// identifier.
+//
+func (sc *screen) addScript(r rune) {
+	for _, n := range sc.scripts {
+		if unicode.Is(unicode.Scripts[n], r) {
+			return
+		}
+	}
+	if unicode.In(r, unicode.Common, unicode.Inherited) {
+		return
+	}
+	for _, n := range scriptNames {
+		if unicode.Is(unicode.Scripts[n], r) {
+			sc.scripts = append(sc.scripts, n)
+			return
+		}
+	}
+}
+
+// cjk reports whether the scripts of the current identifier are an allowed
+// combination.
+//
+func (sc *screen) cjk() bool {
+next:
+	for _, set := range cjkScripts {
+		for _, n := range sc.scripts {
+			if !strings.Contains(" "+set+" ", " "+n+" ") {
+				continue next
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package lex_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestScreen(t *testing.T) {
+	const tokIdent, tokString = tokSpace, tokChar
+	init := func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		pos := s.Pos()
+		switch {
+		case r == lex.EOF:
+			s.Emit(pos, tokEOF, nil)
+		case r == '"':
+			var b strings.Builder
+			for r = s.Next(); r != '"' && r != lex.EOF; r = s.Next() {
+				b.WriteRune(r)
+			}
+			s.EmitString(pos, tokString, b.String())
+		case lex.IsIdentifierStart(r):
+			var b strings.Builder
+			b.WriteRune(r)
+			for lex.IsIdentifierContinue(s.Peek()) || s.Peek() == '\u200b' {
+				b.WriteRune(s.Next())
+			}
+			s.EmitString(pos, tokIdent, b.String())
+		}
+		return nil
+	}
+	in := "p\u0430ypal x\u200by \"abc\u202edef\" 日本語カナ Σ1 \"a\u200db\" абв"
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader(in)), init,
+		lex.WithValidation(), lex.Screen([]lex.Token{tokIdent}, []lex.Token{tokString}))
+	var res []string
+	for it := l.LexItem(); it.Type != tokEOF; it = l.LexItem() {
+		if it.Type != lex.Warning {
+			continue
+		}
+		if !errors.Is(it.Err(), lex.ErrBidiControl) && !errors.Is(it.Err(), lex.ErrInvisible) && !errors.Is(it.Err(), lex.ErrMixedScript) {
+			t.Errorf("unexpected warning %v", it.Err())
+		}
+		res = append(res, fmt.Sprintf("%d-%d %v", it.Pos, it.End, it.Err()))
+	}
+	exp := []string{
+		"0-7 mixed-script identifier: Cyrillic, Latin",
+		"9-12 invisible character U+200B",
+		"14-25 bidirectional control character U+202E",
+		"46-53 invisible character U+200D",
+	}
+	if got := strings.Join(res, "\n"); got != strings.Join(exp, "\n") {
+		t.Errorf("Got:\n%s\nExpected:\n%s", got, strings.Join(exp, "\n"))
+	}
+}
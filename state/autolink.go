@@ -0,0 +1,160 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+// Autolink returns a StateFn that recognizes URLs and email addresses in
+// text, using rules similar to the autolink extension of GitHub Flavored
+// Markdown.
+//
+// When entering the StateFn, the first character of a word has already been
+// read. The word is made of letters, digits and underscores, with embedded
+// '.', '+' and '-' characters. Then:
+//
+//   - a word that is a URL scheme followed by "://", or a word starting with
+//     "www.", starts a URL. The URL extends up to the next white space or
+//     '<', except for trailing punctuation (one of ?!.,:*_~'") and unbalanced
+//     closing parentheses. It is emitted as a token of type url.
+//   - a word followed by '@' and a domain name with at least one dot is emitted
+//     as a token of type email. The domain name must not end with '-' or '_'.
+//   - anything else is emitted as a token of type word.
+//
+// All tokens have a string value. Since the lexer cannot backtrack past
+// lex.BackupBufferSize runes, trailing punctuation is kept in the URL if it
+// is longer than that.
+//
+func Autolink(word, url, email lex.Token) lex.StateFn {
+	s := make([]byte, 0, 64)
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		s = utf8.AppendRune(s[:0], l.Current())
+		s = readWord(l, s)
+		t := word
+		switch r := l.Peek(); {
+		case r == ':' && isScheme(s):
+			l.Next()
+			n := 1
+			for ; n < 3 && l.Peek() == '/'; n++ {
+				l.Next()
+			}
+			if n == 3 && !isURLEnd(l.Peek()) {
+				s = append(s, "://"...)
+				s, t = readURL(l, s), url
+				break
+			}
+			for ; n > 0; n-- {
+				l.Backup()
+			}
+		case len(s) > 4 && strings.EqualFold(string(s[:4]), "www."):
+			s, t = readURL(l, s), url
+		case r == '@':
+			l.Next()
+			if r = l.Peek(); !isAlnum(r) {
+				l.Backup()
+				break
+			}
+			s = readWord(l, append(s, '@'))
+			at := strings.LastIndexByte(string(s), '@')
+			if d := s[at+1:]; strings.IndexByte(string(d), '.') > 0 && !strings.ContainsAny(string(d), "+") {
+				if c := d[len(d)-1]; c != '-' && c != '_' {
+					t = email
+				}
+			}
+		}
+		l.EmitString(pos, t, string(s))
+		return nil
+	}
+}
+
+// readWord appends to s the remaining characters of a word.
+//
+func readWord(l *lex.State, s []byte) []byte {
+	for {
+		r := l.Peek()
+		switch {
+		case isAlnum(r):
+			s = utf8.AppendRune(s, l.Next())
+		case r == '.' || r == '+' || r == '-':
+			l.Next()
+			if !isAlnum(l.Peek()) {
+				l.Backup()
+				return s
+			}
+			s = append(s, byte(r))
+		default:
+			return s
+		}
+	}
+}
+
+// readURL appends to s the remaining characters of a URL and backs up over
+// trailing punctuation.
+//
+func readURL(l *lex.State, s []byte) []byte {
+	start := len(s)
+	for r := l.Peek(); !isURLEnd(r); r = l.Peek() {
+		s = utf8.AppendRune(s, l.Next())
+	}
+	// trailing punctuation
+	open := strings.Count(string(s[start:]), "(") - strings.Count(string(s[start:]), ")")
+	n := len(s)
+	for n > start {
+		c := s[n-1]
+		if strings.IndexByte("?!.,:*_~'\"", c) < 0 && (c != ')' || open >= 0) {
+			break
+		}
+		if c == ')' {
+			open++
+		}
+		n--
+	}
+	if len(s)-n < lex.BackupBufferSize-1 {
+		for i := n; i < len(s); i++ {
+			l.Backup()
+		}
+		s = s[:n]
+	}
+	return s
+}
+
+func isAlnum(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		r >= utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func isScheme(s []byte) bool {
+	for i, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && (c >= '0' && c <= '9' || c == '+' || c == '.' || c == '-')) {
+			return false
+		}
+	}
+	return true
+}
+
+func isURLEnd(r rune) bool {
+	return r == lex.EOF || r == '<' || unicode.IsSpace(r)
+}
@@ -0,0 +1,118 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+const (
+	errCSVQuote      = "quoted field not terminated"
+	errCSVAfterQuote = "unexpected character %#U after quoted field"
+	errCSVBareQuote  = "bare \" in non-quoted field"
+)
+
+// CSVField returns a StateFn that lexes a field of a delimited file as
+// specified by RFC 4180, with a configurable delimiter (',' for CSV or '\t'
+// for TSV). The delimiter must not be '"', '\r' or '\n'.
+//
+// Fields are emitted as tokens of type field with the unquoted field content as
+// a string value. In quoted fields, doubled quotes are unescaped and "\r\n" line
+// breaks are converted to "\n". Records end with a "\n" or "\r\n" line break,
+// or at EOF, and a token of type recordEnd is emitted after the last field of
+// each record. An empty line is a record with a single empty field.
+//
+// When entering the StateFn, the first character of the field has already been
+// read. This can be the delimiter or a line break if the field is empty. If the
+// field is followed by a delimiter, the returned StateFn lexes the next field,
+// so that records ending with an empty field are handled properly. A typical
+// initial state function for a delimited file is then:
+//
+//	field := state.CSVField(tokField, tokRecordEnd, ',')
+//	init := func(s *lex.State) lex.StateFn {
+//		if s.Next() == lex.EOF {
+//			s.Emit(s.Pos(), tokEOF, nil)
+//			return nil
+//		}
+//		return field
+//	}
+//
+func CSVField(field, recordEnd lex.Token, delim rune) lex.StateFn {
+	var (
+		s  = make([]byte, 0, 64)
+		fn lex.StateFn
+	)
+	next := func(l *lex.State) lex.StateFn {
+		l.Next()
+		return fn
+	}
+	isEnd := func(l *lex.State, r rune) bool {
+		return r == delim || r == '\n' || r == lex.EOF || r == '\r' && l.Peek() == '\n'
+	}
+	fn = func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		s = s[:0]
+		r := l.Current()
+		if r == '"' {
+			for {
+				if r = l.Next(); r == '"' {
+					if r = l.Next(); r != '"' {
+						break
+					}
+				} else if r == lex.EOF {
+					l.MarkIncomplete()
+					l.Errorf(pos, errCSVQuote)
+					return nil
+				} else if r == '\r' && l.Peek() == '\n' {
+					continue
+				}
+				s = utf8.AppendRune(s, r)
+			}
+			if !isEnd(l, r) {
+				l.Errorf(l.Pos(), errCSVAfterQuote, r)
+				for !isEnd(l, r) {
+					r = l.Next()
+				}
+			}
+		} else {
+			for ; !isEnd(l, r); r = l.Next() {
+				if r == '"' {
+					l.Errorf(l.Pos(), errCSVBareQuote)
+				}
+				s = utf8.AppendRune(s, r)
+			}
+		}
+		// do not include the delimiter or line break in the field token
+		l.Backup()
+		l.EmitString(pos, field, string(s))
+		if r = l.Next(); r == delim {
+			return next
+		}
+		pos = l.Pos()
+		if r == '\r' {
+			l.Next()
+		}
+		l.Emit(pos, recordEnd, nil)
+		return nil
+	}
+	return fn
+}
@@ -0,0 +1,121 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+// Directive returns a StateFn that lexes a C preprocessor directive. It emits
+// the directive name as a token of type name, then the remainder of the line
+// as a token of type body. Both tokens have a string value. Line continuations
+// (a '\' immediately followed by a line break) are spliced: they are removed
+// from the token values but the token positions still refer to the original
+// input. Trailing white space is removed from the body, and the final line
+// break is left in the input.
+//
+// When entering the StateFn, the '#' has already been read. The name token
+// is emitted at the position of the '#' and its value is empty for a null
+// directive. Use Directives to only recognize directives at the start of a
+// line.
+//
+func Directive(name, body lex.Token) lex.StateFn {
+	s := make([]byte, 0, 64)
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		r := nextSpliced(l)
+		for r == ' ' || r == '\t' {
+			r = nextSpliced(l)
+		}
+		s = s[:0]
+		for ; r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_'; r = nextSpliced(l) {
+			s = append(s, byte(r))
+		}
+		l.Backup()
+		l.EmitString(pos, name, string(s))
+		for r = l.Next(); r == ' ' || r == '\t'; r = nextSpliced(l) {
+		}
+		pos = l.Pos()
+		s = s[:0]
+		n := 0 // length of s without trailing white space
+		for ; r != '\n' && r != lex.EOF; r = nextSpliced(l) {
+			s = utf8.AppendRune(s, r)
+			if r != ' ' && r != '\t' {
+				n = len(s)
+			}
+		}
+		l.Backup()
+		l.EmitString(pos, body, string(s[:n]))
+		return nil
+	}
+}
+
+// Directives returns a StateFn that recognizes C preprocessor directives: a
+// '#' that is the first character of a line other than spaces and tabs. Such
+// directives are lexed by a StateFn returned by Directive(name, body). Any
+// other input is lexed by init.
+//
+// The returned StateFn is meant to be used as the initial state function of a
+// lexer. It consumes spaces and tabs at the start of lines before handing over
+// to init.
+//
+func Directives(init lex.StateFn, name, body lex.Token) lex.StateFn {
+	d := Directive(name, body)
+	return func(l *lex.State) lex.StateFn {
+		if l.Current() != '\n' && l.Pos() >= 0 {
+			return init(l)
+		}
+		r := l.Next()
+		for r == ' ' || r == '\t' {
+			r = l.Next()
+		}
+		if r == '#' {
+			return d
+		}
+		l.Backup()
+		return init(l)
+	}
+}
+
+// nextSpliced is like l.Next but skips line continuations.
+//
+func nextSpliced(l *lex.State) rune {
+	for {
+		r := l.Next()
+		if r != '\\' {
+			return r
+		}
+		switch l.Peek() {
+		case '\n':
+			l.Next()
+		case '\r':
+			l.Next()
+			if l.Peek() != '\n' {
+				l.Backup()
+				return r
+			}
+			l.Next()
+		default:
+			return r
+		}
+	}
+}
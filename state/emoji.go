@@ -0,0 +1,173 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+// pictographic approximates the Extended_Pictographic property of Unicode
+// Technical Standard #51, without the regional indicators and emoji modifiers
+// that are handled separately.
+//
+var pictographic = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00a9, Hi: 0x00ae, Stride: 5},
+		{Lo: 0x203c, Hi: 0x203c, Stride: 1},
+		{Lo: 0x2049, Hi: 0x2049, Stride: 1},
+		{Lo: 0x2122, Hi: 0x2122, Stride: 1},
+		{Lo: 0x2139, Hi: 0x2139, Stride: 1},
+		{Lo: 0x2194, Hi: 0x2199, Stride: 1},
+		{Lo: 0x21a9, Hi: 0x21aa, Stride: 1},
+		{Lo: 0x231a, Hi: 0x231b, Stride: 1},
+		{Lo: 0x2328, Hi: 0x2328, Stride: 1},
+		{Lo: 0x23cf, Hi: 0x23cf, Stride: 1},
+		{Lo: 0x23e9, Hi: 0x23f3, Stride: 1},
+		{Lo: 0x23f8, Hi: 0x23fa, Stride: 1},
+		{Lo: 0x24c2, Hi: 0x24c2, Stride: 1},
+		{Lo: 0x25aa, Hi: 0x25ab, Stride: 1},
+		{Lo: 0x25b6, Hi: 0x25c0, Stride: 10},
+		{Lo: 0x25fb, Hi: 0x25fe, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27bf, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2b05, Hi: 0x2b07, Stride: 1},
+		{Lo: 0x2b1b, Hi: 0x2b1c, Stride: 1},
+		{Lo: 0x2b50, Hi: 0x2b55, Stride: 5},
+		{Lo: 0x3030, Hi: 0x3030, Stride: 1},
+		{Lo: 0x303d, Hi: 0x303d, Stride: 1},
+		{Lo: 0x3297, Hi: 0x3299, Stride: 2},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f000, Hi: 0x1f1e5, Stride: 1},
+		{Lo: 0x1f200, Hi: 0x1f3fa, Stride: 1},
+		{Lo: 0x1f400, Hi: 0x1faff, Stride: 1},
+		{Lo: 0x1fc00, Hi: 0x1fffd, Stride: 1},
+	},
+}
+
+const (
+	zwj       = 0x200d
+	keycap    = 0x20e3
+	vs15      = 0xfe0e // text presentation selector
+	vs16      = 0xfe0f // emoji presentation selector
+	cancelTag = 0xe007f
+)
+
+func isRegionalIndicator(r rune) bool { return 0x1f1e6 <= r && r <= 0x1f1ff }
+func isEmojiModifier(r rune) bool     { return 0x1f3fb <= r && r <= 0x1f3ff }
+func isTag(r rune) bool               { return 0xe0020 <= r && r <= 0xe007e }
+
+// IsEmoji reports whether r starts an emoji sequence: r is a pictographic
+// character, a regional indicator or an emoji modifier. Keycap sequences,
+// which start with a digit, '#' or '*', are not included.
+//
+func IsEmoji(r rune) bool {
+	return r >= 0xa9 && (unicode.Is(pictographic, r) || isRegionalIndicator(r) || isEmojiModifier(r))
+}
+
+// Emoji returns a StateFn that lexes an emoji sequence as defined by Unicode
+// Technical Standard #51 and emits it as a single token of type t with a
+// string value. Emoji sequences are:
+//
+//   - flags: a pair of regional indicators, like U+1F1EB U+1F1F7 for 🇫🇷.
+//   - keycaps: a digit, '#' or '*', optionally followed by U+FE0F, followed by
+//     U+20E3 COMBINING ENCLOSING KEYCAP.
+//   - a pictographic character optionally followed by a presentation selector
+//     (U+FE0E or U+FE0F), an emoji modifier (skin tone) and a tag sequence, like
+//     in 👍🏽 or in the flag of Scotland.
+//   - several of the above joined by U+200D ZERO WIDTH JOINER, like 👩 U+200D
+//     💻 for a woman technologist.
+//
+// When entering the StateFn, the first character of the sequence has already
+// been read. IsEmoji can be used to detect it. If it does not start a valid
+// sequence, like a lone regional indicator or a digit that is not part of a
+// keycap, it is emitted alone.
+//
+// Since the Unicode tables of the standard library do not include emoji
+// properties, pictographic characters are approximated with the blocks that
+// contain them.
+//
+func Emoji(t lex.Token) lex.StateFn {
+	s := make([]byte, 0, 32)
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		r := l.Current()
+		s = utf8.AppendRune(s[:0], r)
+		switch {
+		case isRegionalIndicator(r):
+			if isRegionalIndicator(l.Peek()) {
+				s = utf8.AppendRune(s, l.Next())
+			}
+		case r >= '0' && r <= '9' || r == '#' || r == '*':
+			n := 0
+			if l.Peek() == vs16 {
+				l.Next()
+				n++
+			}
+			if l.Peek() == keycap {
+				if n > 0 {
+					s = utf8.AppendRune(s, vs16)
+				}
+				s = utf8.AppendRune(s, l.Next())
+				break
+			}
+			if n > 0 {
+				l.Backup()
+			}
+		default:
+			s = readEmoji(l, s)
+			for l.Peek() == zwj {
+				l.Next()
+				if r := l.Peek(); !unicode.Is(pictographic, r) {
+					l.Backup()
+					break
+				}
+				s = utf8.AppendRune(s, zwj)
+				s = readEmoji(l, utf8.AppendRune(s, l.Next()))
+			}
+		}
+		l.EmitString(pos, t, string(s))
+		return nil
+	}
+}
+
+// readEmoji appends to s the presentation selector, modifier and tags that
+// follow the base character of an emoji.
+//
+func readEmoji(l *lex.State, s []byte) []byte {
+	if r := l.Peek(); r == vs15 || r == vs16 {
+		s = utf8.AppendRune(s, l.Next())
+	}
+	if isEmojiModifier(l.Peek()) {
+		s = utf8.AppendRune(s, l.Next())
+	}
+	if isTag(l.Peek()) {
+		for isTag(l.Peek()) {
+			s = utf8.AppendRune(s, l.Next())
+		}
+		if l.Peek() == cancelTag {
+			s = utf8.AppendRune(s, l.Next())
+		}
+	}
+	return s
+}
@@ -25,16 +25,15 @@ const (
 )
 
 var tokNames = map[lex.Token]string{
-	lex.Error:    "error:   ",
-	goEOF:        "EOF      ",
+	goEOF:        "EOF",
 	goSemiColon:  "semicolon",
-	goInt:        "integer  ",
-	goFloat:      "float    ",
-	goString:     "string   ",
-	goChar:       "char     ",
-	goIdentifier: "ident    ",
-	goDot:        "dot      ",
-	goRawChar:    "raw char ",
+	goInt:        "integer",
+	goFloat:      "float",
+	goString:     "string",
+	goChar:       "char",
+	goIdentifier: "ident",
+	goDot:        "dot",
+	goRawChar:    "raw char",
 }
 
 // tgInit returns the initial state function for our language.
@@ -130,20 +129,21 @@ func Example_go() {
 	// initialize lex.
 	//
 	inputFile := lex.NewFile("example", strings.NewReader(input))
-	l := lex.NewLexer(inputFile, tgInit())
+	l := lex.NewLexer(inputFile, tgInit(), lex.TokenNames(tokNames))
 
 	// loop over each token
 	for tt, _, v := l.Lex(); tt != goEOF; tt, _, v = l.Lex() {
 		// print the token type and value.
+		n := l.TokenName(tt)
 		switch v := v.(type) {
 		case nil:
-			fmt.Println(tokNames[tt])
+			fmt.Println(n)
 		case string:
-			fmt.Println(tokNames[tt], strconv.Quote(v))
+			fmt.Printf("%-9s %s\n", n, strconv.Quote(v))
 		case rune:
-			fmt.Println(tokNames[tt], strconv.QuoteRune(v))
+			fmt.Printf("%-9s %s\n", n, strconv.QuoteRune(v))
 		default:
-			fmt.Println(tokNames[tt], v)
+			fmt.Printf("%-9s %v\n", n, v)
 		}
 	}
 
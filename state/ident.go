@@ -0,0 +1,55 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+// Identifier returns a StateFn that lexes identifiers as defined by Unicode
+// Standard Annex #31: a rune for which lex.IsIdentifierStart returns true,
+// followed by any number of runes for which lex.IsIdentifierContinue returns
+// true. The identifier is emitted as a token of type t with a string value.
+//
+// When entering the StateFn, the first rune of the identifier has already been
+// read. The caller decides which runes can start an identifier, so that
+// languages can also allow '_' or '$' for example:
+//
+//	if r := l.Next(); r == '_' || lex.IsIdentifierStart(r) {
+//		return ident
+//	}
+//
+// UAX #31 recommends comparing identifiers in Normalization Form C or KC. See
+// the lex.Normalize option.
+//
+func Identifier(t lex.Token) lex.StateFn {
+	s := make([]byte, 0, 64)
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		s = utf8.AppendRune(s[:0], l.Current())
+		for lex.IsIdentifierContinue(l.Peek()) {
+			s = utf8.AppendRune(s, l.Next())
+		}
+		l.EmitString(pos, t, string(s))
+		return nil
+	}
+}
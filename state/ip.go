@@ -0,0 +1,109 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/db47h/lex"
+)
+
+const (
+	errIPAddr   = "invalid IP address %q"
+	errIPPrefix = "invalid IP prefix %q"
+)
+
+// IPAddr returns a StateFn that lexes an IPv4 or IPv6 address, with an
+// optional zone for IPv6 addresses (like fe80::1%eth0), and an optional CIDR
+// prefix length (like 10.0.0.0/8). Addresses are emitted as a token of type
+// addr with a netip.Addr value, and prefixes as a token of type prefix with a
+// netip.Prefix value. Invalid addresses are reported as errors.
+//
+// When entering the StateFn, the first character of the address, a hex digit
+// or ':', has already been read. A trailing '.' or ':' that is not followed by
+// a part of the address is not consumed, so that addresses followed by
+// punctuation are lexed properly. The address of a prefix is not masked.
+//
+func IPAddr(addr, prefix lex.Token) lex.StateFn {
+	s := make([]byte, 0, 64)
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		r := l.Current()
+		s = append(s[:0], byte(r))
+		for {
+			r = l.Peek()
+			if isHex(r) {
+				s = append(s, byte(l.Next()))
+				continue
+			}
+			if r != '.' && r != ':' {
+				break
+			}
+			l.Next()
+			if n := l.Peek(); isHex(n) || r == ':' && (n == ':' || s[len(s)-1] == ':') {
+				s = append(s, byte(r))
+				continue
+			}
+			l.Backup()
+			break
+		}
+		if r == '%' && strings.IndexByte(string(s), ':') >= 0 {
+			l.Next()
+			s = append(s, '%')
+			for r = l.Peek(); isZone(r); r = l.Peek() {
+				s = append(s, byte(l.Next()))
+			}
+		}
+		if r == '/' {
+			l.Next()
+			if !isDigit(l.Peek()) {
+				l.Backup()
+			} else {
+				s = append(s, '/')
+				for isDigit(l.Peek()) {
+					s = append(s, byte(l.Next()))
+				}
+				p, err := netip.ParsePrefix(string(s))
+				if err != nil {
+					l.Errorf(pos, errIPPrefix, s)
+					return nil
+				}
+				l.Emit(pos, prefix, p)
+				return nil
+			}
+		}
+		a, err := netip.ParseAddr(string(s))
+		if err != nil {
+			l.Errorf(pos, errIPAddr, s)
+			return nil
+		}
+		l.Emit(pos, addr, a)
+		return nil
+	}
+}
+
+func isHex(r rune) bool {
+	return r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F'
+}
+
+func isZone(r rune) bool {
+	return r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || r == '-' || r == '.'
+}
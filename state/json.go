@@ -0,0 +1,239 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+const (
+	errJSONControl   = "invalid control character %#U in string literal"
+	errJSONSurrogate = "invalid surrogate pair in escape sequence"
+	errJSONZero      = "invalid leading zero in number literal"
+	errJSONMinus     = "missing digits after '-' in number literal"
+)
+
+// JSONString returns a StateFn that lexes a JSON string literal as specified
+// by RFC 8259. Only the escape sequences \", \\, \/, \b, \f, \n, \r, \t and
+// \uXXXX are supported, and escaped UTF-16 surrogate pairs are decoded as a
+// single character. Unescaped control characters are reported as errors.
+//
+// When entering the StateFn, the opening '"' has already been read.
+// Unterminated literals are handled like with QuotedString and the
+// EmitPartial option is supported.
+//
+func JSONString(t lex.Token, opts ...Option) lex.StateFn {
+	o := newOptions(opts)
+	s := make([]byte, 0, 64)
+	var rb [utf8.UTFMax]byte
+	return func(l *lex.State) lex.StateFn {
+		s = s[:0]
+		pos := l.Pos()
+		for {
+			r := l.Next()
+			switch {
+			case r == '"':
+				l.EmitString(pos, t, string(s))
+				return nil
+			case r == '\n' || r == lex.EOF:
+				unterminated(l, pos, "string")
+				if o.partial {
+					l.EmitString(pos, t, string(s))
+				}
+				return nil
+			case r < 0x20:
+				l.Errorf(l.Pos(), errJSONControl, r)
+				return terminateString('"', pos, "string")
+			case r == '\\':
+				var err int
+				if r, err = readJSONEscape(l); err != errNone {
+					if err == errEOL {
+						unterminated(l, pos, "string")
+						return nil
+					}
+					if err == errInvalidHex {
+						l.Errorf(l.Pos(), msg[err], l.Current())
+					} else if err == errInvalidRune {
+						l.Errorf(l.Pos(), errJSONSurrogate)
+					} else {
+						l.Errorf(l.Pos(), msg[err])
+					}
+					if l.Current() == '"' {
+						return nil
+					}
+					return terminateString('"', pos, "string")
+				}
+			}
+			if r < utf8.RuneSelf {
+				s = append(s, byte(r))
+			} else {
+				s = append(s, rb[:utf8.EncodeRune(rb[:], r)]...)
+			}
+		}
+	}
+}
+
+// readJSONEscape reads a JSON escape sequence after its '\'.
+//
+func readJSONEscape(l *lex.State) (rune, int) {
+	switch r := l.Next(); r {
+	case '"', '\\', '/':
+		return r, errNone
+	case 'b':
+		return '\b', errNone
+	case 'f':
+		return '\f', errNone
+	case 'n':
+		return '\n', errNone
+	case 'r':
+		return '\r', errNone
+	case 't':
+		return '\t', errNone
+	case 'u':
+		r, err := readDigits(l, 4, 16)
+		if err != errNone {
+			return r, err
+		}
+		switch {
+		case r >= 0xdc00 && r < 0xe000:
+			return utf8.RuneError, errInvalidRune
+		case r >= 0xd800 && r < 0xdc00:
+			// high surrogate, must be followed by an escaped low surrogate
+			if r := l.Next(); r != '\\' {
+				if r == '\n' || r == lex.EOF {
+					return r, errEOL
+				}
+				return utf8.RuneError, errInvalidRune
+			}
+			if r := l.Next(); r != 'u' {
+				if r == '\n' || r == lex.EOF {
+					return r, errEOL
+				}
+				return utf8.RuneError, errInvalidRune
+			}
+			lo, err := readDigits(l, 4, 16)
+			if err != errNone {
+				return lo, err
+			}
+			if lo < 0xdc00 || lo >= 0xe000 {
+				return utf8.RuneError, errInvalidRune
+			}
+			return 0x10000 + (r-0xd800)<<10 + (lo - 0xdc00), errNone
+		}
+		return r, errNone
+	case '\n', lex.EOF:
+		return r, errEOL
+	default:
+		return r, errInvalidEscape
+	}
+}
+
+// JSONNumber returns a StateFn that lexes a JSON number literal as specified
+// by RFC 8259: an optional minus sign, an integer part without leading zeros,
+// an optional fractional part with at least one digit and an optional
+// exponent. The token value is the literal as a json.Number.
+//
+// When entering the StateFn, the first character of the literal, '-' or a
+// digit, has already been read. Other characters are handled like with Number,
+// including the Strict option. The MaxDigits option limits the number of
+// digits of the integer and fractional parts.
+//
+func JSONNumber(t lex.Token, opts ...Option) lex.StateFn {
+	o := newOptions(opts)
+	l := &numberLexer{strict: o.strict}
+	buf := make([]byte, 0, 32)
+	return func(s *lex.State) lex.StateFn {
+		pos := s.Pos()
+		buf = buf[:0]
+		digits := 0
+		digit := func(r rune) {
+			if digits++; o.maxDigits <= 0 || digits <= o.maxDigits {
+				buf = append(buf, byte(r))
+			}
+		}
+		r := s.Current()
+		if r == '-' {
+			buf = append(buf, '-')
+			r = s.Next()
+		}
+		switch {
+		case r == '0':
+			digit(r)
+			if r = s.Next(); isDigit(r) {
+				s.Errorf(pos, errJSONZero)
+				for isDigit(r) {
+					r = s.Next()
+				}
+				s.Backup()
+				return nil
+			}
+		case isDigit(r):
+			for ; isDigit(r); r = s.Next() {
+				digit(r)
+			}
+		case len(buf) > 0:
+			s.Errorf(s.Pos(), errJSONMinus)
+			s.Backup()
+			return nil
+		default:
+			return l.stateNumber(s)
+		}
+		if r == '.' {
+			buf = append(buf, '.')
+			if r = s.Next(); !isDigit(r) {
+				s.Errorf(s.Pos(), errMalformedFloat)
+				s.Backup()
+				return nil
+			}
+			for ; isDigit(r); r = s.Next() {
+				digit(r)
+			}
+		}
+		if r == 'e' || r == 'E' {
+			buf = append(buf, byte(r))
+			if r = s.Next(); r == '+' || r == '-' {
+				buf = append(buf, byte(r))
+				r = s.Next()
+			}
+			if !isDigit(r) {
+				s.Errorf(s.Pos(), errMalformedExponent)
+				s.Backup()
+				return nil
+			}
+			for ; isDigit(r); r = s.Next() {
+				buf = append(buf, byte(r))
+			}
+		}
+		s.Backup()
+		if o.maxDigits > 0 && digits > o.maxDigits {
+			s.Errorf(pos, errTooManyDigits, o.maxDigits)
+			return nil
+		}
+		s.Emit(pos, t, json.Number(buf))
+		return nil
+	}
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
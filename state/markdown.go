@@ -0,0 +1,181 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+const (
+	errFence     = "invalid code fence"
+	errFenceInfo = "invalid character %#U in info string"
+)
+
+// CodeSpan returns a StateFn that lexes a Markdown inline code span as
+// specified by CommonMark: a string of n backticks, followed by the code,
+// followed by a string of exactly n backticks. Line breaks in the code are
+// converted to spaces, and if the code both begins and ends with a space but
+// is not only made of spaces, one space is removed from each side. The code is
+// emitted as a string value.
+//
+// When entering the StateFn, the first backtick has already been read. Code
+// spans without a closing backtick string are reported as unterminated at the
+// end of the paragraph (an empty line) or at EOF. The EmitPartial option is
+// supported.
+//
+func CodeSpan(t lex.Token, opts ...Option) lex.StateFn {
+	o := newOptions(opts)
+	s := make([]byte, 0, 64)
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		s = s[:0]
+		n := 1
+		for l.Peek() == '`' {
+			l.Next()
+			n++
+		}
+		for {
+			r := l.Next()
+			switch {
+			case r == '`':
+				k := 1
+				for l.Peek() == '`' {
+					l.Next()
+					k++
+				}
+				if k == n {
+					if len(s) > 1 && s[0] == ' ' && s[len(s)-1] == ' ' && strings.Trim(string(s), " ") != "" {
+						s = s[1 : len(s)-1]
+					}
+					l.EmitString(pos, t, string(s))
+					return nil
+				}
+				for ; k > 0; k-- {
+					s = append(s, '`')
+				}
+				continue
+			case r == '\n' && l.Peek() == '\n' || r == lex.EOF:
+				unterminated(l, pos, "code span")
+				if o.partial {
+					l.EmitString(pos, t, string(s))
+				}
+				return nil
+			case r == '\n':
+				r = ' '
+			}
+			s = utf8.AppendRune(s, r)
+		}
+	}
+}
+
+// CodeBlock is the value of tokens emitted by FencedCode.
+//
+type CodeBlock struct {
+	Info string // info string, like the language name
+	Code string // content of the block
+}
+
+// FencedCode returns a StateFn that lexes a Markdown fenced code block as
+// specified by CommonMark: a fence of at least three backticks or tildes,
+// followed by an optional info string, the lines of the block, and a closing
+// fence of the same character that is at least as long as the opening fence.
+// The block is emitted as a single token of type block with a CodeBlock value.
+// The info string is trimmed, and the content has one line break per line.
+//
+// When entering the StateFn, the first fence character at the start of a line
+// has already been read. If the fence is shorter than three characters, a
+// backtick fence is lexed as a code span of type span (see CodeSpan), with the
+// given options, and a tilde fence is reported as an error. The closing fence
+// can be indented by up to three spaces; the indentation of the opening fence
+// is not removed from the content. A block without a closing fence ends at
+// EOF. The line break after the closing fence is left in the input.
+//
+func FencedCode(block, span lex.Token, opts ...Option) lex.StateFn {
+	code := CodeSpan(span, opts...)
+	s := make([]byte, 0, 256)
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		c := l.Current()
+		n := 1
+		for l.Peek() == c {
+			l.Next()
+			n++
+		}
+		if n < 3 {
+			if c == '`' {
+				for ; n > 1; n-- {
+					l.Backup()
+				}
+				return code
+			}
+			l.Errorf(pos, errFence)
+			return nil
+		}
+
+		// info string
+		s = s[:0]
+		r := l.Next()
+		for ; r != '\n' && r != lex.EOF; r = l.Next() {
+			if r == '`' && c == '`' {
+				l.Errorf(l.Pos(), errFenceInfo, r)
+			}
+			s = utf8.AppendRune(s, r)
+		}
+		info := strings.TrimSpace(string(s))
+
+		// content
+		s = s[:0]
+		for r != lex.EOF {
+			start := len(s)
+			sp := 0
+			for r = l.Next(); r == ' ' && sp < 3; r = l.Next() {
+				s = append(s, ' ')
+				sp++
+			}
+			k := 0
+			for ; r == c; r = l.Next() {
+				s = append(s, byte(c))
+				k++
+			}
+			if k >= n {
+				for r == ' ' || r == '\t' {
+					s = append(s, byte(r))
+					r = l.Next()
+				}
+				if r == '\n' || r == lex.EOF {
+					s = s[:start]
+					l.Backup()
+					break
+				}
+			}
+			for ; r != '\n' && r != lex.EOF; r = l.Next() {
+				s = utf8.AppendRune(s, r)
+			}
+			if r == '\n' || len(s) > start {
+				s = append(s, '\n')
+			}
+		}
+		l.Emit(pos, block, CodeBlock{Info: info, Code: string(s)})
+		return nil
+	}
+}
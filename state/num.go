@@ -20,7 +20,9 @@
 package state
 
 import (
+	"fmt"
 	"math/big"
+	"strconv"
 
 	"github.com/db47h/lex"
 )
@@ -30,8 +32,19 @@ const (
 	errInvalidNumChar    = "invalid character %#U in base %d literal"
 	errMalformedFloat    = "malformed floating-point literal"
 	errMalformedExponent = "malformed floating-point literal exponent"
+	errNotNumber         = "invalid character %#U at start of number"
+	errNotNumberEOF      = "unexpected end of input at start of number"
+	errFloat             = "invalid floating-point literal: %v"
+	errTooManyDigits     = "number literal too long: more than %d digits"
+	errExponentRange     = "floating-point literal exponent out of range: more than %d"
 )
 
+// maxExponent is the exponent limit used if none is set with MaxExponent. It
+// only bounds the number of exponent digits kept in memory: big.Float reports
+// exponent overflow for much smaller values.
+//
+const maxExponent = 1<<31 - 1
+
 // A numberLexer lexes numbers.
 //
 type numberLexer struct {
@@ -40,7 +53,11 @@ type numberLexer struct {
 	buf        []byte
 	base       int
 	decimalSep rune // decimal separator
-
+	strict     bool
+	maxDigits  int  // max number of digits, 0 for no limit
+	maxExp     int  // max absolute value of exponents, 0 for no limit
+	prec       uint // precision of floats
+	digits     int  // number of digits read
 }
 
 // Number returns a lex.StateFn that lexes numbers.
@@ -58,9 +75,9 @@ type numberLexer struct {
 //
 // The return value from Number is not safe to use concurrently.
 //
-// The StateFn will panic on invalid input. i.e. callers must make sure that
-// the input starts with either a digit or a decimal separator followed by a
-// digit:
+// Malformed literals are reported as lex.Error tokens. Callers must make sure
+// that the input starts with either a digit or a decimal separator followed by
+// a digit, otherwise an error is emitted for the current character:
 //
 //	switch s.Next() {
 //	case EOF:
@@ -77,11 +94,21 @@ type numberLexer struct {
 //		// ...
 //	}
 //
+// The MaxDigits and MaxExponent options limit the size of the literals that
+// are converted, and FloatPrec sets the precision of floats, 64 bits by
+// default. Literals that exceed the limits are reported as errors and skipped
+// entirely. The number of digits is not limited by default: set MaxDigits when
+// lexing untrusted input, since converting very long literals is costly.
+//
+// With the Strict option, the StateFn panics instead of emitting an error
+// when called on input that does not start a number or if the conversion of a
+// well-formed literal fails. This is meant to catch bugs during development.
+//
 // The implementation of this lexer makes heavy use of the state-as-function
 // paradigm. As a result it is not the fastest by a long stretch. On the other
 // hand it is a good example for the lexer package.
 //
-func Number(tokInt, tokFloat lex.Token, decimalSep rune) lex.StateFn {
+func Number(tokInt, tokFloat lex.Token, decimalSep rune, opts ...Option) lex.StateFn {
 	l := &numberLexer{
 		tokInt:     tokInt,
 		tokFloat:   tokFloat,
@@ -89,12 +116,24 @@ func Number(tokInt, tokFloat lex.Token, decimalSep rune) lex.StateFn {
 		buf:        make([]byte, 0, 64),
 		base:       10,
 	}
+	o := newOptions(opts)
+	l.strict, l.maxDigits, l.maxExp, l.prec = o.strict, o.maxDigits, o.maxExp, o.prec
 	return l.stateNumber
 }
 
+// errorf emits an error, or panics in strict mode.
+//
+func (l *numberLexer) errorf(s *lex.State, offset int, format string, args ...interface{}) {
+	if l.strict {
+		panic(fmt.Sprintf(format, args...))
+	}
+	s.Errorf(offset, format, args...)
+}
+
 // stateNumber is the main entry point for numbers.
 //
 func (l *numberLexer) stateNumber(s *lex.State) lex.StateFn {
+	l.base, l.digits = 10, 0
 	r := s.Current()
 	switch r {
 	case '0':
@@ -113,7 +152,12 @@ func (l *numberLexer) stateNumber(s *lex.State) lex.StateFn {
 	case l.decimalSep, '1', '2', '3', '4', '5', '6', '7', '8', '9':
 		return l.stateIntegerOrFloat
 	}
-	panic("not a number")
+	if r == lex.EOF {
+		l.errorf(s, s.Pos(), errNotNumberEOF)
+	} else {
+		l.errorf(s, s.Pos(), errNotNumber, r)
+	}
+	return nil
 }
 
 // integer returns a StateFn that lexes integers in the given base.
@@ -172,17 +216,21 @@ func (l *numberLexer) stateIntegerOrFloat(s *lex.State) lex.StateFn {
 }
 
 func (l *numberLexer) stateEmitInt(s *lex.State) lex.StateFn {
-	switch {
-	case len(l.buf) == 0:
+	if len(l.buf) == 0 {
 		s.Errorf(s.Pos(), errMalformedInt, l.base)
-	default:
-		i, ok := new(big.Int).SetString(string(l.buf), l.base)
-		if !ok {
-			panic("Int.SetString failed")
-		}
-		s.Emit(s.TokenPos(), l.tokInt, i)
+		s.Backup()
+		return nil
+	}
+	if l.tooLong(s) {
+		return nil
 	}
+	i, ok := new(big.Int).SetString(string(l.buf), l.base)
 	s.Backup()
+	if !ok {
+		l.errorf(s, s.TokenPos(), errMalformedInt, l.base)
+		return nil
+	}
+	s.Emit(s.TokenPos(), l.tokInt, i)
 	return nil
 }
 
@@ -202,11 +250,18 @@ func (l *numberLexer) stateFractional(s *lex.State) lex.StateFn {
 }
 
 func (l *numberLexer) stateEmitFloat(s *lex.State) lex.StateFn {
-	z, ok := new(big.Float).SetString(string(l.buf))
-	if !ok {
-		panic("Float.SetString failed")
+	if l.tooLong(s) {
+		return nil
 	}
+	z, _, err := new(big.Float).SetPrec(l.prec).Parse(string(l.buf), 10)
 	s.Backup()
+	if err != nil {
+		if e, ok := err.(*strconv.NumError); ok {
+			err = e.Err
+		}
+		l.errorf(s, s.TokenPos(), errFloat, err)
+		return nil
+	}
 	s.Emit(s.TokenPos(), l.tokFloat, z)
 	return nil
 }
@@ -217,15 +272,61 @@ func (l *numberLexer) stateExponent(s *lex.State) lex.StateFn {
 		l.buf = append(l.buf, byte(r))
 		s.Next()
 	}
-	bl := len(l.buf)
-	l.scanDigits(s, 10)
-	if len(l.buf) > bl {
-		return l.stateEmitFloat
+	// leading zeros are dropped and digits past the limit are not kept, so
+	// that the buffer does not grow with the exponent.
+	var (
+		exp  = 0
+		n    = 0
+		max  = l.maxExp
+		over = false // exp > max
+	)
+	if max <= 0 {
+		max = maxExponent
+	}
+	for r := s.Current(); r >= '0' && r <= '9'; r = s.Next() {
+		n++
+		if over || exp == 0 && r == '0' {
+			continue
+		}
+		// check before multiplying: exp*10 overflows on 32 bits platforms.
+		d := int(r - '0')
+		if d > max || exp > (max-d)/10 {
+			over = true
+			continue
+		}
+		exp = exp*10 + d
+		l.buf = append(l.buf, byte(r))
+	}
+	if n == 0 {
+		// no digits following 'e'
+		s.Errorf(s.Pos(), errMalformedExponent)
+		s.Backup()
+		return nil
+	}
+	if over {
+		s.Backup()
+		if l.maxExp > 0 {
+			s.Errorf(s.TokenPos(), errExponentRange, l.maxExp)
+		} else {
+			s.Errorf(s.TokenPos(), errFloat, "exponent overflow")
+		}
+		return nil
+	}
+	if exp == 0 {
+		l.buf = append(l.buf, '0')
+	}
+	return l.stateEmitFloat
+}
+
+// tooLong reports an error if the literal has more digits than allowed.
+//
+func (l *numberLexer) tooLong(s *lex.State) bool {
+	if l.maxDigits <= 0 || l.digits <= l.maxDigits {
+		return false
 	}
-	// no digits following 'e'
-	s.Errorf(s.Pos(), errMalformedExponent)
 	s.Backup()
-	return nil
+	s.Errorf(s.TokenPos(), errTooManyDigits, l.maxDigits)
+	return true
 }
 
 func (l *numberLexer) scanDigits(s *lex.State, base int) {
@@ -243,7 +344,10 @@ func (l *numberLexer) scanDigits(s *lex.State, base int) {
 		if rl < 0 || int(rl) >= base {
 			return
 		}
-		l.buf = append(l.buf, byte(r))
+		// past the limit, digits are counted but not kept
+		if l.digits++; l.maxDigits <= 0 || l.digits <= l.maxDigits {
+			l.buf = append(l.buf, byte(r))
+		}
 		r = s.Next()
 	}
 }
@@ -0,0 +1,179 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/db47h/lex"
+)
+
+const (
+	errVersionNum  = "invalid version: missing number"
+	errVersionZero = "invalid leading zero in version number"
+	errVersionDot  = "invalid version: missing '.'"
+	errVersionID   = "invalid version: empty identifier"
+	errVersionLong = "version number out of range"
+)
+
+// Version is the value of tokens emitted by SemVer.
+//
+type Version struct {
+	Major, Minor, Patch uint64
+	Pre                 []string // pre-release identifiers
+	Build               []string // build metadata identifiers
+}
+
+// String returns the version in semver format, without a leading 'v'.
+//
+func (v *Version) String() string {
+	var b strings.Builder
+	b.WriteString(strconv.FormatUint(v.Major, 10))
+	b.WriteByte('.')
+	b.WriteString(strconv.FormatUint(v.Minor, 10))
+	b.WriteByte('.')
+	b.WriteString(strconv.FormatUint(v.Patch, 10))
+	if len(v.Pre) > 0 {
+		b.WriteByte('-')
+		b.WriteString(strings.Join(v.Pre, "."))
+	}
+	if len(v.Build) > 0 {
+		b.WriteByte('+')
+		b.WriteString(strings.Join(v.Build, "."))
+	}
+	return b.String()
+}
+
+// SemVer returns a StateFn that lexes a semantic version as specified by
+// Semantic Versioning 2.0.0, like 1.2.3-alpha.1+build.5, with an optional
+// leading 'v'. The version is emitted as a *Version value.
+//
+// When entering the StateFn, the first character of the version, 'v' or a
+// digit, has already been read. Numeric identifiers with leading zeros are
+// reported as errors. A '.' that is not followed by an identifier after the
+// patch number, pre-release or build identifiers is not part of the version,
+// so that a version at the end of a sentence is lexed properly. After an
+// error, the remainder of the version is skipped.
+//
+func SemVer(t lex.Token) lex.StateFn {
+	buf := make([]byte, 0, 32)
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		r := l.Current()
+		if r == 'v' {
+			r = l.Next()
+		}
+		var (
+			v   = new(Version)
+			ok  bool
+			num = func(r rune, n *uint64) bool {
+				p := l.Pos()
+				if !isDigit(r) {
+					l.Backup()
+					l.Errorf(p, errVersionNum)
+					return false
+				}
+				buf = buf[:0]
+				for buf = append(buf, byte(r)); isDigit(l.Peek()); {
+					buf = append(buf, byte(l.Next()))
+				}
+				if len(buf) > 1 && buf[0] == '0' {
+					l.Errorf(p, errVersionZero)
+					return false
+				}
+				var err error
+				if *n, err = strconv.ParseUint(string(buf), 10, 64); err != nil {
+					l.Errorf(p, errVersionLong)
+					return false
+				}
+				return true
+			}
+			dot = func(n *uint64) bool {
+				if l.Peek() != '.' {
+					l.Errorf(l.Pos()+1, errVersionDot)
+					return false
+				}
+				l.Next()
+				return num(l.Next(), n)
+			}
+		)
+		if !num(r, &v.Major) || !dot(&v.Minor) || !dot(&v.Patch) {
+			return skipVersion(l)
+		}
+		if l.Peek() == '-' {
+			l.Next()
+			if v.Pre, ok = readVersionIDs(l, buf, true); !ok {
+				return skipVersion(l)
+			}
+		}
+		if l.Peek() == '+' {
+			l.Next()
+			if v.Build, ok = readVersionIDs(l, buf, false); !ok {
+				return skipVersion(l)
+			}
+		}
+		l.Emit(pos, t, v)
+		return nil
+	}
+}
+
+// readVersionIDs reads dot separated pre-release or build identifiers.
+//
+func readVersionIDs(l *lex.State, buf []byte, pre bool) ([]string, bool) {
+	var ids []string
+	for {
+		p := l.Pos() + 1
+		buf = buf[:0]
+		for isVersionID(l.Peek()) {
+			buf = append(buf, byte(l.Next()))
+		}
+		if len(buf) == 0 {
+			l.Errorf(p, errVersionID)
+			return nil, false
+		}
+		if pre && len(buf) > 1 && buf[0] == '0' && strings.Trim(string(buf), "0123456789") == "" {
+			l.Errorf(p, errVersionZero)
+			return nil, false
+		}
+		ids = append(ids, string(buf))
+		if l.Peek() != '.' {
+			return ids, true
+		}
+		l.Next()
+		if !isVersionID(l.Peek()) {
+			l.Backup()
+			return ids, true
+		}
+	}
+}
+
+// skipVersion skips the remainder of an invalid version.
+//
+func skipVersion(l *lex.State) lex.StateFn {
+	for r := l.Peek(); isVersionID(r) || r == '.' || r == '+'; r = l.Peek() {
+		l.Next()
+	}
+	return nil
+}
+
+func isVersionID(r rune) bool {
+	return r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-'
+}
@@ -0,0 +1,139 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+const (
+	errSQLEmptyIdent = "zero-length quoted identifier"
+	errDollarTag     = "invalid character %#U in dollar quote tag"
+)
+
+// SQLString returns a StateFn that lexes a single-quoted SQL string literal.
+// Quotes are escaped by doubling them and backslashes have no special meaning.
+// Literals can span several lines, so only EOF is reported as an unterminated
+// literal.
+//
+// When entering the StateFn, the starting delimiter has already been read and
+// will be reused as end-delimiter. The EmitPartial option is supported.
+//
+func SQLString(t lex.Token, opts ...Option) lex.StateFn {
+	return sqlQuoted(t, "string", newOptions(opts))
+}
+
+// SQLIdentifier returns a StateFn that lexes an SQL quoted identifier like
+// "a ""quoted"" name". It works like SQLString, except that empty identifiers
+// are reported as errors.
+//
+func SQLIdentifier(t lex.Token, opts ...Option) lex.StateFn {
+	return sqlQuoted(t, "identifier", newOptions(opts))
+}
+
+func sqlQuoted(t lex.Token, what string, o options) lex.StateFn {
+	s := make([]byte, 0, 64)
+	return func(l *lex.State) lex.StateFn {
+		s = s[:0]
+		quote := l.Current()
+		pos := l.Pos()
+		for {
+			r := l.Next()
+			switch {
+			case r == lex.EOF:
+				unterminated(l, pos, what)
+				if o.partial {
+					l.EmitString(pos, t, string(s))
+				}
+				return nil
+			case r == quote && l.Peek() != quote:
+				if len(s) == 0 && what == "identifier" {
+					l.Errorf(pos, errSQLEmptyIdent)
+					return nil
+				}
+				l.EmitString(pos, t, string(s))
+				return nil
+			case r == quote:
+				l.Next()
+			}
+			s = utf8.AppendRune(s, r)
+		}
+	}
+}
+
+// DollarQuoted returns a StateFn that lexes a PostgreSQL dollar-quoted string
+// like $$it's$$ or $tag$a $$ b$tag$. The tag is an optional identifier made
+// of letters, digits and underscores that does not start with a digit. The
+// string content is taken verbatim and ends at the first occurrence of the
+// closing tag.
+//
+// When entering the StateFn, the first '$' has already been read. Since
+// positional parameters like $1 are not dollar quotes, the caller should check
+// that the next character is not a digit before switching to this StateFn.
+// Unterminated literals are handled like with SQLString, including the
+// EmitPartial option.
+//
+func DollarQuoted(t lex.Token, opts ...Option) lex.StateFn {
+	o := newOptions(opts)
+	s := make([]byte, 0, 64)
+	tag := make([]byte, 0, 16)
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		tag, s = tag[:0], s[:0]
+		for {
+			r := l.Next()
+			if r == '$' {
+				break
+			}
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || r >= utf8.RuneSelf ||
+				r >= '0' && r <= '9' && len(tag) > 0) {
+				if r == lex.EOF {
+					unterminated(l, pos, "string")
+					return nil
+				}
+				l.Errorf(l.Pos(), errDollarTag, r)
+				l.Backup()
+				return nil
+			}
+			tag = utf8.AppendRune(tag, r)
+		}
+		for {
+			r := l.Next()
+			if r == lex.EOF {
+				unterminated(l, pos, "string")
+				if o.partial {
+					l.EmitString(pos, t, string(s))
+				}
+				return nil
+			}
+			s = utf8.AppendRune(s, r)
+			if r != '$' || len(s) < len(tag)+2 {
+				continue
+			}
+			// check for the closing tag at the end of s
+			if e := len(s) - len(tag) - 1; s[e-1] == '$' && string(s[e:len(s)-1]) == string(tag) {
+				l.EmitString(pos, t, string(s[:e-1]))
+				return nil
+			}
+		}
+	}
+}
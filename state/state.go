@@ -18,7 +18,12 @@
 // CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 
 // Package state provides state functions for lexing numbers, quoted strings and
-// quoted characters.
+// quoted characters, as well as building blocks for lexers of common data and
+// markup formats: JSON strings and numbers, YAML scalars, TOML keys, table
+// headers and literal strings, SQL quoted strings and identifiers, delimited
+// file fields, Markdown code spans and fenced code blocks, C preprocessor
+// directives, semantic versions, IP addresses, Unicode identifiers, emoji
+// sequences, and URLs and email addresses in text.
 //
 // State functions in this package expect that the first character that is
 // part of the lexed entity has already been read by State.Next. For example:
@@ -38,6 +43,7 @@
 package state
 
 import (
+	"math/big"
 	"unicode/utf8"
 
 	"github.com/db47h/lex"
@@ -67,6 +73,98 @@ var msg = [...]string{
 	errEmpty:         "empty character literal or unescaped %c in character literal",
 }
 
+// An Option configures the state functions returned by the constructors of
+// this package. Not all options apply to all state functions, and options
+// that do not apply are ignored:
+//
+//	EmitPartial     QuotedString, QuotedChar, JSONString, SQLString,
+//	                SQLIdentifier, DollarQuoted, TOMLLiteral, YAMLQuoted,
+//	                CodeSpan and FencedCode
+//	Strict          Number and JSONNumber
+//	MaxDigits       Number and JSONNumber
+//	MaxExponent     Number
+//	FloatPrec       Number
+//
+type Option func(*options)
+
+type options struct {
+	partial   bool
+	strict    bool
+	maxDigits int
+	maxExp    int
+	prec      uint
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// EmitPartial configures the state functions for quoted strings and
+// characters to emit a partial token for literals that are not terminated
+// before the end of line or end of input. The partial token is emitted right
+// after the "literal not terminated" error, with the same offset. For strings,
+// its value is the (possibly empty) string read so far. For characters, a
+// partial token is emitted only if a character has been read.
+//
+// No partial token is emitted for literals that contain other errors, like
+// invalid escape sequences. See Option for the state functions that support
+// EmitPartial.
+//
+func EmitPartial() Option {
+	return func(o *options) {
+		o.partial = true
+	}
+}
+
+// Strict configures Number and JSONNumber to panic instead of emitting an error when called
+// on input that does not start a number, or when the conversion of a literal
+// fails. It is meant to be used during development to catch misuse of the
+// state function early.
+//
+func Strict() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// MaxDigits limits the number of digits of the literals lexed by Number and
+// JSONNumber, excluding the exponent of floats. Longer literals are reported as errors.
+// This bounds the cost of converting untrusted input to big.Int or big.Float.
+// The default (or n <= 0) is no limit.
+//
+func MaxDigits(n int) Option {
+	return func(o *options) {
+		o.maxDigits = n
+	}
+}
+
+// MaxExponent limits the absolute value of the exponent of floating-point
+// literals lexed by Number. Literals with a larger exponent are reported as
+// errors. Independently of this limit, exponents too large to be represented
+// by a big.Float are reported as errors.
+//
+func MaxExponent(n int) Option {
+	return func(o *options) {
+		o.maxExp = n
+	}
+}
+
+// FloatPrec sets the precision in bits of the big.Float values produced by
+// Number. The default (or prec 0) is 64. Values above big.MaxPrec are capped.
+//
+func FloatPrec(prec uint) Option {
+	if prec > big.MaxPrec {
+		prec = big.MaxPrec
+	}
+	return func(o *options) {
+		o.prec = prec
+	}
+}
+
 // QuotedString returns a StateFn that lexes a Go string literal. It supports
 // the same escape sequences as double-quoted Go string literals. Go raw string
 // literals are not supported.
@@ -74,7 +172,13 @@ var msg = [...]string{
 // When entering the StateFn, the starting delimiter has already been read and
 // will be reused as end-delimiter.
 //
-func QuotedString(t lex.Token) lex.StateFn {
+// Literals that are not terminated before the end of line or end of input are
+// reported as errors at the offset of the opening delimiter, even if they also
+// contain other errors. The end of line or EOF is not consumed. The
+// EmitPartial option is supported.
+//
+func QuotedString(t lex.Token, opts ...Option) lex.StateFn {
+	o := newOptions(opts)
 	s := make([]byte, 0, 64)
 	var rb [utf8.UTFMax]byte
 	return func(l *lex.State) lex.StateFn {
@@ -93,18 +197,20 @@ func QuotedString(t lex.Token) lex.StateFn {
 			case errRawByte:
 				s = append(s, byte(r))
 			case errEnd:
-				l.Emit(pos, t, string(s))
+				l.EmitString(pos, t, string(s))
 				return nil
 			case errEOL:
-				l.Backup()
-				l.Errorf(pos, msg[errEOL], "string")
+				unterminated(l, pos, "string")
+				if o.partial {
+					l.EmitString(pos, t, string(s))
+				}
 				return nil // keep going
 			case errInvalidEscape, errInvalidRune:
-				l.Errorf(l.Pos(), msg[err])
-				return terminateString(quote)
+				l.ErrorfHere(msg[err])
+				return terminateString(quote, pos, "string")
 			case errInvalidHex, errInvalidOctal:
-				l.Errorf(l.Pos(), msg[err], l.Current())
-				return terminateString(quote)
+				l.ErrorfHere(msg[err], l.Current())
+				return terminateString(quote, pos, "string")
 			}
 		}
 	}
@@ -115,7 +221,11 @@ func QuotedString(t lex.Token) lex.StateFn {
 // When entering the StateFn, the starting delimiter has already been read and
 // will be reused as end-delimiter.
 //
-func QuotedChar(t lex.Token) lex.StateFn {
+// Unterminated literals are handled like with QuotedString, including the
+// EmitPartial option.
+//
+func QuotedChar(t lex.Token, opts ...Option) lex.StateFn {
+	o := newOptions(opts)
 	return func(l *lex.State) lex.StateFn {
 		quote := l.Current()
 		pos := l.Pos()
@@ -124,39 +234,61 @@ func QuotedChar(t lex.Token) lex.StateFn {
 		case errNone, errRawByte:
 			n := l.Next()
 			if n == quote {
-				l.Emit(pos, t, r)
+				l.EmitRune(pos, t, r)
+				return nil
+			}
+			if n == '\n' || n == lex.EOF {
+				unterminated(l, pos, "character")
+				if o.partial {
+					l.EmitRune(pos, t, r)
+				}
 				return nil
 			}
-			pos = l.Pos()
-			l.Backup() // undo a potential EOF/EOL
-			l.Errorf(pos, msg[errSize])
-			return terminateString(quote)
+			l.ErrorfHere(msg[errSize])
+			return terminateString(quote, pos, "character")
 		case errEnd:
-			l.Errorf(l.Pos(), msg[errEmpty], quote)
+			l.ErrorfHere(msg[errEmpty], quote)
 			return nil
 		case errEOL:
-			l.Backup()
-			l.Errorf(pos, msg[errEOL], "character")
+			unterminated(l, pos, "character")
 			return nil // keep going
 		case errInvalidEscape, errInvalidRune:
-			l.Errorf(l.Pos(), msg[err])
-			return terminateString(quote)
+			l.ErrorfHere(msg[err])
+			return terminateString(quote, pos, "character")
 		case errInvalidHex, errInvalidOctal:
-			l.Errorf(l.Pos(), msg[err], l.Current())
-			return terminateString(quote)
+			l.ErrorfHere(msg[err], l.Current())
+			return terminateString(quote, pos, "character")
 		default:
 			panic("BUG: unexpected return value from readChar")
 		}
 	}
 }
 
-// terminateString eats up input looking for an end quote not preceded by '\'
-// TODO: if the rune that caused the error is a \, then our \ handling is off.
+// unterminated reports an unterminated literal opened at offset pos. The
+// current rune, end of line or EOF, is not consumed. Literals terminated by
+// EOF are marked incomplete (see lex.State.MarkIncomplete).
 //
-func terminateString(quote rune) lex.StateFn {
+func unterminated(l *lex.State, pos int, what string) {
+	if l.Current() == lex.EOF {
+		l.MarkIncomplete()
+	}
+	l.Backup()
+	l.Errorf(pos, msg[errEOL], what)
+}
+
+// terminateString eats up input looking for an end quote not preceded by '\'.
+// It is called after an error in a literal opened at offset pos and reports
+// the literal as unterminated if the end of line or EOF is reached first.
+//
+func terminateString(quote rune, pos int, what string) lex.StateFn {
 	return func(l *lex.State) lex.StateFn {
-		for {
-			r := l.Next()
+		// if the rune that caused the error is a '\', it starts an escape
+		// sequence.
+		r := l.Current()
+		if r != '\\' {
+			r = l.Next()
+		}
+		for ; ; r = l.Next() {
 			switch r {
 			case quote:
 				return nil
@@ -167,9 +299,7 @@ func terminateString(quote rune) lex.StateFn {
 				}
 				fallthrough
 			case '\n', lex.EOF:
-				// unterminated string. Just ignore the error since
-				// this function is already called on error.
-				l.Backup()
+				unterminated(l, pos, what)
 				return nil
 			}
 		}
@@ -1,8 +1,10 @@
 package state_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/big"
+	"net/netip"
 	"strconv"
 	"strings"
 	"testing"
@@ -20,6 +22,20 @@ const (
 	tokChar
 	tokColon
 	tokRawChar
+	tokNumber
+	tokRecordEnd
+	tokKey
+	tokTable
+	tokArrayTable
+	tokDirective
+	tokBody
+	tokCode
+	tokURL
+	tokEmail
+	tokVersion
+	tokAddr
+	tokPrefix
+	tokIdent
 )
 
 func itemString(l *lex.Lexer, t lex.Token, p int, v interface{}) string {
@@ -50,6 +66,42 @@ func itemString(l *lex.Lexer, t lex.Token, p int, v interface{}) string {
 		vs = strconv.QuoteRune(v.(rune))
 	case tokColon:
 		ts = "COLON"
+	case tokKey, tokTable, tokArrayTable:
+		ts = map[lex.Token]string{tokKey: "KEY", tokTable: "TABLE", tokArrayTable: "ARRAYTABLE"}[t]
+		vs = fmt.Sprintf("%q", v.([]string))
+	case tokDirective:
+		ts = "DIRECTIVE"
+		vs = strconv.Quote(v.(string))
+	case tokBody:
+		ts = "BODY"
+		vs = strconv.Quote(v.(string))
+	case tokCode:
+		ts = "CODE"
+		cb := v.(state.CodeBlock)
+		vs = fmt.Sprintf("%q %q", cb.Info, cb.Code)
+	case tokURL:
+		ts = "URL"
+		vs = strconv.Quote(v.(string))
+	case tokEmail:
+		ts = "EMAIL"
+		vs = strconv.Quote(v.(string))
+	case tokVersion:
+		ts = "VERSION"
+		vs = fmt.Sprintf("%s %q %q", v, v.(*state.Version).Pre, v.(*state.Version).Build)
+	case tokAddr:
+		ts = "ADDR"
+		vs = v.(netip.Addr).String()
+	case tokPrefix:
+		ts = "PREFIX"
+		vs = v.(netip.Prefix).String()
+	case tokIdent:
+		ts = "IDENT"
+		vs = strconv.Quote(v.(string))
+	case tokRecordEnd:
+		ts = "RECORDEND"
+	case tokNumber:
+		ts = "NUMBER"
+		vs = v.(json.Number).String()
 	default:
 		panic("unknown type")
 	}
@@ -104,6 +156,7 @@ func Test_QuotedString(t *testing.T) {
 			`1:12 Error escape sequence is invalid Unicode code point`,
 			`1:21 Error escape sequence is invalid Unicode code point`,
 			`1:32 Error escape sequence is invalid Unicode code point`,
+			`1:25 Error string literal not terminated`,
 		}},
 		{"str5", `"a`, res{`1:1 Error string literal not terminated`}},
 		{"str6", `"\x2X"`, res{`1:5 Error non-hex character in escape sequence: U+0058 'X'`}},
@@ -112,6 +165,7 @@ func Test_QuotedString(t *testing.T) {
 		{"str9", "\"a\n", res{`1:1 Error string literal not terminated`}},
 		{"str10", "\"a\\\n", res{`1:1 Error string literal not terminated`}},
 		{"str11", "\"\\21\n", res{`1:1 Error string literal not terminated`}},
+		{"str12", "\"\\x2\\\" \n", res{`1:5 Error non-hex character in escape sequence: U+005C '\'`, `1:1 Error string literal not terminated`}},
 	}
 	runTests(t, td, func(s *lex.State) lex.StateFn {
 		r := s.Next()
@@ -137,7 +191,8 @@ func Test_QuotedChar(t *testing.T) {
 		{"char2", `'aa'`, res{`1:3 Error invalid character literal (more than 1 character)`}},
 		{"char4", `'\z' '
 			`, res{`1:3 Error unknown escape sequence`, `1:6 Error character literal not terminated`}},
-		{"char5", `'\18`, res{`1:4 Error non-octal character in escape sequence: U+0038 '8'`}},
+		{"char5", `'\18`, res{`1:4 Error non-octal character in escape sequence: U+0038 '8'`, `1:1 Error character literal not terminated`}},
+		{"char6", "'a\n", res{`1:1 Error character literal not terminated`}},
 	}
 	runTests(t, td, func(s *lex.State) lex.StateFn {
 		r := s.Next()
@@ -157,6 +212,28 @@ func Test_QuotedChar(t *testing.T) {
 	})
 }
 
+func Test_EmitPartial(t *testing.T) {
+	var td = []testData{
+		{"str", "\"a\\tb\n\"", res{`1:1 Error string literal not terminated`, `1:1 STRING "a\tb"`, `2:1 Error string literal not terminated`, `2:1 STRING ""`}},
+		{"char", "'a\n'", res{`1:1 Error character literal not terminated`, `1:1 CHAR 'a'`, `2:1 Error character literal not terminated`}},
+		{"escape", `"\w`, res{`1:3 Error unknown escape sequence`, `1:1 Error string literal not terminated`}},
+	}
+	str := state.QuotedString(tokString, state.EmitPartial())
+	char := state.QuotedChar(tokChar, state.EmitPartial())
+	runTests(t, td, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch r {
+		case '"':
+			return str
+		case '\'':
+			return char
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		}
+		return nil
+	})
+}
+
 func Test_Number(t *testing.T) {
 	var td = []testData{
 		{"int10", ":12 0 4", res{"1:1 COLON", "1:2 INT 12", "1:5 INT 0", "1:7 INT 4"}},
@@ -180,6 +257,10 @@ func Test_Number(t *testing.T) {
 			`1:11 Error malformed floating-point literal exponent`,
 			`1:11 RAWCHAR 'e'`}},
 		{`float12`, `:0238:`, res{`1:1 COLON`, `1:5 Error invalid character U+0038 '8' in base 8 literal`, `1:6 COLON`}},
+		{`float13`, `1e9999999999:1e99999999999999999999:1e2147483648`, res{
+			`1:1 Error invalid floating-point literal: exponent overflow`, `1:13 COLON`,
+			`1:14 Error invalid floating-point literal: exponent overflow`, `1:36 COLON`,
+			`1:37 Error invalid floating-point literal: exponent overflow`}},
 	}
 	runTests(t, td, func(s *lex.State) lex.StateFn {
 		r := s.Next()
@@ -208,3 +289,430 @@ func Test_Number(t *testing.T) {
 		return nil
 	})
 }
+
+func Test_NumberStrict(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		var opts []state.Option
+		if strict {
+			opts = append(opts, state.Strict())
+		}
+		l := lex.NewLexer(lex.NewFile("test", strings.NewReader("x")), func(s *lex.State) lex.StateFn {
+			s.Next()
+			return state.Number(tokInt, tokFloat, '.', opts...)
+		})
+		func() {
+			defer func() {
+				if p := recover(); (p != nil) != strict {
+					t.Errorf("strict: %v, unexpected panic: %v", strict, p)
+				}
+			}()
+			tt, p, v := l.Lex()
+			if s := itemString(l, tt, p, v); s != "1:1 Error invalid character U+0078 'x' at start of number" {
+				t.Errorf("unexpected item: %s", s)
+			}
+		}()
+	}
+}
+
+func Test_NumberLimits(t *testing.T) {
+	var td = []testData{
+		{"digits", "12345 123456 0x12345 0x123456 1.2345 1.23456 1e123", res{
+			"1:1 INT 12345", "1:7 Error number literal too long: more than 5 digits",
+			"1:14 INT 74565", "1:22 Error number literal too long: more than 5 digits",
+			"1:31 FLOAT 1.234375", "1:38 Error number literal too long: more than 5 digits",
+			"1:46 FLOAT 1.001912953e+123"}},
+		{"exponent", "1e400 1e-400 1e401 1e-00000000000000000001", res{
+			"1:1 FLOAT 9.978856233e+399", "1:7 FLOAT 1.000039264e-400",
+			"1:14 Error floating-point literal exponent out of range: more than 400",
+			"1:20 FLOAT 0.1000976562"}},
+		{"prec", "0.1", res{"1:1 FLOAT 0.1000976562"}},
+	}
+	runTests(t, td, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		s.StartToken(s.Pos())
+		switch r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case ' ':
+		default:
+			return state.Number(tokInt, tokFloat, '.', state.MaxDigits(5), state.MaxExponent(400), state.FloatPrec(8))
+		}
+		return nil
+	})
+}
+
+func Test_JSON(t *testing.T) {
+	var td = []testData{
+		{"str1", `"a\"\\\/\b\f\n\r\t\u00e9\ud83d\ude00"`, res{`1:1 STRING "a\"\\/\b\f\n\r\té😀"`}},
+		{"str2", `"\a" "\x41"`, res{`1:3 Error unknown escape sequence`, `1:8 Error unknown escape sequence`}},
+		{"str3", `"\ud83d" "\ude00" "\ud83d\u0041"`, res{
+			`1:8 Error invalid surrogate pair in escape sequence`,
+			`1:16 Error invalid surrogate pair in escape sequence`,
+			`1:31 Error invalid surrogate pair in escape sequence`}},
+		{"str4", "\"a\tb\" \"a", res{`1:3 Error invalid control character U+0009 in string literal`, `1:7 Error string literal not terminated`}},
+		{"str5", `"\u00G0"`, res{`1:6 Error non-hex character in escape sequence: U+0047 'G'`}},
+		{"num1", "0 -0 12 -3.25 1e10 1E+2 -0.5e-3", res{
+			"1:1 NUMBER 0", "1:3 NUMBER -0", "1:6 NUMBER 12", "1:9 NUMBER -3.25",
+			"1:15 NUMBER 1e10", "1:20 NUMBER 1E+2", "1:25 NUMBER -0.5e-3"}},
+		{"num2", "01 -012 1. 1e -", res{
+			"1:1 Error invalid leading zero in number literal",
+			"1:4 Error invalid leading zero in number literal",
+			"1:11 Error malformed floating-point literal",
+			"1:14 Error malformed floating-point literal exponent",
+			"1:16 Error missing digits after '-' in number literal"}},
+	}
+	str := state.JSONString(tokString)
+	num := state.JSONNumber(tokNumber)
+	runTests(t, td, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch {
+		case r == '"':
+			return str
+		case r == '-' || r >= '0' && r <= '9':
+			return num
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r == ' ':
+		default:
+			s.Emit(s.Pos(), tokRawChar, r)
+		}
+		return nil
+	})
+}
+
+func Test_YAML(t *testing.T) {
+	var td = []testData{
+		{"plain", "a b: c d  # x\n{x y, z: w}", res{
+			`1:1 STRING "a b"`, `1:4 COLON`, `1:6 STRING "c d"`, `1:11 RAWCHAR '#'`, `1:13 STRING "x"`,
+			`2:1 RAWCHAR '{'`, `2:2 STRING "x y"`, `2:5 RAWCHAR ','`, `2:7 STRING "z"`, `2:8 COLON`, `2:10 STRING "w"`, `2:11 RAWCHAR '}'`}},
+		{"plain2", "a:b::c :\t- x", res{`1:1 STRING "a:b::c"`, `1:8 COLON`, `1:10 RAWCHAR '-'`, `1:12 STRING "x"`}},
+		{"single", "'it''s\n  a \n\n  b'", res{`1:1 STRING "it's a\nb"`}},
+		{"double", `"a\tb\x41\N\_\L \
+  c" "\q" "x`, res{`1:1 STRING "a\tbA\u0085\u00a0\u2028 c"`, `2:8 Error unknown escape sequence`, `2:11 Error string literal not terminated`}},
+		{"literal", "|\n  a\n\n   b\n\nc: |-\n  x\nd: |+2\n   y\n\ne: |\n", res{
+			`1:1 STRING "a\n\n b\n"`, `6:1 STRING "c"`, `6:2 COLON`, `6:4 STRING "x"`,
+			`8:1 STRING "d"`, `8:2 COLON`, `8:4 STRING " y\n\n"`, `11:1 STRING "e"`, `11:2 COLON`, `11:4 STRING ""`}},
+		{"folded", ">\n a\n b\n\n c\n  d\n e\n", res{`1:1 STRING "a b\nc\n d\ne\n"`}},
+		{"header", "|x\n>1 # c\n\n", res{`1:2 Error invalid block scalar header`, `2:1 STRING ""`}},
+	}
+	var (
+		plain  = state.YAMLPlain(tokString, false)
+		flow   = state.YAMLPlain(tokString, true)
+		quoted = state.YAMLQuoted(tokString)
+		block  = state.YAMLBlock(tokString, -1)
+		nested = state.YAMLBlock(tokString, 0)
+		depth  = 0
+	)
+	runTests(t, td, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r == ' ' || r == '\t' || r == '\n':
+		case r == ':' && (s.Peek() == ' ' || s.Peek() == '\t' || s.Peek() == '\n'):
+			s.Emit(s.Pos(), tokColon, nil)
+		case r == '{' || r == '}' || r == ',' || r == '#' || r == '-':
+			if r == '{' {
+				depth++
+			} else if r == '}' {
+				depth--
+			}
+			s.Emit(s.Pos(), tokRawChar, r)
+		case r == '"' || r == '\'':
+			return quoted
+		case r == '|' || r == '>':
+			if s.Pos() == 0 {
+				return block
+			}
+			return nested
+		case depth > 0:
+			return flow
+		default:
+			return plain
+		}
+		return nil
+	})
+}
+
+func Test_CSVField(t *testing.T) {
+	var td = []testData{
+		{"simple", "a,b c,\n,\n\nx", res{
+			`1:1 STRING "a"`, `1:3 STRING "b c"`, `1:7 STRING ""`, `1:7 RECORDEND`,
+			`2:1 STRING ""`, `2:2 STRING ""`, `2:2 RECORDEND`,
+			`3:1 STRING ""`, `3:1 RECORDEND`,
+			`4:1 STRING "x"`, `4:2 RECORDEND`}},
+		{"quoted", "\"a,\"\"b\"\"\r\nc\",\"\"\r\nd", res{
+			`1:1 STRING "a,\"b\"\nc"`, `2:4 STRING ""`, `2:6 RECORDEND`,
+			`3:1 STRING "d"`, `3:2 RECORDEND`}},
+		{"errors", "a\"b,\"c\"d,e\n\"f", res{
+			`1:2 Error bare " in non-quoted field`, `1:1 STRING "a\"b"`,
+			`1:8 Error unexpected character U+0064 'd' after quoted field`, `1:5 STRING "c"`,
+			`1:10 STRING "e"`, `1:11 RECORDEND`,
+			`2:1 Error quoted field not terminated`}},
+	}
+	field := state.CSVField(tokString, tokRecordEnd, ',')
+	runTests(t, td, func(s *lex.State) lex.StateFn {
+		if s.Next() == lex.EOF {
+			s.Emit(s.Pos(), tokEOF, nil)
+			return nil
+		}
+		return field
+	})
+}
+
+func Test_TOML(t *testing.T) {
+	var td = []testData{
+		{"keys", `a b-c_1 "x.y" a . "b\u00e9\t" .'c' a. b`, res{
+			`1:1 KEY ["a"]`, `1:3 KEY ["b-c_1"]`, `1:9 KEY ["x.y"]`,
+			`1:15 KEY ["a" "bé\t" "c"]`, `1:36 KEY ["a" "b"]`}},
+		{"keyerr", "a.\n\"\\x\" a.=", res{
+			`1:3 Error missing key`, `2:3 Error unknown escape sequence`, `2:8 Error invalid character U+003D '=' in key`}},
+		{"tables", "[a] [ a . 'b' ] [[c.d]] [[e] ] [f", res{
+			`1:1 TABLE ["a"]`, `1:5 TABLE ["a" "b"]`, `1:17 ARRAYTABLE ["c" "d"]`,
+			`1:29 Error invalid character U+0020 ' ' in table header, expected ']]'`, `1:30 RAWCHAR ']'`,
+			`1:32 Error table header not terminated`}},
+		{"literal", `'a\b' '' '''` + "\n" + `x''y'''' '''''' 'c` + "\n", res{
+			`1:1 STRING "a\\b"`, `1:7 STRING ""`, `1:10 STRING "x''y'"`, `2:10 STRING ""`,
+			`2:17 Error string literal not terminated`}},
+	}
+	var (
+		key   = state.TOMLKey(tokKey)
+		table = state.TOMLTable(tokTable, tokArrayTable)
+		lit   = state.TOMLLiteral(tokString)
+	)
+	runTests(t, td, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r == ' ' || r == '\n':
+		case r == '[':
+			return table
+		case r == ']' || r == '=':
+			s.Emit(s.Pos(), tokRawChar, r)
+		case r == '\'':
+			return lit
+		default:
+			return key
+		}
+		return nil
+	})
+}
+
+func Test_Directives(t *testing.T) {
+	var td = []testData{
+		{"directives", "#include <a.h>\n  # def\\\nine X \\\n 1 \nx # y\n#\n\t#if", res{
+			`1:1 DIRECTIVE "include"`, `1:10 BODY "<a.h>"`,
+			`2:3 DIRECTIVE "define"`, `3:5 BODY "X  1"`,
+			`5:1 RAWCHAR 'x'`, `5:3 RAWCHAR '#'`, `5:5 RAWCHAR 'y'`,
+			`6:1 DIRECTIVE ""`, `6:2 BODY ""`,
+			`7:2 DIRECTIVE "if"`, `7:5 BODY ""`}},
+	}
+	runTests(t, td, state.Directives(func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case ' ', '\t', '\n':
+		default:
+			s.Emit(s.Pos(), tokRawChar, r)
+		}
+		return nil
+	}, tokDirective, tokBody))
+}
+
+func Test_SQL(t *testing.T) {
+	var td = []testData{
+		{"string", `'it''s' '\' '' 'a` + "\n" + `b' 'x`, res{
+			`1:1 STRING "it's"`, `1:9 STRING "\\"`, `1:13 STRING ""`, `1:16 STRING "a\nb"`,
+			`2:4 Error string literal not terminated`}},
+		{"ident", `"a ""b""" "" "c`, res{
+			`1:1 STRING "a \"b\""`, `1:11 Error zero-length quoted identifier`,
+			`1:14 Error identifier literal not terminated`}},
+		{"dollar", "$$it's$$ $a$x$$y$b$a$ $_1$$_1 $_1$ $a- $b$", res{
+			`1:1 STRING "it's"`, `1:10 STRING "x$$y$b"`, `1:23 STRING "$_1 "`,
+			`1:38 Error invalid character U+002D '-' in dollar quote tag`, `1:38 RAWCHAR '-'`,
+			`1:40 Error string literal not terminated`}},
+	}
+	var (
+		str    = state.SQLString(tokString)
+		ident  = state.SQLIdentifier(tokString)
+		dollar = state.DollarQuoted(tokString)
+	)
+	runTests(t, td, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case ' ', '\n':
+		case '\'':
+			return str
+		case '"':
+			return ident
+		case '$':
+			return dollar
+		default:
+			s.Emit(s.Pos(), tokRawChar, r)
+		}
+		return nil
+	})
+}
+
+func Test_Markdown(t *testing.T) {
+	var td = []testData{
+		{"span", "``a ` b`` ` x ` `  ` ``a\nb``  `x\n\n`", res{
+			"1:1 STRING \"a ` b\"", `1:11 STRING "x"`, `1:17 STRING "  "`, `1:22 STRING "a b"`,
+			"2:6 Error code span literal not terminated", "4:1 Error code span literal not terminated"}},
+		{"fence", "```go {x}\nfmt.Println()\n ``` a\n\n  ````\n~~~~\na\n~~~\n~~~~~\n``", res{
+			"1:1 CODE \"go {x}\" \"fmt.Println()\\n ``` a\\n\\n\"",
+			"6:1 CODE \"\" \"a\\n~~~\\n\"",
+			"10:1 Error code span literal not terminated"}},
+	}
+	code := state.FencedCode(tokCode, tokString)
+	runTests(t, td, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch r {
+		case lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case ' ', '\n':
+		case '`', '~':
+			return code
+		default:
+			s.Emit(s.Pos(), tokRawChar, r)
+		}
+		return nil
+	})
+}
+
+func Test_Autolink(t *testing.T) {
+	var td = []testData{
+		{"urls", "see https://example.com/a_(b)?q=1). (www.x.org) ftp:/x mailto: http://", res{
+			`1:1 STRING "see"`, `1:5 URL "https://example.com/a_(b)?q=1"`, `1:34 RAWCHAR ')'`, `1:35 RAWCHAR '.'`,
+			`1:37 RAWCHAR '('`, `1:38 URL "www.x.org"`, `1:47 RAWCHAR ')'`,
+			`1:49 STRING "ftp"`, `1:52 RAWCHAR ':'`, `1:53 RAWCHAR '/'`, `1:54 STRING "x"`,
+			`1:56 STRING "mailto"`, `1:62 RAWCHAR ':'`, `1:64 STRING "http"`, `1:68 RAWCHAR ':'`, `1:69 RAWCHAR '/'`, `1:70 RAWCHAR '/'`}},
+		{"emails", "a.b+c@d-e.fr. x@y x@y- @z", res{
+			`1:1 EMAIL "a.b+c@d-e.fr"`, `1:13 RAWCHAR '.'`, `1:15 STRING "x@y"`, `1:19 STRING "x@y"`, `1:22 RAWCHAR '-'`,
+			`1:24 RAWCHAR '@'`, `1:25 STRING "z"`}},
+	}
+	link := state.Autolink(tokString, tokURL, tokEmail)
+	runTests(t, td, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r == ' ':
+		case r >= 'a' && r <= 'z':
+			return link
+		default:
+			s.Emit(s.Pos(), tokRawChar, r)
+		}
+		return nil
+	})
+}
+
+func Test_SemVer(t *testing.T) {
+	var td = []testData{
+		{"valid", "1.2.3 v0.10.0-alpha.1+build.5 1.0.0-x-y.0a+001. 1.0.0-rc.", res{
+			`1:1 VERSION 1.2.3 [] []`, `1:7 VERSION 0.10.0-alpha.1+build.5 ["alpha" "1"] ["build" "5"]`,
+			`1:31 VERSION 1.0.0-x-y.0a+001 ["x-y" "0a"] ["001"]`, `1:47 RAWCHAR '.'`,
+			`1:49 VERSION 1.0.0-rc ["rc"] []`, `1:57 RAWCHAR '.'`}},
+		{"invalid", "01.2.3 1.2 1.2.x 1.0.0-01 1.0.0+ 99999999999999999999.0.0", res{
+			`1:1 Error invalid leading zero in version number`, `1:11 Error invalid version: missing '.'`,
+			`1:16 Error invalid version: missing number`, `1:24 Error invalid leading zero in version number`,
+			`1:33 Error invalid version: empty identifier`, `1:34 Error version number out of range`}},
+	}
+	ver := state.SemVer(tokVersion)
+	runTests(t, td, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r == ' ':
+		case r == 'v' || r >= '0' && r <= '9':
+			return ver
+		default:
+			s.Emit(s.Pos(), tokRawChar, r)
+		}
+		return nil
+	})
+}
+
+func Test_IPAddr(t *testing.T) {
+	var td = []testData{
+		{"ip", "10.0.0.1. ::1 fe80::1%eth0, fe80:: 192.168.1.0/24 ::ffff:1.2.3.4/96: 10.0.0.1/ 1.2.3 1.2.3.4/33", res{
+			`1:1 ADDR 10.0.0.1`, `1:9 RAWCHAR '.'`, `1:11 ADDR ::1`, `1:15 ADDR fe80::1%eth0`, `1:27 RAWCHAR ','`,
+			`1:29 ADDR fe80::`, `1:36 PREFIX 192.168.1.0/24`, `1:51 PREFIX ::ffff:1.2.3.4/96`, `1:68 RAWCHAR ':'`,
+			`1:70 ADDR 10.0.0.1`, `1:78 RAWCHAR '/'`,
+			`1:80 Error invalid IP address "1.2.3"`,
+			`1:86 Error invalid IP prefix "1.2.3.4/33"`}},
+	}
+	ip := state.IPAddr(tokAddr, tokPrefix)
+	runTests(t, td, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r == ' ':
+		case r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r == ':' && s.Peek() == ':':
+			return ip
+		default:
+			s.Emit(s.Pos(), tokRawChar, r)
+		}
+		return nil
+	})
+}
+
+func Test_Identifier(t *testing.T) {
+	var td = []testData{
+		{"ident", "foo_1 _bar x9+y 2a", res{
+			`1:1 IDENT "foo_1"`, `1:7 IDENT "_bar"`, `1:12 IDENT "x9"`, `1:14 RAWCHAR '+'`, `1:15 IDENT "y"`,
+			`1:17 RAWCHAR '2'`, `1:18 IDENT "a"`}},
+	}
+	ident := state.Identifier(tokIdent)
+	runTests(t, td, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r == ' ':
+		case r == '_' || lex.IsIdentifierStart(r):
+			return ident
+		default:
+			s.Emit(s.Pos(), tokRawChar, r)
+		}
+		return nil
+	})
+}
+
+func Test_Emoji(t *testing.T) {
+	in := "\U0001F1EB\U0001F1F7 1\uFE0F\u20E3 2 \U0001F44D\U0001F3FD \U0001F469\u200D\U0001F4BB\u200D x " +
+		"\U0001F3F4\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F \U0001F1EB"
+	exp := res{
+		"1:1 STRING \"\U0001F1EB\U0001F1F7\"", "1:10 STRING \"1\uFE0F\u20E3\"", `1:18 STRING "2"`,
+		"1:20 STRING \"\U0001F44D\U0001F3FD\"", "1:29 STRING \"\U0001F469\\u200d\U0001F4BB\"", `1:40 RAWCHAR '\u200d'`,
+		`1:44 RAWCHAR 'x'`, "1:46 STRING \"\U0001F3F4\\U000e0067\\U000e0062\\U000e0073\\U000e0063\\U000e0074\\U000e007f\"",
+		"1:75 STRING \"\U0001F1EB\"",
+	}
+	emoji := state.Emoji(tokString)
+	l := lex.NewLexer(lex.NewFile("emoji", strings.NewReader(in)), func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r == ' ':
+		case state.IsEmoji(r) || r >= '0' && r <= '9':
+			return emoji
+		default:
+			s.Emit(s.Pos(), tokRawChar, r)
+		}
+		return nil
+	})
+	var got res
+	for tt, p, v := l.Lex(); tt != tokEOF; tt, p, v = l.Lex() {
+		got = append(got, itemString(l, tt, p, v))
+	}
+	if strings.Join(got, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("\nGot     : %q\nExpected: %q", got, exp)
+	}
+}
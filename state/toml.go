@@ -0,0 +1,299 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+const (
+	errTOMLKey     = "invalid character %#U in key"
+	errTOMLHeader  = "invalid character %#U in table header, expected '%s'"
+	errTOMLControl = "invalid control character %#U in string literal"
+	errTOMLNoKey   = "missing key"
+	errTOMLEnd     = "table header not terminated"
+)
+
+// TOMLKey returns a StateFn that lexes a TOML key. The key can be a bare key,
+// a basic or literal quoted key, or a dotted key made of any combination of
+// these, with optional white space around the dots. The key parts are emitted
+// as a []string value.
+//
+// When entering the StateFn, the first character of the key has already been
+// read. Trailing white space is left in the input, unless there are more than
+// lex.BackupBufferSize-2 white space characters, in which case it is consumed.
+//
+func TOMLKey(t lex.Token) lex.StateFn {
+	var k tomlKey
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		if key, ok := k.read(l); ok {
+			l.Emit(pos, t, key)
+		}
+		return nil
+	}
+}
+
+// TOMLTable returns a StateFn that lexes a TOML table header like
+// [section.sub] or an array of tables header like [[section.sub]]. The header
+// is emitted as a token of type table or arrayTable, with the key parts as a
+// []string value.
+//
+// When entering the StateFn, the opening '[' has already been read.
+//
+func TOMLTable(table, arrayTable lex.Token) lex.StateFn {
+	var k tomlKey
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		t, end := table, "]"
+		if l.Peek() == '[' {
+			l.Next()
+			t, end = arrayTable, "]]"
+		}
+		r := l.Next()
+		for r == ' ' || r == '\t' {
+			r = l.Next()
+		}
+		key, ok := k.read(l)
+		if !ok {
+			return nil
+		}
+		for r = l.Next(); r == ' ' || r == '\t'; r = l.Next() {
+		}
+		if r == ']' && t == arrayTable {
+			r = l.Next()
+		}
+		if r == '\n' || r == lex.EOF {
+			l.Errorf(pos, errTOMLEnd)
+			l.Backup()
+			return nil
+		}
+		if r != ']' {
+			l.Errorf(l.Pos(), errTOMLHeader, r, end)
+			l.Backup()
+			return nil
+		}
+		l.Emit(pos, t, key)
+		return nil
+	}
+}
+
+// TOMLLiteral returns a StateFn that lexes a TOML literal string: a single
+// line string enclosed in single quotes without any escape sequences, or a
+// multi-line literal string enclosed in triple single quotes. In multi-line
+// strings, a line break immediately following the opening delimiter is
+// trimmed and "\r\n" line breaks are converted to "\n". Control characters
+// other than tabs are reported as errors.
+//
+// When entering the StateFn, the opening quote has already been read. Single
+// line strings are terminated at the end of the line. The EmitPartial option
+// is supported.
+//
+func TOMLLiteral(t lex.Token, opts ...Option) lex.StateFn {
+	o := newOptions(opts)
+	s := make([]byte, 0, 64)
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		s = s[:0]
+		multi := false
+		if l.Peek() == '\'' {
+			l.Next()
+			if l.Peek() != '\'' {
+				l.EmitString(pos, t, "")
+				return nil
+			}
+			l.Next()
+			multi = true
+			if r := l.Peek(); r == '\n' {
+				l.Next()
+			} else if r == '\r' {
+				l.Next()
+				if l.Peek() == '\n' {
+					l.Next()
+				} else {
+					l.Backup()
+				}
+			}
+		}
+		for {
+			r := l.Next()
+			switch {
+			case r == '\'' && !multi:
+				l.EmitString(pos, t, string(s))
+				return nil
+			case r == '\'':
+				// up to two quotes are allowed before the closing delimiter
+				n := 1
+				for n < 5 && l.Peek() == '\'' {
+					l.Next()
+					n++
+				}
+				if n >= 3 {
+					for ; n > 3; n-- {
+						s = append(s, '\'')
+					}
+					l.EmitString(pos, t, string(s))
+					return nil
+				}
+				for ; n > 0; n-- {
+					s = append(s, '\'')
+				}
+				continue
+			case r == lex.EOF || r == '\n' && !multi:
+				unterminated(l, pos, "string")
+				if o.partial {
+					l.EmitString(pos, t, string(s))
+				}
+				return nil
+			case r == '\r' && multi && l.Peek() == '\n':
+				continue
+			case r < 0x20 && r != '\t' && r != '\n' || r == 0x7f:
+				l.Errorf(l.Pos(), errTOMLControl, r)
+				continue
+			}
+			s = utf8.AppendRune(s, r)
+		}
+	}
+}
+
+// tomlKey reads dotted keys.
+//
+type tomlKey struct {
+	buf []byte
+}
+
+// read reads a key whose first character is l.Current(). It reports errors
+// and returns false if the key is invalid.
+//
+func (k *tomlKey) read(l *lex.State) ([]string, bool) {
+	var key []string
+	r := l.Current()
+	for {
+		k.buf = k.buf[:0]
+		pos := l.Pos()
+		switch {
+		case isBareKey(r):
+			k.buf = utf8.AppendRune(k.buf, r)
+			for isBareKey(l.Peek()) {
+				k.buf = utf8.AppendRune(k.buf, l.Next())
+			}
+		case r == '"' || r == '\'':
+			for {
+				c := l.Next()
+				if c == r {
+					break
+				}
+				switch {
+				case c == '\n' || c == lex.EOF:
+					unterminated(l, pos, "string")
+					return nil, false
+				case c == '\\' && r == '"':
+					var err int
+					if c, err = readTOMLEscape(l); err != errNone {
+						if err == errEOL {
+							unterminated(l, pos, "string")
+							return nil, false
+						} else if err == errInvalidHex {
+							l.Errorf(l.Pos(), msg[err], l.Current())
+						} else {
+							l.Errorf(l.Pos(), msg[err])
+						}
+						if l.Current() != r {
+							terminateString(r, pos, "string")(l)
+						}
+						return nil, false
+					}
+				case c < 0x20 && c != '\t' || c == 0x7f:
+					l.Errorf(l.Pos(), errTOMLControl, c)
+					terminateString(r, pos, "string")(l)
+					return nil, false
+				}
+				k.buf = utf8.AppendRune(k.buf, c)
+			}
+		case r == '\n' || r == lex.EOF:
+			l.Errorf(pos, errTOMLNoKey)
+			l.Backup()
+			return nil, false
+		default:
+			l.Errorf(pos, errTOMLKey, r)
+			return nil, false
+		}
+		key = append(key, string(k.buf))
+
+		// look for a dot, skipping white space
+		ws := 0
+		for r = l.Peek(); r == ' ' || r == '\t'; r = l.Peek() {
+			l.Next()
+			ws++
+		}
+		if r != '.' {
+			if ws < lex.BackupBufferSize-1 {
+				for ; ws > 0; ws-- {
+					l.Backup()
+				}
+			}
+			return key, true
+		}
+		l.Next()
+		for r = l.Next(); r == ' ' || r == '\t'; r = l.Next() {
+		}
+	}
+}
+
+func isBareKey(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-'
+}
+
+// readTOMLEscape reads a TOML escape sequence after its '\'.
+//
+func readTOMLEscape(l *lex.State) (rune, int) {
+	switch r := l.Next(); r {
+	case 'b':
+		return '\b', errNone
+	case 't':
+		return '\t', errNone
+	case 'n':
+		return '\n', errNone
+	case 'f':
+		return '\f', errNone
+	case 'r':
+		return '\r', errNone
+	case 'e':
+		return 0x1b, errNone
+	case '"', '\\':
+		return r, errNone
+	case 'u', 'U':
+		n := int32(4)
+		if r == 'U' {
+			n = 8
+		}
+		r, err := readDigits(l, n, 16)
+		if err == errNone && (r > utf8.MaxRune || r >= 0xd800 && r < 0xe000) {
+			err = errInvalidRune
+		}
+		return r, err
+	case '\n', lex.EOF:
+		return r, errEOL
+	default:
+		return r, errInvalidEscape
+	}
+}
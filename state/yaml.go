@@ -0,0 +1,413 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+const (
+	errYAMLPlainStart = "invalid character %#U at start of plain scalar"
+	errYAMLHeader     = "invalid block scalar header"
+	errYAMLIndent     = "leading empty lines of block scalar are more indented than its content"
+)
+
+// YAMLPlain returns a StateFn that lexes a YAML plain (unquoted) scalar. If
+// flow is true, the scalar is in a flow collection and also ends at one of the
+// flow indicators ",[]{}".
+//
+// Plain scalars end at the end of the line, before a ": " mapping indicator or
+// before a " #" comment. Since continuation lines depend on the indentation of
+// the enclosing node, multi-line plain scalars are not supported: the StateFn
+// does not consume the line break and continuation lines should be folded by
+// the caller. Trailing white space is not part of the token value and is left
+// in the input, unless there are more than lex.BackupBufferSize-2 white space
+// characters.
+//
+// When entering the StateFn, the first character of the scalar has already
+// been read.
+//
+func YAMLPlain(t lex.Token, flow bool) lex.StateFn {
+	s := make([]byte, 0, 64)
+	ws := make([]byte, 0, 16) // white space read but not yet in s
+	var rb [utf8.UTFMax]byte
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		s, ws = s[:0], ws[:0]
+		r := l.Current()
+		switch r {
+		case '-', '?', ':':
+			if n := l.Peek(); isYAMLSpace(n) || flow && isFlowIndicator(n) {
+				l.Errorf(pos, errYAMLPlainStart, r)
+				return nil
+			}
+		case ',', '[', ']', '{', '}', '#', '&', '*', '!', '|', '>', '\'', '"', '%', '@', '`', ' ', '\t', '\n', lex.EOF:
+			l.Errorf(pos, errYAMLPlainStart, r)
+			return nil
+		}
+		for {
+			switch {
+			case r == ' ' || r == '\t':
+				ws = append(ws, byte(r))
+			case r < utf8.RuneSelf:
+				s = append(append(s, ws...), byte(r))
+				ws = ws[:0]
+			default:
+				s = append(append(s, ws...), rb[:utf8.EncodeRune(rb[:], r)]...)
+				ws = ws[:0]
+			}
+			n := l.Peek()
+			if n == '\n' || n == lex.EOF || n == '#' && len(ws) > 0 || flow && isFlowIndicator(n) {
+				break
+			}
+			if n == ':' {
+				l.Next()
+				n = l.Peek()
+				l.Backup()
+				if isYAMLSpace(n) || flow && isFlowIndicator(n) {
+					break
+				}
+			}
+			r = l.Next()
+		}
+		if len(ws) < lex.BackupBufferSize-1 {
+			for range ws {
+				l.Backup()
+			}
+		}
+		l.EmitString(pos, t, string(s))
+		return nil
+	}
+}
+
+func isYAMLSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == lex.EOF
+}
+
+func isFlowIndicator(r rune) bool {
+	return r == ',' || r == '[' || r == ']' || r == '{' || r == '}'
+}
+
+// YAMLQuoted returns a StateFn that lexes a single or double-quoted YAML
+// scalar. The quote character is the one read before entering the StateFn.
+//
+// In single-quoted scalars, the only escape sequence is a doubled quote.
+// Double-quoted scalars support the YAML escape sequences, including \N, \_,
+// \L, \P and escaped line breaks. In both styles, line breaks are folded: a single line
+// break becomes a space, and each empty line becomes a line break. White space
+// surrounding line breaks is discarded. Quoted scalars can span several lines,
+// so only EOF is reported as an unterminated literal. The indentation of
+// continuation lines is not checked.
+//
+// The EmitPartial option is supported.
+//
+func YAMLQuoted(t lex.Token, opts ...Option) lex.StateFn {
+	o := newOptions(opts)
+	s := make([]byte, 0, 64)
+	var rb [utf8.UTFMax]byte
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		quote := l.Current()
+		s = s[:0]
+		keep := 0 // length of s without trailing unescaped white space
+		for {
+			r := l.Next()
+			switch {
+			case r == lex.EOF:
+				unterminated(l, pos, "string")
+				if o.partial {
+					l.EmitString(pos, t, string(s[:keep]))
+				}
+				return nil
+			case r == quote && quote == '\'' && l.Peek() == '\'':
+				l.Next()
+			case r == quote:
+				l.EmitString(pos, t, string(s))
+				return nil
+			case r == '\n':
+				s = s[:keep]
+				if skipYAMLBreaks(l, &s) == 0 {
+					s = append(s, ' ')
+				}
+				keep = len(s)
+				continue
+			case r == ' ' || r == '\t':
+				s = append(s, byte(r))
+				continue
+			case r == '\\' && quote == '"':
+				var err int
+				if r, err = readYAMLEscape(l); err != errNone {
+					switch err {
+					case errEnd:
+						// escaped line break
+						skipYAMLBreaks(l, &s)
+						keep = len(s)
+						continue
+					case errEOL:
+						unterminated(l, pos, "string")
+						return nil
+					case errInvalidHex:
+						l.Errorf(l.Pos(), msg[err], l.Current())
+					default:
+						l.Errorf(l.Pos(), msg[err])
+					}
+					if l.Current() == quote {
+						return nil
+					}
+					return skipYAMLQuoted(pos)
+				}
+			}
+			if r < utf8.RuneSelf {
+				s = append(s, byte(r))
+			} else {
+				s = append(s, rb[:utf8.EncodeRune(rb[:], r)]...)
+			}
+			keep = len(s)
+		}
+	}
+}
+
+// skipYAMLBreaks skips white space and empty lines following a line break in
+// a quoted scalar and appends a line break to s for each empty line. It
+// returns the number of empty lines.
+//
+func skipYAMLBreaks(l *lex.State, s *[]byte) int {
+	n := 0
+	for {
+		switch l.Peek() {
+		case ' ', '\t':
+			l.Next()
+		case '\n':
+			l.Next()
+			*s = append(*s, '\n')
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+// skipYAMLQuoted eats up input looking for the end of a double-quoted scalar
+// after an error.
+//
+func skipYAMLQuoted(pos int) lex.StateFn {
+	return func(l *lex.State) lex.StateFn {
+		r := l.Current()
+		if r != '\\' {
+			r = l.Next()
+		}
+		for ; ; r = l.Next() {
+			switch r {
+			case '"':
+				return nil
+			case '\\':
+				if l.Next() != lex.EOF {
+					continue
+				}
+				fallthrough
+			case lex.EOF:
+				unterminated(l, pos, "string")
+				return nil
+			}
+		}
+	}
+}
+
+// readYAMLEscape reads a YAML escape sequence after its '\'. It returns errEnd
+// for an escaped line break.
+//
+func readYAMLEscape(l *lex.State) (rune, int) {
+	r := l.Next()
+	switch r {
+	case '0':
+		return 0, errNone
+	case 'a':
+		return '\a', errNone
+	case 'b':
+		return '\b', errNone
+	case 't', '\t':
+		return '\t', errNone
+	case 'n':
+		return '\n', errNone
+	case 'v':
+		return '\v', errNone
+	case 'f':
+		return '\f', errNone
+	case 'r':
+		return '\r', errNone
+	case 'e':
+		return 0x1b, errNone
+	case ' ', '"', '/', '\\':
+		return r, errNone
+	case 'N':
+		return 0x85, errNone
+	case '_':
+		return 0xa0, errNone
+	case 'L':
+		return 0x2028, errNone
+	case 'P':
+		return 0x2029, errNone
+	case 'x', 'u', 'U':
+		n := int32(2)
+		if r == 'u' {
+			n = 4
+		} else if r == 'U' {
+			n = 8
+		}
+		r, err := readDigits(l, n, 16)
+		if err == errNone && (r > utf8.MaxRune || r >= 0xd800 && r < 0xe000) {
+			err = errInvalidRune
+		}
+		return r, err
+	case '\n':
+		return r, errEnd
+	case lex.EOF:
+		return r, errEOL
+	default:
+		return r, errInvalidEscape
+	}
+}
+
+// YAMLBlock returns a StateFn that lexes a YAML literal (|) or folded (>)
+// block scalar. The block indicator is the character read before entering the
+// StateFn. The indent argument is the indentation of the parent node, in
+// number of spaces (-1 for a top level node). The content of the scalar must
+// be indented by more than indent spaces.
+//
+// The block scalar header supports indentation indicators and chomping
+// indicators. If no indentation indicator is present, the content indentation
+// is detected from the first non-empty line.
+//
+// The scalar ends before the first non-empty line that is less indented than
+// its content. The indentation of this line is left in the input, unless it
+// has more than lex.BackupBufferSize-2 spaces, in which case it is consumed.
+// Since the column of the next token can be computed from its offset, callers
+// that track indentation are not affected either way.
+//
+func YAMLBlock(t lex.Token, indent int) lex.StateFn {
+	var b strings.Builder
+	return func(l *lex.State) lex.StateFn {
+		pos := l.Pos()
+		folded := l.Current() == '>'
+
+		// header
+		n, chomp := -1, byte(0) // content indentation, chomping indicator
+		r := l.Next()
+		for i := 0; i < 2; i++ {
+			switch {
+			case r >= '1' && r <= '9' && n < 0:
+				if n = int(r - '0'); indent > 0 {
+					n += indent
+				}
+			case (r == '-' || r == '+') && chomp == 0:
+				chomp = byte(r)
+			default:
+				continue
+			}
+			r = l.Next()
+		}
+		for r == ' ' || r == '\t' {
+			if r = l.Next(); r == '#' {
+				for r != '\n' && r != lex.EOF {
+					r = l.Next()
+				}
+			}
+		}
+		if r != '\n' && r != lex.EOF {
+			l.Errorf(l.Pos(), errYAMLHeader)
+			for r != '\n' && r != lex.EOF {
+				r = l.Next()
+			}
+			return nil
+		}
+
+		// content
+		b.Reset()
+		var (
+			breaks   = 0     // pending line breaks
+			maxEmpty = 0     // indentation of the longest leading empty line
+			prevMore = false // previous line is more indented
+			first    = true
+		)
+		for r != lex.EOF {
+			sp := 0
+			for (n < 0 || sp < n) && l.Peek() == ' ' {
+				l.Next()
+				sp++
+			}
+			r = l.Peek()
+			if r == '\n' {
+				l.Next()
+				if first && sp > maxEmpty {
+					maxEmpty = sp
+				}
+				breaks++
+				continue
+			}
+			if r == lex.EOF {
+				break
+			}
+			if n < 0 {
+				if n = sp; sp <= indent {
+					n = indent + 1
+				} else if maxEmpty > n {
+					l.Errorf(l.Pos(), errYAMLIndent)
+				}
+			}
+			if sp < n {
+				if sp < lex.BackupBufferSize-1 {
+					for ; sp > 0; sp-- {
+						l.Backup()
+					}
+				}
+				break
+			}
+			more := r == ' ' || r == '\t'
+			switch {
+			case first || !folded || more || prevMore:
+				b.WriteString(strings.Repeat("\n", breaks))
+			case breaks == 1:
+				b.WriteByte(' ')
+			default:
+				b.WriteString(strings.Repeat("\n", breaks-1))
+			}
+			first, prevMore, breaks = false, more, 0
+			for r = l.Next(); r != '\n' && r != lex.EOF; r = l.Next() {
+				b.WriteRune(r)
+			}
+			if r == '\n' {
+				breaks = 1
+			}
+		}
+
+		// chomping
+		switch {
+		case chomp == '+':
+			b.WriteString(strings.Repeat("\n", breaks))
+		case chomp == 0 && !first && breaks > 0:
+			b.WriteByte('\n')
+		}
+		l.EmitString(pos, t, b.String())
+		return nil
+	}
+}
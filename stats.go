@@ -0,0 +1,175 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// Stats holds the performance counters of a lexer. See CollectStats.
+//
+type Stats struct {
+	Tokens map[Token]int          // number of tokens emitted per token type
+	Bytes  int                    // number of bytes consumed
+	Fills  int                    // number of times the input buffer was refilled
+	States map[string]*StateStats // per state function statistics, by function name
+}
+
+// StateStats holds the statistics of a state function.
+//
+type StateStats struct {
+	Calls   int           // number of calls
+	Sampled int           // number of timed calls
+	Time    time.Duration // total time spent in timed calls
+}
+
+// Estimate returns an estimate of the total time spent in the state function,
+// extrapolated from the timed calls.
+//
+func (st *StateStats) Estimate() time.Duration {
+	if st.Sampled == 0 {
+		return 0
+	}
+	return st.Time * time.Duration(st.Calls) / time.Duration(st.Sampled)
+}
+
+// stats holds the counters of a lexer. State functions are identified by the
+// entry PC of their code so that all the closures created by a given function
+// literal are accounted together.
+//
+type stats struct {
+	tokens map[Token]int
+	fills  int
+	states map[uintptr]*StateStats
+	sample int
+	n      int
+	ctx    context.Context
+	labels map[uintptr]context.Context
+}
+
+func (s *state) getStats() *stats {
+	if s.stats == nil {
+		s.stats = &stats{
+			tokens: make(map[Token]int),
+			states: make(map[uintptr]*StateStats),
+		}
+	}
+	return s.stats
+}
+
+// CollectStats enables the collection of performance counters, which can be
+// retrieved with Lexer.Stats. One in every sample state function calls is
+// timed. If sample <= 0, state functions are counted but not timed.
+//
+// Collecting statistics has a significant impact on performance, even without
+// timing, and should only be used while tuning a lexer.
+//
+func CollectStats(sample int) Option {
+	return debugOption(func(s *state) {
+		s.getStats().sample = sample
+	}, "CollectStats", sample)
+}
+
+// ProfileLabels sets pprof labels while state functions run, so that CPU
+// profiles can be broken down by state function. Each state function is run
+// with the labels of ctx plus a "lex.state" label set to the name of the
+// function. Between state function calls, the goroutine labels are set to
+// those of ctx.
+//
+// ProfileLabels implies CollectStats(0) unless CollectStats is also specified.
+// If ctx is nil, context.Background() is used.
+//
+func ProfileLabels(ctx context.Context) Option {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return debugOption(func(s *state) {
+		st := s.getStats()
+		st.ctx = ctx
+		st.labels = make(map[uintptr]context.Context)
+	}, "ProfileLabels", "ctx")
+}
+
+// run runs fn, updating counters.
+//
+func (st *stats) run(s *State, fn StateFn) StateFn {
+	pc := reflect.ValueOf(fn).Pointer()
+	ss := st.states[pc]
+	if ss == nil {
+		ss = new(StateStats)
+		st.states[pc] = ss
+	}
+	ss.Calls++
+	if st.ctx != nil {
+		ctx := st.labels[pc]
+		if ctx == nil {
+			ctx = pprof.WithLabels(st.ctx, pprof.Labels("lex.state", funcName(pc)))
+			st.labels[pc] = ctx
+		}
+		pprof.SetGoroutineLabels(ctx)
+		defer pprof.SetGoroutineLabels(st.ctx)
+	}
+	if st.sample > 0 {
+		if st.n++; st.n >= st.sample {
+			st.n = 0
+			t := time.Now()
+			next := fn(s)
+			ss.Sampled++
+			ss.Time += time.Since(t)
+			return next
+		}
+	}
+	return fn(s)
+}
+
+func funcName(pc uintptr) string {
+	if f := runtime.FuncForPC(pc); f != nil {
+		return f.Name()
+	}
+	return "?"
+}
+
+// Stats returns a snapshot of the lexer's performance counters, or nil if
+// statistics are not enabled. See CollectStats.
+//
+func (l *Lexer) Stats() *Stats {
+	st := l.stats
+	if st == nil {
+		return nil
+	}
+	r := &Stats{
+		Tokens: make(map[Token]int, len(st.tokens)),
+		Bytes:  l.offs + l.r,
+		Fills:  st.fills,
+		States: make(map[string]*StateStats, len(st.states)),
+	}
+	for t, n := range st.tokens {
+		r.Tokens[t] = n
+	}
+	for pc, ss := range st.states {
+		c := *ss
+		r.States[funcName(pc)] = &c
+	}
+	return r
+}
@@ -0,0 +1,77 @@
+package lex_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func statsSpace(s *lex.State) lex.StateFn {
+	for s.Next() == ' ' {
+	}
+	s.Backup()
+	s.Emit(s.TokenPos(), tokSpace, nil)
+	return nil
+}
+
+func statsInit(s *lex.State) lex.StateFn {
+	switch r := s.Next(); r {
+	case lex.EOF:
+		s.Emit(s.Pos(), tokEOF, nil)
+	case ' ':
+		s.StartToken(s.Pos())
+		return statsSpace
+	default:
+		s.EmitRune(s.Pos(), tokChar, r)
+	}
+	return nil
+}
+
+func TestLexer_Stats(t *testing.T) {
+	in := strings.Repeat("ab  c ", 10)
+	for _, tc := range []struct {
+		opt     lex.Option
+		sampled int
+	}{
+		{lex.CollectStats(0), 0},
+		{lex.CollectStats(3), 23},
+		{lex.ProfileLabels(context.Background()), 0},
+	} {
+		opts := []lex.Option{tc.opt, lex.BufferSize(lex.MinBufferSize)}
+		l := lex.NewLexer(lex.NewFile("", strings.NewReader(in)), statsInit, opts...)
+		for !l.AtEOF() {
+			l.Lex()
+		}
+		st := l.Stats()
+		if st.Tokens[tokChar] != 30 || st.Tokens[tokSpace] != 20 || st.Tokens[tokEOF] != 1 {
+			t.Errorf("unexpected token counts %v", st.Tokens)
+		}
+		if st.Bytes != len(in) {
+			t.Errorf("got %d bytes, expected %d", st.Bytes, len(in))
+		}
+		if st.Fills < len(in)/lex.MinBufferSize {
+			t.Errorf("got %d fills, expected at least %d", st.Fills, len(in)/lex.MinBufferSize)
+		}
+		var calls, sampled int
+		for name, ss := range st.States {
+			if !strings.HasSuffix(name, ".statsInit") && !strings.HasSuffix(name, ".statsSpace") {
+				t.Errorf("unexpected state function %q", name)
+			}
+			calls += ss.Calls
+			sampled += ss.Sampled
+		}
+		if calls != 71 {
+			t.Errorf("got %d calls, expected 71", calls)
+		}
+		if sampled != tc.sampled {
+			t.Errorf("got %d sampled calls, expected %d", sampled, tc.sampled)
+		}
+		l.Release()
+	}
+	l := lex.NewLexer(lex.NewFile("", strings.NewReader(in)), statsInit)
+	if l.Stats() != nil {
+		t.Error("stats enabled by default")
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+// Tee returns n token sources that each return all the tokens lexed by l, for
+// example to feed both a parser and a syntax highlighter without lexing the
+// input twice. Tokens are lexed on demand, when the fastest source needs them,
+// and buffered until the slowest source has read them. A source that is no
+// longer read must be closed with TeeSource.Close so that it does not hold
+// tokens in the buffer.
+//
+// Like the Lexer, the sources are not safe for concurrent use. l must not be
+// read directly once Tee has been called.
+//
+func Tee(l *Lexer, n int) []*TeeSource {
+	t := &tee{l: l}
+	srcs := make([]*TeeSource, n)
+	for i := range srcs {
+		srcs[i] = &TeeSource{t: t}
+	}
+	t.srcs = srcs
+	return srcs
+}
+
+type tee struct {
+	l     *Lexer
+	items []Item // buffered tokens
+	head  int    // index in items of the first buffered token
+	off   int    // number of tokens discarded from items
+	srcs  []*TeeSource
+}
+
+// A TeeSource is a source of tokens returned by Tee.
+//
+type TeeSource struct {
+	t      *tee
+	pos    int // number of tokens read
+	closed bool
+}
+
+var _ TokenSource = (*TeeSource)(nil)
+
+// Lex returns the next token like Lexer.Lex.
+//
+func (s *TeeSource) Lex() (Token, int, interface{}) {
+	it := s.LexItem()
+	return it.Type, it.Pos, it.Value()
+}
+
+// LexItem returns the next token like Lexer.LexItem.
+//
+func (s *TeeSource) LexItem() Item {
+	t := s.t
+	i := s.pos - t.off
+	if i == len(t.items) {
+		t.items = append(t.items, t.l.LexItem())
+	}
+	it := t.items[i]
+	s.pos++
+	if i == t.head {
+		t.trim()
+	}
+	return it
+}
+
+// AtEOF reports whether the source has returned all the tokens of the lexer
+// and the lexer has reached the end of input, like Lexer.AtEOF.
+//
+func (s *TeeSource) AtEOF() bool {
+	return s.pos-s.t.off == len(s.t.items) && s.t.l.AtEOF()
+}
+
+// File returns the File used as input for the lexer.
+//
+func (s *TeeSource) File() *File {
+	return s.t.l.File()
+}
+
+// Close detaches s from the other sources: tokens are no longer buffered for
+// s. s must not be used after Close.
+//
+func (s *TeeSource) Close() {
+	if !s.closed {
+		s.closed = true
+		s.t.trim()
+	}
+}
+
+// trim discards the tokens read by all the sources.
+//
+func (t *tee) trim() {
+	min := -1
+	for _, s := range t.srcs {
+		if !s.closed && (min < 0 || s.pos < min) {
+			min = s.pos
+		}
+	}
+	if min < 0 {
+		min = t.off + len(t.items)
+	}
+	for i := t.head; i < min-t.off; i++ {
+		t.items[i] = Item{}
+	}
+	if t.head = min - t.off; t.head > len(t.items)/2 {
+		n := copy(t.items, t.items[t.head:])
+		t.items = t.items[:n]
+		t.off += t.head
+		t.head = 0
+	}
+}
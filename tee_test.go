@@ -0,0 +1,52 @@
+package lex_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestTee(t *testing.T) {
+	init := func(s *lex.State) lex.StateFn {
+		if r := s.Next(); r == lex.EOF {
+			s.Emit(s.Pos(), tokEOF, nil)
+		} else {
+			s.EmitRune(s.Pos(), tokChar, r)
+		}
+		return nil
+	}
+	const in = "Hello, World!"
+	srcs := lex.Tee(lex.NewLexer(lex.NewFile("test", strings.NewReader(in)), init), 3)
+	var bufs [3]strings.Builder
+	read := func(i int) {
+		if srcs[i].AtEOF() {
+			return
+		}
+		if it := srcs[i].LexItem(); it.Type == tokChar {
+			r, _ := it.Rune()
+			bufs[i].WriteRune(r)
+		}
+	}
+	// source 0 reads 2 tokens for every token read by source 1, source 2 is
+	// closed after 3 tokens.
+	for i := 0; !srcs[0].AtEOF() || !srcs[1].AtEOF(); i++ {
+		read(0)
+		read(0)
+		read(1)
+		if i < 3 {
+			read(2)
+		} else if i == 3 {
+			srcs[2].Close()
+		}
+	}
+	if s := bufs[0].String(); s != in {
+		t.Errorf("source 0: got %q, expected %q", s, in)
+	}
+	if s := bufs[1].String(); s != in {
+		t.Errorf("source 1: got %q, expected %q", s, in)
+	}
+	if s := bufs[2].String(); s != in[:3] {
+		t.Errorf("source 2: got %q, expected %q", s, in[:3])
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package textscan provides an adapter exposing the API of the standard
+// library's text/scanner package on top of a lex.Lexer.
+//
+// It is meant to help migrating code from text/scanner: the parser keeps
+// calling Scan and TokenText while the input is tokenized by lex state
+// functions, with streaming input and any number of token types.
+//
+// Since tokens are produced by the Lexer, the character level methods of
+// text/scanner (Next, Peek) and its Mode, Whitespace and IsIdentRune settings
+// have no equivalent.
+//
+package textscan
+
+import (
+	"fmt"
+	"os"
+	"text/scanner"
+	"unicode/utf8"
+
+	"github.com/db47h/lex"
+)
+
+// A Scanner implements the Scan, TokenText and Pos methods of
+// text/scanner.Scanner for tokens read from a lex.Lexer.
+//
+type Scanner struct {
+	// Error is called for each Error token returned by the lexer. If Error
+	// is nil, errors are reported to os.Stderr.
+	Error func(s *Scanner, msg string)
+
+	// ErrorCount is incremented by one for each Error token.
+	ErrorCount int
+
+	// Start position of most recently scanned token; set by Scan. The Column
+	// field is a byte offset, as returned by lex.File.Position.
+	scanner.Position
+
+	l      *lex.Lexer
+	tokens map[lex.Token]rune
+	text   string
+	end    int
+	eof    bool
+}
+
+// New returns a Scanner reading tokens from l. The tokens map translates token
+// types to the values returned by Scan, typically the token classes of
+// text/scanner (scanner.Ident, scanner.Int, ...). Tokens that are not found in
+// tokens are returned as the first rune of their text, like the operators and
+// delimiters returned by text/scanner.
+//
+// The EOF token of the lexer must be mapped to scanner.EOF. Once scanner.EOF
+// has been returned, subsequent calls to Scan return scanner.EOF without
+// calling the lexer.
+//
+func New(l *lex.Lexer, tokens map[lex.Token]rune) *Scanner {
+	return &Scanner{l: l, tokens: tokens}
+}
+
+// Scan reads the next token from the lexer and returns its class. Error tokens
+// are reported by calling s.Error and skipped.
+//
+func (s *Scanner) Scan() rune {
+	if s.eof {
+		s.text = ""
+		s.Position = s.position(s.end)
+		return scanner.EOF
+	}
+	for {
+		it := s.l.LexItem()
+		if it.Type == lex.Error {
+			s.Position = s.position(it.Pos)
+			s.error(it.Err().Error())
+			continue
+		}
+		s.text = text(it.Value())
+		s.Position = s.position(it.Pos)
+		s.end = it.End
+		c, ok := s.tokens[it.Type]
+		if !ok {
+			c, _ = utf8.DecodeRuneInString(s.text)
+			if s.text == "" {
+				c = scanner.EOF
+			}
+		}
+		s.eof = c == scanner.EOF
+		return c
+	}
+}
+
+// TokenText returns the text of the most recently scanned token. Since the
+// Lexer does not keep the source text, the text is built from the token value:
+// strings are returned as is, runes as their UTF-8 encoding, fmt.Stringer
+// values by calling their String method and nil values as an empty string.
+// Other values are formatted with fmt.Sprint.
+//
+func (s *Scanner) TokenText() string {
+	return s.text
+}
+
+// Pos returns the position of the character immediately after the most
+// recently scanned token.
+//
+func (s *Scanner) Pos() scanner.Position {
+	return s.position(s.end)
+}
+
+func (s *Scanner) position(offset int) scanner.Position {
+	p := s.l.File().Position(offset)
+	return scanner.Position{Filename: p.Filename, Offset: offset, Line: p.Line, Column: p.Column}
+}
+
+func (s *Scanner) error(msg string) {
+	s.ErrorCount++
+	if s.Error != nil {
+		s.Error(s, msg)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s\n", s.Position, msg)
+}
+
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case rune:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
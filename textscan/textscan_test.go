@@ -0,0 +1,64 @@
+package textscan_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"text/scanner"
+
+	"github.com/db47h/lex"
+	"github.com/db47h/lex/dfa"
+	"github.com/db47h/lex/textscan"
+)
+
+const (
+	tokEOF lex.Token = iota
+	tokIdent
+	tokInt
+	tokOp
+)
+
+func TestScanner(t *testing.T) {
+	m, err := dfa.New([]dfa.Rule{
+		{Pattern: `[a-z]+`, Token: tokIdent},
+		{Pattern: `[0-9]+`, Token: tokInt},
+		{Pattern: `[-+*/=()]`, Token: tokOp},
+		{Pattern: `[ \n]+`, Skip: true},
+	}, tokEOF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader("x = (y+12)\n\t* z")), m.StateFn())
+	s := textscan.New(l, map[lex.Token]rune{
+		tokEOF:   scanner.EOF,
+		tokIdent: scanner.Ident,
+		tokInt:   scanner.Int,
+	})
+	var errs []string
+	s.Error = func(s *textscan.Scanner, msg string) {
+		errs = append(errs, fmt.Sprintf("%s: %s", s.Position, msg))
+	}
+	exp := []string{
+		"test:1:1 Ident x test:1:2",
+		"test:1:3 \"=\" = test:1:4",
+		"test:1:5 \"(\" ( test:1:6",
+		"test:1:6 Ident y test:1:7",
+		"test:1:7 \"+\" + test:1:8",
+		"test:1:8 Int 12 test:1:10",
+		"test:1:10 \")\" ) test:1:11",
+		"test:2:2 \"*\" * test:2:3",
+		"test:2:4 Ident z test:2:5",
+		"test:2:5 EOF  test:2:5",
+		"test:2:5 EOF  test:2:5",
+	}
+	for _, e := range exp {
+		c := s.Scan()
+		got := fmt.Sprintf("%s %s %s %s", s.Position, scanner.TokenString(c), s.TokenText(), s.Pos())
+		if got != e {
+			t.Errorf("got %q, expected %q", got, e)
+		}
+	}
+	if s.ErrorCount != 1 || len(errs) != 1 || errs[0] != "test:2:1: unexpected character U+0009" {
+		t.Errorf("got %d errors: %v", s.ErrorCount, errs)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+// A TokenChannel identifies a stream of tokens. Tokens on the default channel
+// are returned by Lexer.Lex, LexItem and LexBatch. Tokens on other channels,
+// like white space and comments on the hidden channel, are set aside and can
+// be retrieved with Lexer.ChannelItems. See Channels.
+//
+type TokenChannel int
+
+// Predefined channels. Custom channels can use any other value.
+//
+const (
+	DefaultChannel TokenChannel = iota // tokens for the parser
+	HiddenChannel                      // trivia: white space, comments, etc.
+)
+
+// Channels assigns tokens to channels by token type. Token types not in m are
+// on the default channel. This allows a lexer to preserve white space and
+// comments, for example with the Lossless option, without the parser having
+// to skip them:
+//
+//	l := lex.NewLexer(f, initState,
+//		lex.Lossless(tokSpace),
+//		lex.Channels(map[lex.Token]lex.TokenChannel{
+//			tokSpace:   lex.HiddenChannel,
+//			tokComment: lex.HiddenChannel,
+//		}))
+//
+// Tokens on channels other than the default channel are kept in memory until
+// retrieved with Lexer.ChannelItems. Their buffers are not bounded by the
+// MaxQueue option, which only applies to the default channel: they grow without
+// limit if the consumer does not read them, so token types should only be
+// assigned to channels that the consumer reads. Other options, like
+// validation, tracing or statistics, see tokens of all channels.
+//
+func Channels(m map[Token]TokenChannel) Option {
+	return option(func(s *state) {
+		s.chans = m
+	}, "Channels", m)
+}
+
+// ChannelItems returns the tokens of channel c lexed so far and not yet
+// returned by ChannelItems, in the order they were emitted. Tokens on other
+// channels are lexed as a side effect of lexing tokens on the default channel,
+// so that the hidden tokens that precede a token returned by LexItem are
+// available right after LexItem returns.
+//
+// The returned slice belongs to the caller. ChannelItems returns nil for the
+// default channel.
+//
+func (l *Lexer) ChannelItems(c TokenChannel) []Item {
+	items := l.side[c]
+	delete(l.side, c)
+	return items
+}
+
+// route stores it in the buffer of channel c.
+//
+func (q *queue) route(c TokenChannel, it Item) {
+	if q.side == nil {
+		q.side = make(map[TokenChannel][]Item)
+	}
+	q.side[c] = append(q.side[c], it)
+}
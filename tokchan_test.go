@@ -0,0 +1,69 @@
+package lex_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestChannels(t *testing.T) {
+	const tokComment = tokChar + 1
+	init := func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		pos := s.Pos()
+		switch r {
+		case lex.EOF:
+			s.Emit(pos, tokEOF, nil)
+		case ' ', '\n':
+			return nil
+		case '#':
+			for r = s.Next(); r != '\n' && r != lex.EOF; r = s.Next() {
+			}
+			s.Backup()
+			s.Emit(pos, tokComment, nil)
+		default:
+			s.EmitRune(pos, tokChar, r)
+		}
+		return nil
+	}
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader("a b # c\nd")), init,
+		lex.Lossless(tokSpace),
+		lex.Channels(map[lex.Token]lex.TokenChannel{tokSpace: lex.HiddenChannel, tokComment: 2}))
+	var res []string
+	for !l.AtEOF() {
+		it := l.LexItem()
+		var hidden []string
+		for _, h := range l.ChannelItems(lex.HiddenChannel) {
+			hidden = append(hidden, fmt.Sprintf("%q", h.Value()))
+		}
+		res = append(res, fmt.Sprintf("%d@%d %v", it.Type, it.Pos, hidden))
+	}
+	if got, exp := strings.Join(res, ", "), `2@0 [], 2@2 [" "], 2@8 [" " "\n"], 0@9 []`; got != exp {
+		t.Errorf("got %s, expected %s", got, exp)
+	}
+	if c := l.ChannelItems(2); len(c) != 1 || c[0].Pos != 4 || c[0].End != 7 {
+		t.Errorf("bad comment channel: %v", c)
+	}
+	if c := l.ChannelItems(2); c != nil {
+		t.Errorf("channel not emptied: %v", c)
+	}
+}
+
+func TestChannels_MaxQueue(t *testing.T) {
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader("")), func(s *lex.State) lex.StateFn {
+		s.Next()
+		for i := 0; i < 4; i++ {
+			s.Emit(0, tokSpace, nil)
+		}
+		s.Emit(0, tokEOF, nil)
+		return nil
+	}, lex.MaxQueue(1, lex.OverflowError), lex.Channels(map[lex.Token]lex.TokenChannel{tokSpace: lex.HiddenChannel}))
+	if it := l.LexItem(); it.Type != tokEOF || !l.AtEOF() {
+		t.Errorf("got %v, expected EOF", it)
+	}
+	if n := len(l.ChannelItems(lex.HiddenChannel)); n != 4 {
+		t.Errorf("got %d hidden tokens, expected 4", n)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package tokstream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/db47h/lex"
+)
+
+// A Cache stores the encoded token streams of files in a directory so that
+// files that have not changed since they were last lexed do not need to be
+// lexed again.
+//
+// Entries are keyed by file name: there is at most one entry per file, which
+// also records a hash of the file contents. An entry is used only if the hash
+// matches the current contents. Version is part of both the key and the hash:
+// it must be changed whenever a change to the lexer changes its output.
+//
+// Cache files are written atomically, so that several processes can share the
+// same cache directory. Since the cache is only an optimization, errors
+// writing to the cache directory are ignored and corrupt entries are replaced.
+//
+// NewLexer must return a new lexer on each call: LexCached releases it (see
+// lex.Lexer.Release) once the file has been encoded.
+//
+type Cache struct {
+	Dir      string                       // cache directory, which must exist
+	Version  string                       // lexer version
+	NewLexer func(f *lex.File) *lex.Lexer // returns a lexer for f
+}
+
+// LexCached returns a Decoder for the token stream of the named file in fsys.
+// The token stream is read from the cache if the file has not changed since it
+// was cached. Otherwise the file is lexed with a lexer returned by c.NewLexer
+// and the result is cached. The name of the File returned by Decoder.File is
+// name.
+//
+// The returned error is either an error reading the file, or an error from
+// Encode if a token value is not supported.
+//
+func (c *Cache) LexCached(fsys fs.FS, name string) (*Decoder, error) {
+	src, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256([]byte(c.Version + "\x00" + name))
+	path := filepath.Join(c.Dir, hex.EncodeToString(key[:])+".tok")
+	h := sha256.New()
+	h.Write(key[:])
+	h.Write(src)
+	sum := h.Sum(nil)
+
+	if b, err := os.ReadFile(path); err == nil && bytes.HasPrefix(b, sum) {
+		if d := decode(b[len(sum):]); d != nil {
+			return d, nil
+		}
+	}
+
+	var b bytes.Buffer
+	b.Write(sum)
+	l := c.NewLexer(lex.NewFile(name, bytes.NewReader(src)))
+	err = Encode(&b, l)
+	l.Release()
+	if err != nil {
+		return nil, err
+	}
+	c.write(path, b.Bytes())
+	return NewDecoder(bytes.NewReader(b.Bytes()[len(sum):]))
+}
+
+// decode returns a Decoder for the token stream b, or nil if b is not a
+// complete and valid token stream. The stream is decoded once beforehand so
+// that a corrupt or truncated entry is treated as a cache miss rather than
+// reported as an error by the returned Decoder.
+//
+func decode(b []byte) *Decoder {
+	d, err := NewDecoder(bytes.NewReader(b))
+	if err != nil {
+		return nil
+	}
+	for d.Err() == nil && !d.AtEOF() {
+		d.LexItem()
+	}
+	if d.Err() != nil {
+		return nil
+	}
+	d, _ = NewDecoder(bytes.NewReader(b))
+	return d
+}
+
+// write writes a cache entry atomically.
+//
+func (c *Cache) write(path string, b []byte) {
+	f, err := os.CreateTemp(c.Dir, "*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
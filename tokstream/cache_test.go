@@ -0,0 +1,70 @@
+package tokstream_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/db47h/lex"
+	"github.com/db47h/lex/tokstream"
+)
+
+func TestCache_LexCached(t *testing.T) {
+	fsys := fstest.MapFS{"a.txt": {Data: []byte(input)}}
+	n := 0
+	c := &tokstream.Cache{
+		Dir:     t.TempDir(),
+		Version: "1",
+		NewLexer: func(f *lex.File) *lex.Lexer {
+			n++
+			return newFileLexer(f)
+		},
+	}
+	check := func(name string, lexed int) {
+		t.Helper()
+		d, err := c.LexCached(fsys, "a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != lexed {
+			t.Fatalf("%s: lexer called %d times, expected %d", name, n, lexed)
+		}
+		var count int
+		for !d.AtEOF() {
+			if it := d.LexItem(); it.Type == tokIdent && d.File().Name() != "a.txt" {
+				t.Fatalf("%s: bad file name %q", name, d.File().Name())
+			}
+			count++
+		}
+		if d.Err() != nil || count != 10 {
+			t.Fatalf("%s: got %d tokens, error %v", name, count, d.Err())
+		}
+	}
+	check("first", 1)
+	check("cached", 1)
+	fsys["a.txt"].Data = []byte(input + " ")
+	check("modified", 2)
+	check("modified cached", 2)
+	c.Version = "2"
+	check("version", 3)
+	// truncate the entry after its header
+	ents, err := filepath.Glob(filepath.Join(c.Dir, "*.tok"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range ents {
+		b, err := os.ReadFile(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(e, b[:len(b)-3], 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("truncated", 4)
+	check("truncated cached", 4)
+	if _, err := c.LexCached(fsys, "missing.txt"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -0,0 +1,412 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package tokstream implements a compact binary encoding of token streams.
+//
+// It is intended for caching the output of a lexer between tool runs: a
+// parser can consume a Decoder instead of re-lexing unchanged input. Along
+// with the tokens, the stream records the line offsets of the input file so
+// that token positions can be resolved with Decoder.File. Cache implements
+// such a cache on disk, keyed by file name and contents.
+//
+// Token types and values are varint encoded, token offsets are delta encoded
+// and string values are interned. Supported value types are nil, string, rune,
+// int, int64, error, *big.Int and *big.Float. Errors are decoded as errors
+// with the same message, except for the encoding errors of the lex package,
+// which are decoded as the corresponding error variable (lex.ErrNulChar, ...).
+//
+package tokstream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/db47h/lex"
+)
+
+const (
+	magic   = "lextok"
+	version = 1
+)
+
+// record tags
+//
+const (
+	tagEnd = iota
+	tagLine
+	tagToken
+)
+
+// value kinds
+//
+const (
+	valNil = iota
+	valString
+	valStringRef
+	valRune
+	valInt
+	valError
+	valBigInt
+	valBigFloat
+	valInt64
+)
+
+// encodingErrors are decoded as themselves so that errors.Is works on
+// decoded values.
+//
+var encodingErrors = [...]error{lex.ErrNulChar, lex.ErrInvalidRune, lex.ErrInvalidBOM}
+
+// ErrFormat is returned by NewDecoder and reported by Decoder if the input is
+// not a valid token stream.
+//
+var ErrFormat = errors.New("invalid token stream")
+
+type encoder struct {
+	w    *bufio.Writer
+	buf  [binary.MaxVarintLen64]byte
+	strs map[string]int
+	err  error
+}
+
+func (e *encoder) int(i int64) {
+	e.write(e.buf[:binary.PutVarint(e.buf[:], i)])
+}
+
+func (e *encoder) string(s string) {
+	e.int(int64(len(s)))
+	if e.err == nil {
+		_, e.err = e.w.WriteString(s)
+	}
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int(int64(len(b)))
+	e.write(b)
+}
+
+func (e *encoder) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+// Encode reads all tokens from l until it reaches the end of input (see
+// lex.Lexer.AtEOF) and writes them to w.
+//
+func Encode(w io.Writer, l *lex.Lexer) error {
+	e := &encoder{w: bufio.NewWriter(w), strs: make(map[string]int)}
+	f := l.File()
+	e.write([]byte(magic))
+	e.int(version)
+	e.string(f.Name())
+	var (
+		line    = 1 // lines written so far
+		lineOff = 0
+		pos     = 0
+	)
+	lines := func() {
+		for off := f.LineOffset(line + 1); off >= 0; off = f.LineOffset(line + 1) {
+			e.int(tagLine)
+			e.int(int64(off - lineOff))
+			line, lineOff = line+1, off
+		}
+	}
+	for !l.AtEOF() && e.err == nil {
+		it := l.LexItem()
+		lines()
+		e.int(tagToken)
+		e.int(int64(it.Type))
+		e.int(int64(it.Pos - pos))
+		e.int(int64(it.End - it.Pos))
+		pos = it.Pos
+		if err := e.value(it.Value()); err != nil {
+			return err
+		}
+	}
+	lines()
+	e.int(tagEnd)
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+func (e *encoder) value(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		e.int(valNil)
+	case string:
+		if i, ok := e.strs[v]; ok {
+			e.int(valStringRef)
+			e.int(int64(i))
+			break
+		}
+		e.strs[v] = len(e.strs)
+		e.int(valString)
+		e.string(v)
+	case rune:
+		e.int(valRune)
+		e.int(int64(v))
+	case int:
+		e.int(valInt)
+		e.int(int64(v))
+	case int64:
+		e.int(valInt64)
+		e.int(v)
+	case error:
+		e.int(valError)
+		e.string(v.Error())
+	case *big.Int:
+		b, err := v.GobEncode()
+		if err != nil {
+			return err
+		}
+		e.int(valBigInt)
+		e.bytes(b)
+	case *big.Float:
+		b, err := v.GobEncode()
+		if err != nil {
+			return err
+		}
+		e.int(valBigFloat)
+		e.bytes(b)
+	default:
+		return fmt.Errorf("unsupported token value type %T", v)
+	}
+	return nil
+}
+
+// A Decoder reads tokens from a stream written by Encode. It implements
+// lex.TokenSource.
+//
+type Decoder struct {
+	r    *bufio.Reader
+	f    *lex.File
+	strs []string
+	pos  int
+	line int
+	off  int
+	last lex.Item
+	done bool
+	err  error
+}
+
+// NewDecoder returns a new Decoder reading from r. It returns ErrFormat if the
+// stream header is invalid.
+//
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	d := &Decoder{r: bufio.NewReader(r), line: 1}
+	var m [len(magic)]byte
+	if _, err := io.ReadFull(d.r, m[:]); err != nil || string(m[:]) != magic || d.int() != version {
+		return nil, ErrFormat
+	}
+	name := d.string()
+	if d.err != nil {
+		return nil, ErrFormat
+	}
+	d.f = lex.NewFile(name, nil)
+	d.f.AddLine(0, 1)
+	return d, nil
+}
+
+// File returns a File with the name and the line offsets of the original input
+// file, up to the last token read. Since the input itself is not available, the
+// returned File cannot be read from.
+//
+func (d *Decoder) File() *lex.File {
+	return d.f
+}
+
+// Err returns the first decoding error, if any.
+//
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// AtEOF reports whether all tokens have been read from the stream.
+//
+func (d *Decoder) AtEOF() bool {
+	return d.done
+}
+
+// Lex returns the next token in the stream.
+//
+func (d *Decoder) Lex() (lex.Token, int, interface{}) {
+	it := d.LexItem()
+	return it.Type, it.Pos, it.Value()
+}
+
+// LexItem returns the next token in the stream as a lex.Item. Once all tokens
+// have been read, LexItem keeps returning the last token, usually EOF. If a
+// decoding error occurs, it returns an Error token whose value is the error.
+//
+func (d *Decoder) LexItem() lex.Item {
+	for d.err == nil && !d.done {
+		tag := d.int()
+		if d.err != nil {
+			break
+		}
+		switch tag {
+		case tagLine:
+			d.addLine()
+		case tagToken:
+			it := d.item()
+			if d.err != nil {
+				break
+			}
+			d.last = it
+			d.done = d.peekEnd()
+			return it
+		case tagEnd:
+			d.done = true
+		default:
+			d.err = ErrFormat
+		}
+	}
+	if d.err != nil {
+		return lex.NewItem(lex.Error, d.last.End, d.last.End, d.err)
+	}
+	return d.last
+}
+
+func (d *Decoder) addLine() {
+	off := d.off + int(d.int())
+	if d.err != nil || off <= d.off {
+		d.err = ErrFormat
+		return
+	}
+	d.off = off
+	d.line++
+	d.f.AddLine(d.off, d.line)
+}
+
+func (d *Decoder) item() lex.Item {
+	t := lex.Token(d.int())
+	d.pos += int(d.int())
+	end := d.pos + int(d.int())
+	v := d.value()
+	if _, ok := v.(error); t == lex.Error && !ok {
+		d.err = ErrFormat
+	}
+	return lex.NewItem(t, d.pos, end, v)
+}
+
+// peekEnd consumes the line records that follow a token and reports whether
+// the next record marks the end of the stream.
+//
+func (d *Decoder) peekEnd() bool {
+	for d.err == nil {
+		b, err := d.r.Peek(1)
+		if err != nil {
+			return false
+		}
+		// single byte varint encoding of the tags
+		switch b[0] {
+		case tagEnd << 1:
+			d.r.ReadByte()
+			return true
+		case tagLine << 1:
+			d.r.ReadByte()
+			d.addLine()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func (d *Decoder) value() interface{} {
+	switch d.int() {
+	case valNil:
+		return nil
+	case valString:
+		s := d.string()
+		d.strs = append(d.strs, s)
+		return s
+	case valStringRef:
+		i := d.int()
+		if i < 0 || i >= int64(len(d.strs)) {
+			d.err = ErrFormat
+			return nil
+		}
+		return d.strs[i]
+	case valRune:
+		return rune(d.int())
+	case valInt:
+		return int(d.int())
+	case valInt64:
+		return d.int()
+	case valError:
+		msg := d.string()
+		for _, err := range encodingErrors {
+			if msg == err.Error() {
+				return err
+			}
+		}
+		return errors.New(msg)
+	case valBigInt:
+		z := new(big.Int)
+		if err := z.GobDecode(d.bytes()); err != nil {
+			d.err = ErrFormat
+		}
+		return z
+	case valBigFloat:
+		z := new(big.Float)
+		if err := z.GobDecode(d.bytes()); err != nil {
+			d.err = ErrFormat
+		}
+		return z
+	}
+	d.err = ErrFormat
+	return nil
+}
+
+func (d *Decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	i, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.err = ErrFormat
+	}
+	return i
+}
+
+func (d *Decoder) bytes() []byte {
+	l := d.int()
+	if d.err != nil || l < 0 {
+		d.err = ErrFormat
+		return nil
+	}
+	// do not trust l for allocations
+	b, err := io.ReadAll(io.LimitReader(d.r, l))
+	if err != nil || int64(len(b)) != l {
+		d.err = ErrFormat
+		return nil
+	}
+	return b
+}
+
+func (d *Decoder) string() string {
+	return string(d.bytes())
+}
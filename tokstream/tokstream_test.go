@@ -0,0 +1,98 @@
+package tokstream_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/db47h/lex"
+	"github.com/db47h/lex/state"
+	"github.com/db47h/lex/tokstream"
+)
+
+const (
+	tokEOF lex.Token = iota
+	tokInt
+	tokFloat
+	tokString
+	tokChar
+	tokIdent
+)
+
+const input = "foo 42 3.14 \"bar\\n\"\nfoo 'x' \x00\n\n  123456789012345678901234567890 foo"
+
+func newLexer() *lex.Lexer {
+	return newFileLexer(lex.NewFile("test", strings.NewReader(input)))
+}
+
+func newFileLexer(f *lex.File) *lex.Lexer {
+	num := state.Number(tokInt, tokFloat, '.')
+	str := state.QuotedString(tokString)
+	chr := state.QuotedChar(tokChar)
+	return lex.NewLexer(f, func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		s.StartToken(s.Pos())
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r == '"':
+			return str
+		case r == '\'':
+			return chr
+		case unicode.IsDigit(r):
+			return num
+		case unicode.IsLetter(r):
+			for unicode.IsLetter(s.Next()) {
+			}
+			s.Backup()
+			s.Emit(s.TokenPos(), tokIdent, "foo")
+		}
+		return nil
+	})
+}
+
+func TestEncode(t *testing.T) {
+	var b bytes.Buffer
+	if err := tokstream.Encode(&b, newLexer()); err != nil {
+		t.Fatal(err)
+	}
+	d, err := tokstream.NewDecoder(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLexer()
+	for !l.AtEOF() {
+		exp, got := l.LexItem(), d.LexItem()
+		// values are not comparable with == (errors, *big.Int)
+		format := func(it lex.Item) string {
+			return fmt.Sprintf("%d %d %d %v %T", it.Type, it.Pos, it.End, it.Value(), it.Value())
+		}
+		if es, gs := format(exp), format(got); es != gs {
+			t.Errorf("got %s, expected %s", gs, es)
+		}
+		if ep, gp := l.File().Position(exp.Pos), d.File().Position(got.Pos); ep != gp {
+			t.Errorf("%v: got position %v, expected %v", exp, gp, ep)
+		}
+	}
+	if !d.AtEOF() {
+		t.Error("decoder not at EOF")
+	}
+	if it := d.LexItem(); it.Type != tokEOF {
+		t.Errorf("got %v after EOF", it)
+	}
+
+	for i := 0; i < b.Len()-1; i++ {
+		d, err := tokstream.NewDecoder(bytes.NewReader(b.Bytes()[:i]))
+		if err != nil {
+			continue
+		}
+		for !d.AtEOF() && d.Err() == nil {
+			d.LexItem()
+		}
+		if d.Err() != tokstream.ErrFormat {
+			t.Fatalf("truncated at %d: got error %v", i, d.Err())
+		}
+	}
+}
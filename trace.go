@@ -0,0 +1,166 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+)
+
+// TraceKind is the kind of a TraceEvent.
+//
+type TraceKind int
+
+// Trace event kinds.
+//
+const (
+	TraceEnter  TraceKind = iota // a state function is called
+	TraceExit                    // a state function returns
+	TraceRune                    // a rune is read by State.Next
+	TraceBackup                  // State.Backup is called
+	TraceEmit                    // a token is emitted
+)
+
+var traceKinds = [...]string{
+	TraceEnter:  "enter",
+	TraceExit:   "exit",
+	TraceRune:   "rune",
+	TraceBackup: "backup",
+	TraceEmit:   "emit",
+}
+
+func (k TraceKind) String() string {
+	if k >= 0 && int(k) < len(traceKinds) {
+		return traceKinds[k]
+	}
+	return fmt.Sprintf("TraceKind(%d)", int(k))
+}
+
+// A TraceEvent describes a step of a lexer. See WithTrace.
+//
+type TraceEvent struct {
+	Kind  TraceKind
+	State string // TraceEnter, TraceExit: name of the state function
+	Next  string // TraceExit: name of the returned state function or "" for nil
+	Rune  rune   // TraceRune, TraceBackup: value of State.Current after the event
+	Pos   int    // TraceRune, TraceBackup: value of State.Pos after the event
+	Item  Item   // TraceEmit: emitted token
+	Type  string // TraceEmit: name of the token type (see Lexer.TokenName)
+}
+
+// WithTrace sets a function that is called for every step of the lexer: entry
+// into and exit from state functions, runes read by State.Next, calls to
+// State.Backup and emitted tokens. Runes accepted in bulk by
+// State.AcceptWhileByteSet and State.AcceptWhileClass are reported as
+// individual TraceRune events. Runes read with State.ReadRune are not
+// reported.
+//
+// State functions are identified by the name of their code as reported by the
+// runtime: closures are named after the function that creates them, followed
+// by a suffix like ".func1".
+//
+// Tracing is meant for debugging state functions and slows down lexing
+// considerably. See TraceWriter for a simple textual rendering of the trace.
+//
+func WithTrace(fn func(TraceEvent)) Option {
+	return debugOption(func(s *state) {
+		s.trace = &tracer{fn: fn, names: make(map[uintptr]string)}
+	}, "WithTrace", "fn")
+}
+
+type tracer struct {
+	fn    func(TraceEvent)
+	names map[uintptr]string
+}
+
+func (t *tracer) name(fn StateFn) string {
+	if fn == nil {
+		return ""
+	}
+	pc := reflect.ValueOf(fn).Pointer()
+	n, ok := t.names[pc]
+	if !ok {
+		n = funcName(pc)
+		t.names[pc] = n
+	}
+	return n
+}
+
+// initTrace sets up the queue hook for TraceEmit events.
+//
+func (s *state) initTrace() {
+	check := s.check
+	s.check = func(it Item) {
+		if check != nil {
+			check(it)
+		}
+		s.trace.fn(TraceEvent{Kind: TraceEmit, Item: it, Type: s.tokenName(it.Type)})
+	}
+}
+
+func (s *State) traceRune() {
+	s.trace.fn(TraceEvent{Kind: TraceRune, Rune: s.Current(), Pos: s.Pos()})
+}
+
+// TraceWriter returns a trace function that writes a textual rendering of
+// trace events to w, one line per event. Events that occur while a state
+// function runs are indented:
+//
+//	main.lexInit
+//		rune 'a' @0
+//		rune ' ' @1
+//		backup 'a' @0
+//		emit 1 [0:1] a
+//		-> nil
+//
+// EOF is rendered as EOF and the absence of a current rune after a Backup (see
+// State.Current) as "none". Write errors are ignored.
+//
+func TraceWriter(w io.Writer) func(TraceEvent) {
+	return func(e TraceEvent) {
+		switch e.Kind {
+		case TraceEnter:
+			fmt.Fprintln(w, e.State)
+		case TraceExit:
+			next := e.Next
+			if next == "" {
+				next = "nil"
+			}
+			fmt.Fprintf(w, "\t-> %s\n", next)
+		case TraceRune, TraceBackup:
+			fmt.Fprintf(w, "\t%v %s @%d\n", e.Kind, traceRune(e.Rune), e.Pos)
+		case TraceEmit:
+			fmt.Fprintf(w, "\temit %s [%d:%d] %v\n", e.Type, e.Item.Pos, e.Item.End, e.Item.Value())
+		}
+	}
+}
+
+func traceRune(r rune) string {
+	switch r {
+	case EOF:
+		return "EOF"
+	case utf8.RuneSelf:
+		return "none"
+	}
+	return strconv.QuoteRune(r)
+}
@@ -0,0 +1,52 @@
+package lex_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func lexTraceInit(s *lex.State) lex.StateFn {
+	if s.Next() == lex.EOF {
+		s.Emit(s.Pos(), tokEOF, nil)
+		return nil
+	}
+	s.Backup()
+	return lexTraceWord
+}
+
+func lexTraceWord(s *lex.State) lex.StateFn {
+	pos := s.Pos() + 1
+	s.AcceptWhileByteSet(&[256]bool{'a': true, 'b': true})
+	s.Next()
+	s.Backup()
+	s.EmitString(pos, tokChar, "ab")
+	return nil
+}
+
+func TestWithTrace(t *testing.T) {
+	var b strings.Builder
+	l := lex.NewLexer(lex.NewFile("test", strings.NewReader("ab")), lexTraceInit, lex.WithTrace(lex.TraceWriter(&b)))
+	for tt, _, _ := l.Lex(); tt != tokEOF; tt, _, _ = l.Lex() {
+	}
+	exp := `github.com/db47h/lex_test.lexTraceInit
+	rune 'a' @0
+	backup none @-1
+	-> github.com/db47h/lex_test.lexTraceWord
+github.com/db47h/lex_test.lexTraceWord
+	rune 'a' @0
+	rune 'b' @1
+	rune EOF @2
+	backup 'b' @1
+	emit 2 [0:2] ab
+	-> nil
+github.com/db47h/lex_test.lexTraceInit
+	rune EOF @2
+	emit 0 [2:2] <nil>
+	-> nil
+`
+	if got := b.String(); got != exp {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, exp)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// Encoding makes the lexer transcode its input from the given encoding, for
+// example charmap.ISO8859_1 or unicode.UTF16(unicode.LittleEndian,
+// unicode.UseBOM), to UTF-8 as it is read. State functions see the decoded
+// runes while offsets and sizes returned by State.ReadRune, token positions
+// and line information still refer to the original input, so that positions
+// reported by File.Position match the file on disk.
+//
+// Input that the decoder cannot decode is reported as ErrInvalidRune, but most
+// decoders replace invalid input with U+FFFD instead. A byte order mark that is
+// not consumed by the decoder is ignored at the beginning of the input and
+// reported as ErrInvalidBOM elsewhere, like with UTF-8 input.
+//
+// Transcoding disables the LazyLines option as well as the fast paths of
+// AcceptWhileByteSet and AcceptWhileClass, which then read runes one by one.
+// Filler tokens of the Lossless option contain the original bytes.
+//
+func Encoding(e encoding.Encoding) Option {
+	return option(func(s *state) {
+		s.dec = &decoder{enc: e, t: e.NewDecoder()}
+	}, "Encoding", e)
+}
+
+type decoder struct {
+	enc  encoding.Encoding
+	t    transform.Transformer
+	r    rune // rune decoded ahead, if n > 0
+	n    int  // input size of r
+	dst  [utf8.UTFMax]byte
+	fail bool // the last rune decoded is invalid input
+}
+
+func (d *decoder) reset() {
+	d.t.Reset()
+	d.n = 0
+}
+
+// decodeRune decodes the next rune in the input buffer and returns it along
+// with its size in the input. The caller must then advance s.r by that size.
+// A size of zero indicates the end of input.
+//
+// Since decoders are stateful, decodeRune transforms the input one rune at a
+// time: it calls the decoder with an output buffer of increasing size until it
+// produces some output. The first output rune is then the only one.
+//
+func (s *State) decodeRune() (r rune, n int) {
+	d := s.dec
+	if d.n > 0 {
+		r, n, d.n = d.r, d.n, 0
+		return r, n
+	}
+	d.fail = false
+	skip := 0 // input consumed without output, like a BOM
+	for {
+		src := s.buf[s.r+skip : s.w]
+		atEOF := s.ioErr != nil
+		for sz := 1; sz <= utf8.UTFMax; sz++ {
+			nDst, nSrc, err := d.t.Transform(d.dst[:sz], src, atEOF)
+			skip += nSrc
+			src = src[nSrc:]
+			if nDst > 0 {
+				r, _ = utf8.DecodeRune(d.dst[:nDst])
+				return r, skip
+			}
+			switch err {
+			case transform.ErrShortDst:
+				continue
+			case transform.ErrShortSrc:
+				if !atEOF && s.w-s.r < s.bufSize {
+					break
+				}
+				fallthrough
+			default:
+				if len(src) == 0 {
+					return EOF, skip
+				}
+				// undecodable input: skip one byte.
+				d.fail = true
+				return utf8.RuneError, skip + 1
+			case nil:
+				// all the input has been consumed.
+				if atEOF {
+					return EOF, skip
+				}
+			}
+			break
+		}
+		s.fill()
+	}
+}
+
+// readDecoded returns the next decoded rune.
+//
+func (s *State) readDecoded() (rune, int, error) {
+again:
+	off := s.offs + s.r
+	r, n := s.decodeRune()
+	s.r += n
+	if r == EOF {
+		if s.Current() != EOF {
+			s.pushUndo(s.offs+s.r, EOF, 1)
+		}
+		return 0, 0, s.ioErr
+	}
+	switch {
+	case s.dec.fail:
+		s.pushEncodingError(Item{Type: Error, Pos: off, End: off + n, v: ErrInvalidRune})
+		goto again
+	case r == 0:
+		s.pushEncodingError(Item{Type: Error, Pos: off, End: off + n, v: ErrNulChar})
+		goto again
+	case r == 0xfeff:
+		if off > 0 {
+			s.pushEncodingError(Item{Type: Error, Pos: off, End: off + n, v: ErrInvalidBOM})
+		}
+		goto again
+	case s.bidi != BidiAllow && isBidiControl(r) && !s.bidiControl(off, n, r):
+		goto again
+	case r == '\n':
+		s.newline(off + n)
+	case r == '\r' && s.nl&newlineCR != 0:
+		d := s.dec
+		if nr, nn := s.decodeRune(); nr == '\n' && !d.fail {
+			if s.nl&NewlineCRLF != 0 {
+				s.r += nn
+				n += nn
+				r = '\n'
+				s.newline(off + n)
+			} else {
+				d.r, d.n = nr, nn
+			}
+		} else {
+			if nn > 0 {
+				d.r, d.n = nr, nn
+			}
+			if s.nl&NewlineCR != 0 {
+				r = '\n'
+				s.newline(off + n)
+			}
+		}
+	case s.nl&NewlineUnicode != 0 && (r == 0x85 || r == 0x2028 || r == 0x2029):
+		s.newline(off + n)
+		r = '\n'
+	}
+	s.pushUndo(off, r, n)
+	return r, n, nil
+}
@@ -0,0 +1,72 @@
+package lex_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/db47h/lex"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+func TestEncoding(t *testing.T) {
+	// words are read with AcceptWhileClass, other runes are emitted one by one.
+	word := lex.NewClass(unicode.Letter)
+	init := func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		pos := s.Pos()
+		switch {
+		case r == lex.EOF:
+			s.Emit(pos, tokEOF, nil)
+		case unicode.IsLetter(r):
+			s.AcceptWhileClass(word)
+			s.EmitString(pos, tokChar, "w")
+		default:
+			s.EmitRune(pos, tokChar, r)
+		}
+		return nil
+	}
+	td := []struct {
+		enc encoding.Encoding
+		in  string
+		res string
+	}{
+		{charmap.ISO8859_1, "\xe9t\xe9\n\xa7", "w0-3 \\n3-4 §4-5@2:1"},
+		{xunicode.UTF16(xunicode.LittleEndian, xunicode.UseBOM), "\xff\xfe\xe9\x00t\x00\r\x00\n\x00\xa7\x00", "w0-6 \\n6-10 §10-12@2:1"},
+		{xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM), "\x00a\xd8\x3d\xde\x00\x00\r", "w0-2 \U0001f6002-6 \\n6-8"},
+		{japanese.ShiftJIS, "x\x82\xa0\n\x82\xa0", "w0-3 \\n3-4 w4-6@2:1"},
+	}
+	for _, d := range td {
+		l := lex.NewLexer(lex.NewFile("test", strings.NewReader(d.in)), init,
+			lex.BufferSize(lex.MinBufferSize), lex.Newlines(lex.NewlineCRLF|lex.NewlineCR), lex.Encoding(d.enc))
+		var (
+			res  []string
+			last lex.Item
+		)
+		for it := l.LexItem(); it.Type != tokEOF; it = l.LexItem() {
+			if it.Type == lex.Error {
+				t.Fatal(it.Err())
+			}
+			v, ok := it.Str()
+			if !ok {
+				r, _ := it.Rune()
+				if v = string(r); v == "\n" {
+					v = "\\n"
+				}
+			}
+			res = append(res, fmt.Sprintf("%s%d-%d", v, it.Pos, it.End))
+			last = it
+		}
+		got := strings.Join(res, " ")
+		if p := l.File().Position(last.Pos); p.Line > 1 {
+			got += fmt.Sprintf("@%d:%d", p.Line, p.Column)
+		}
+		if got != d.res {
+			t.Errorf("%s %q:\nGot     : %s\nExpected: %s", d.enc, d.in, got, d.res)
+		}
+	}
+}
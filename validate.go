@@ -0,0 +1,110 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import "fmt"
+
+// maxIdleSteps is the number of consecutive state function calls that may
+// neither consume input nor emit a token before a lexer with validation
+// enabled panics.
+//
+const maxIdleSteps = 1000
+
+// WithValidation enables debug checks of emitted tokens and of the progress of
+// state functions. The lexer panics as soon as one of the following rules is
+// violated:
+//
+//   - the offset of a token is within the input read so far and its end offset
+//     is not before its start offset.
+//   - the offset of a token other than Error or Warning is not before the
+//     offset of the previous such token.
+//   - the token type is either Error, Warning or a value >= 0.
+//   - state functions make progress: 1000 consecutive state function calls
+//     that neither consume input nor emit a token are considered an infinite
+//     loop.
+//
+// Validation is meant to be enabled in tests so that bugs in state functions
+// are detected close to where they happen, instead of as corrupted positions
+// further down the line.
+//
+func WithValidation() Option {
+	return option(func(s *state) {
+		s.v = new(validator)
+	}, "WithValidation")
+}
+
+type validator struct {
+	s     *State
+	last  int // offset of the last token other than Error
+	pos   int // Pos at the last progress check
+	n     int // number of tokens emitted since the last progress check
+	steps int // number of state function calls without progress
+}
+
+func (s *state) initValidator() {
+	*s.v = validator{s: (*State)(s), pos: -1}
+	s.check = s.v.check
+}
+
+// position returns the position of the current rune.
+//
+func (v *validator) position() Position {
+	p := v.s.Pos()
+	if p < 0 {
+		p = 0
+	}
+	return v.s.f.Position(p)
+}
+
+func (v *validator) fail(it Item, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	panic(fmt.Errorf("lex: invalid token %d at %v: %s", it.Type, v.position(), msg))
+}
+
+// check validates an item being pushed to the queue.
+//
+func (v *validator) check(it Item) {
+	v.n++
+	if it.Type < 0 && it.Type != Error && it.Type != Warning {
+		v.fail(it, "reserved token type")
+	}
+	if read := v.s.offs + v.s.r; it.Pos < 0 || it.Pos > read || it.End < it.Pos || it.End > read {
+		v.fail(it, "offsets [%d, %d) out of bounds [0, %d]", it.Pos, it.End, read)
+	}
+	if it.Type == Error || it.Type == Warning {
+		return
+	}
+	if it.Pos < v.last {
+		v.fail(it, "offset %d before previous token offset %d", it.Pos, v.last)
+	}
+	v.last = it.Pos
+}
+
+// step checks that state functions make progress.
+//
+func (v *validator) step() {
+	if p := v.s.Pos(); p != v.pos || v.n > 0 {
+		v.pos, v.n, v.steps = p, 0, 0
+		return
+	}
+	if v.steps++; v.steps >= maxIdleSteps {
+		panic(fmt.Errorf("lex: no progress after %d state function calls at %v", v.steps, v.position()))
+	}
+}
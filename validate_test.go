@@ -0,0 +1,69 @@
+package lex_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+)
+
+func TestWithValidation(t *testing.T) {
+	td := []struct {
+		name string
+		in   string
+		fn   lex.StateFn
+		err  string
+	}{
+		{"ok", "ab c", func(s *lex.State) lex.StateFn {
+			switch r := s.Next(); r {
+			case lex.EOF:
+				s.Emit(s.Pos(), tokEOF, nil)
+			case ' ':
+				s.Errorf(s.Pos(), "space")
+			default:
+				s.Emit(s.Pos(), tokChar, r)
+			}
+			return nil
+		}, ""},
+		{"reserved", "a", func(s *lex.State) lex.StateFn {
+			s.Next()
+			s.Emit(s.Pos(), -3, nil)
+			return nil
+		}, "lex: invalid token -3 at test:1:1: reserved token type"},
+		{"bounds", "ab", func(s *lex.State) lex.StateFn {
+			s.Next()
+			s.Emit(s.Pos()+2, tokChar, nil)
+			return nil
+		}, "lex: invalid token 2 at test:1:1: offsets [2, 2) out of bounds [0, 1]"},
+		{"order", "ab", func(s *lex.State) lex.StateFn {
+			s.Next()
+			s.Next()
+			s.Emit(s.Pos(), tokChar, nil)
+			s.Emit(s.Pos()-1, tokChar, nil)
+			return nil
+		}, "lex: invalid token 2 at test:1:2: offset 0 before previous token offset 1"},
+		{"progress", "ab", func(s *lex.State) lex.StateFn {
+			s.Next()
+			s.Backup()
+			return nil
+		}, "lex: no progress after 1000 state function calls at test:1:1"},
+	}
+	for _, d := range td {
+		err := func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = r.(error)
+				}
+			}()
+			l := lex.NewLexer(lex.NewFile("test", strings.NewReader(d.in)), d.fn, lex.WithValidation())
+			for i := 0; i < 10 && !l.AtEOF(); i++ {
+				l.Lex()
+			}
+			return nil
+		}()
+		if got := fmt.Sprint(err); d.err == "" && err != nil || d.err != "" && got != d.err {
+			t.Errorf("%s: got error %v, expected %q", d.name, err, d.err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lex
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// AmbiguousWidth is the width in text cells of East Asian ambiguous characters
+// like '°', '×' or Greek and Cyrillic letters, which depends on the terminal
+// and locale: they are usually narrow, except in CJK locales.
+//
+type AmbiguousWidth int
+
+// Widths of East Asian ambiguous characters.
+//
+const (
+	AmbiguousNarrow AmbiguousWidth = 1
+	AmbiguousWide   AmbiguousWidth = 2
+)
+
+// TextWidth returns the width of the UTF-8 text b in text cells when rendered
+// in a terminal with a monospaced font. East Asian wide and fullwidth
+// characters take two cells, ambiguous characters take amb cells, combining
+// marks and non-graphic characters, including tabs, take no space and other
+// characters take one cell.
+//
+func TextWidth(b []byte, amb AmbiguousWidth) int {
+	w := 0
+	for i := 0; i < len(b); {
+		r, s := utf8.DecodeRune(b[i:])
+		i += s
+		if r < utf8.RuneSelf {
+			if r >= 0x20 && r < 0x7f {
+				w++
+			}
+			continue
+		}
+		if !unicode.IsGraphic(r) || unicode.In(r, unicode.Mn, unicode.Me) {
+			continue
+		}
+		switch width.LookupRune(r).Kind() {
+		case width.EastAsianFullwidth, width.EastAsianWide:
+			w += 2
+		case width.EastAsianAmbiguous:
+			w += int(amb)
+		default:
+			w++
+		}
+	}
+	return w
+}
+
+// VisualPosition is like Position but also sets the VisualColumn field of the
+// returned position, which is useful to align a caret under the source line of
+// a diagnostic:
+//
+//	p, err := f.VisualPosition(offset, lex.AmbiguousNarrow)
+//	if err == nil {
+//		fmt.Printf("%s\n%*c\n", line, p.VisualColumn, '^')
+//	}
+//
+// The visual column is computed from the source line as returned by
+// GetLineBytes, so the same restrictions apply: the underlying reader of f
+// must implement io.Seeker. Since tabs take no space in the computation, the
+// caret line should reproduce the tabs that precede the offset in the source
+// line.
+//
+func (f *File) VisualPosition(offset int, amb AmbiguousWidth) (Position, error) {
+	p := f.Position(offset)
+	l, err := f.GetLineBytes(offset)
+	if err != nil {
+		return p, err
+	}
+	b := p.Column - 1
+	if b > len(l) {
+		b = len(l)
+	}
+	p.VisualColumn = TextWidth(l[:b], amb) + 1
+	return p, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2017-2020 Denis Bernard <db047h@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package yacc provides an adapter to use a lex.Lexer as the lexer of parsers
+// generated by goyacc.
+//
+// Given a grammar whose %union generates the yySymType type:
+//
+//	%union {
+//		item lex.Item
+//		// ...
+//	}
+//
+// the parser can be fed directly from a lex.Lexer:
+//
+//	y := yacc.New(l, map[lex.Token]int{tokNum: NUM, tokIdent: IDENT},
+//		func(lval *yySymType, it lex.Item) { lval.item = it })
+//	yyParse(y)
+//	if err := y.Errors().Err(); err != nil {
+//		// ...
+//	}
+//
+package yacc
+
+import (
+	"github.com/db47h/lex"
+)
+
+// An Adapter implements the yyLexer interface expected by goyacc generated
+// parsers on top of a lex.Lexer. S is the yySymType type of the parser.
+//
+type Adapter[S any] struct {
+	l      *lex.Lexer
+	tokens map[lex.Token]int
+	set    func(lval *S, it lex.Item)
+	last   lex.Item
+	errs   lex.ErrorList
+}
+
+// New returns a new Adapter reading tokens from l.
+//
+// The tokens map translates token types to the token numbers of the parser
+// (the constants declared with %token in the grammar). Tokens that are not
+// found in the map are returned as their value if it is a rune, which matches
+// character literal tokens like '+' in the grammar, or as 0 otherwise. Since 0
+// means end of input to a goyacc parser, the lexer's EOF token does not need
+// to be in the map if its value is nil.
+//
+// If set is not nil, it is called with every token before it is returned to
+// the parser and should store the token or its value in lval.
+//
+func New[S any](l *lex.Lexer, tokens map[lex.Token]int, set func(lval *S, it lex.Item)) *Adapter[S] {
+	return &Adapter[S]{l: l, tokens: tokens, set: set}
+}
+
+// Lex returns the next token number for the parser. Error tokens are recorded
+// in the error list and skipped.
+//
+func (a *Adapter[S]) Lex(lval *S) int {
+	it := a.l.LexItem()
+	for it.Type == lex.Error {
+		a.errs.Add(a.l.File().Position(it.Pos), it.Err().Error())
+		it = a.l.LexItem()
+	}
+	a.last = it
+	if a.set != nil {
+		a.set(lval, it)
+	}
+	if n, ok := a.tokens[it.Type]; ok {
+		return n
+	}
+	if r, ok := it.Rune(); ok {
+		return int(r)
+	}
+	return 0
+}
+
+// Error records a syntax error reported by the parser at the position of the
+// last token returned by Lex.
+//
+func (a *Adapter[S]) Error(msg string) {
+	a.errs.Add(a.l.File().Position(a.last.Pos), msg)
+}
+
+// Errors returns the lexing and syntax errors reported so far, in the order
+// in which they were reported.
+//
+func (a *Adapter[S]) Errors() lex.ErrorList {
+	return a.errs
+}
+
+// Item returns the last token returned by Lex.
+//
+func (a *Adapter[S]) Item() lex.Item {
+	return a.last
+}
@@ -0,0 +1,84 @@
+package yacc_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/db47h/lex"
+	"github.com/db47h/lex/yacc"
+)
+
+// parser side declarations, as generated by goyacc.
+
+const (
+	NUM = 57346 + iota
+	IDENT
+)
+
+type yySymType struct {
+	yys  int
+	item lex.Item
+}
+
+type yyLexer interface {
+	Lex(lval *yySymType) int
+	Error(s string)
+}
+
+const (
+	tokEOF lex.Token = iota
+	tokNum
+	tokIdent
+	tokOp
+)
+
+func lexer(input string) *lex.Lexer {
+	return lex.NewLexer(lex.NewFile("test", strings.NewReader(input)), func(s *lex.State) lex.StateFn {
+		r := s.Next()
+		s.StartToken(s.Pos())
+		switch {
+		case r == lex.EOF:
+			s.Emit(s.Pos(), tokEOF, nil)
+		case r >= '0' && r <= '9':
+			s.Emit(s.Pos(), tokNum, int(r-'0'))
+		case r >= 'a' && r <= 'z':
+			s.Emit(s.Pos(), tokIdent, string(r))
+		case r == '+' || r == '*':
+			s.Emit(s.Pos(), tokOp, r)
+		case r == ' ':
+		default:
+			s.Errorf(s.Pos(), "unexpected character %q", r)
+		}
+		return nil
+	})
+}
+
+func TestAdapter(t *testing.T) {
+	var y yyLexer = yacc.New(lexer("1 + x*?2"), map[lex.Token]int{tokNum: NUM, tokIdent: IDENT},
+		func(lval *yySymType, it lex.Item) { lval.item = it })
+	exp := []string{
+		"57346 1",
+		"43 43",
+		"57347 x",
+		"42 42",
+		"57346 2",
+		"0 <nil>",
+	}
+	var lval yySymType
+	for _, e := range exp {
+		n := y.Lex(&lval)
+		if got := fmt.Sprintf("%d %v", n, lval.item.Value()); got != e {
+			t.Errorf("got %q, expected %q", got, e)
+		}
+		if n == 0 {
+			y.Error("syntax error")
+		}
+	}
+	errs := y.(*yacc.Adapter[yySymType]).Errors()
+	if len(errs) != 2 ||
+		errs[0].Error() != "test:1:7: unexpected character '?'" ||
+		errs[1].Error() != "test:1:9: syntax error" {
+		t.Errorf("got errors %v", errs)
+	}
+}